@@ -0,0 +1,181 @@
+package apierror
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Code is the machine-readable kind of an error
+type Code string
+
+const (
+	CodeNotFound             Code = "not_found"
+	CodeRateLimited          Code = "rate_limited"
+	CodeUpstreamUnavailable  Code = "upstream_unavailable"
+	CodeBadResponse          Code = "bad_response"
+	CodeInvalidInput         Code = "invalid_input"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeConflict             Code = "conflict"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeTooLarge             Code = "too_large"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeInternal             Code = "internal"
+)
+
+// statuses maps each code to the status it is returned with
+var statuses = map[Code]int{
+	CodeNotFound:             http.StatusNotFound,
+	CodeRateLimited:          http.StatusTooManyRequests,
+	CodeUpstreamUnavailable:  http.StatusServiceUnavailable,
+	CodeBadResponse:          http.StatusBadGateway,
+	CodeInvalidInput:         http.StatusBadRequest,
+	CodeUnauthorized:         http.StatusUnauthorized,
+	CodeForbidden:            http.StatusForbidden,
+	CodeConflict:             http.StatusConflict,
+	CodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	CodeTooLarge:             http.StatusRequestEntityTooLarge,
+	CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	CodeInternal:             http.StatusInternalServerError,
+}
+
+// Status returns the HTTP status for code
+func Status(code Code) int {
+	if status, ok := statuses[code]; ok {
+		return status
+	}
+	return http.StatusInternalServerError
+}
+
+// CodeForStatus returns the code for an HTTP status
+func CodeForStatus(status int) Code {
+	for code, s := range statuses {
+		if s == status {
+			return code
+		}
+	}
+	if status == http.StatusGatewayTimeout {
+		return CodeBadResponse
+	}
+	return CodeInternal
+}
+
+// Sentinels to match errors of each code with errors.Is, whatever upstream
+// they came from
+var (
+	ErrNotFound            = &Error{Code: CodeNotFound, Message: "not found"}
+	ErrRateLimited         = &Error{Code: CodeRateLimited, Message: "rate limited"}
+	ErrUpstreamUnavailable = &Error{Code: CodeUpstreamUnavailable, Message: "upstream unavailable"}
+	ErrBadResponse         = &Error{Code: CodeBadResponse, Message: "bad response"}
+	ErrInvalidInput        = &Error{Code: CodeInvalidInput, Message: "invalid input"}
+)
+
+// Error is an error that can be shown to API callers
+type Error struct {
+	Code    Code
+	Message string
+	// Upstream is the API the error came from, empty for keiko's own errors
+	Upstream string
+	// RetryAfter is how long the upstream asked to wait before retrying
+	RetryAfter time.Duration
+	// Err is the underlying error, it is logged but never shown
+	Err error
+}
+
+// New creates an Error
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Errorf creates an Error with a formatted message
+func Errorf(code Code, format string, args ...interface{}) *Error {
+	return New(code, fmt.Sprintf(format, args...))
+}
+
+// Upstream creates an Error for a failed call to upstream, wrapping err
+func Upstream(upstream string, code Code, message string, err error) *Error {
+	return &Error{Code: code, Message: message, Upstream: upstream, Err: err}
+}
+
+// Unreachable is the error for an upstream that could not be called
+func Unreachable(upstream string, err error) *Error {
+	return Upstream(upstream, CodeUpstreamUnavailable, "unavailable", err)
+}
+
+// Decode is the error for an upstream response that could not be decoded
+func Decode(upstream string, err error) *Error {
+	return Upstream(upstream, CodeBadResponse, "unexpected response", err)
+}
+
+// FromResponse returns the error for a non-2xx upstream response, or nil.
+// The start of the body is kept in the wrapped error for the logs.
+func FromResponse(upstream string, resp *http.Response) error {
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return nil
+	}
+
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err := fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return Upstream(upstream, CodeNotFound, "not found", err)
+	case resp.StatusCode == http.StatusTooManyRequests:
+		e := Upstream(upstream, CodeRateLimited, "rate limited, try again later", err)
+		e.RetryAfter = retryAfter(resp.Header.Get("Retry-After"))
+		return e
+	case resp.StatusCode >= 500:
+		return Upstream(upstream, CodeUpstreamUnavailable, "unavailable", err)
+	default:
+		return Upstream(upstream, CodeBadResponse, "request rejected", err)
+	}
+}
+
+// retryAfter parses a Retry-After header in seconds or as an HTTP date
+func retryAfter(header string) time.Duration {
+	if header == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(header); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(header); err == nil && time.Until(t) > 0 {
+		return time.Until(t)
+	}
+	return 0
+}
+
+func (e *Error) Error() string {
+	msg := e.Message
+	if e.Upstream != "" {
+		msg = e.Upstream + ": " + msg
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches the sentinel of the error's code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code && t.Upstream == "" && t.Err == nil
+}
+
+// PublicMessage is the message shown to API callers, without the details of
+// the wrapped error
+func (e *Error) PublicMessage() string {
+	if e.Upstream != "" {
+		return e.Upstream + ": " + e.Message
+	}
+	return e.Message
+}
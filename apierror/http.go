@@ -0,0 +1,87 @@
+package apierror
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+)
+
+// RequestIDHeader carries the request ID in both directions
+const RequestIDHeader = "X-Request-ID"
+
+// validRequestID is what is accepted from callers that send their own ID
+var validRequestID = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+type requestIDKey struct{}
+
+// ErrorResp is the body of every error response
+type ErrorResp struct {
+	Error ErrorBody `json:"error"`
+}
+
+type ErrorBody struct {
+	Code      Code   `json:"code"`
+	Message   string `json:"message"`
+	RequestID string `json:"requestId"`
+}
+
+// WithRequestID returns a copy of ctx carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID in ctx
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns the caller's X-Request-ID when it is sane, otherwise a
+// random one
+func NewRequestID(r *http.Request) string {
+	if id := r.Header.Get(RequestIDHeader); validRequestID.MatchString(id) {
+		return id
+	}
+
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Write writes err as a JSON error with the status of its code. Errors that
+// are not an *Error are written as internal errors and their message is not
+// shown.
+func Write(w http.ResponseWriter, r *http.Request, err error) {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = New(CodeInternal, "internal error")
+	}
+
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", fmt.Sprintf("%.0f", e.RetryAfter.Seconds()))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(Status(e.Code))
+
+	json.NewEncoder(w).Encode(ErrorResp{
+		Error: ErrorBody{
+			Code:      e.Code,
+			Message:   e.PublicMessage(),
+			RequestID: RequestID(r.Context()),
+		},
+	})
+}
+
+// HTTPError writes a JSON error with message and the code for status, it
+// replaces http.Error
+func HTTPError(w http.ResponseWriter, r *http.Request, message string, status int) {
+	Write(w, r, New(CodeForStatus(status), message))
+}
@@ -0,0 +1,270 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"sync"
+	"time"
+
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// keyPrefix makes keiko keys easy to spot in logs and secret scanners
+	keyPrefix = "keiko_"
+	// displayPrefixLen is how much of a key is kept to identify it
+	displayPrefixLen = len(keyPrefix) + 6
+)
+
+// Registry is a live view of the application API keys. It is reloaded from
+// the database on an interval and after every admin change.
+type Registry struct {
+	db     *database.DatabaseClient
+	logger *zap.SugaredLogger
+
+	mu   sync.RWMutex
+	keys map[string]entry
+	// warned holds the apps whose plaintext key could not be hashed, so
+	// they are only warned about once
+	warned map[string]bool
+}
+
+type entry struct {
+	appID   string
+	expires time.Time
+}
+
+// ProvideRegistry provides an API key registry
+func ProvideRegistry(
+	lc fx.Lifecycle,
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	db *database.DatabaseClient,
+) *Registry {
+	reg := NewRegistry(db, logger)
+
+	if err := reg.Refresh(context.Background()); err != nil {
+		logger.Fatalf("Failed to load applications: %v", err)
+	}
+
+	ticker := time.NewTicker(cfg.ApplicationRefreshInterval)
+	done := make(chan struct{})
+
+	lc.Append(
+		fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					for {
+						select {
+						case <-ticker.C:
+							if err := reg.Refresh(context.Background()); err != nil {
+								logger.Errorw("Failed to refresh applications", "error", err)
+							}
+						case <-done:
+							return
+						}
+					}
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				ticker.Stop()
+				close(done)
+				return nil
+			},
+		},
+	)
+
+	return reg
+}
+
+var Options = ProvideRegistry
+
+// NewRegistry creates an empty registry, call Refresh to load it
+func NewRegistry(db *database.DatabaseClient, logger *zap.SugaredLogger) *Registry {
+	return &Registry{
+		db:     db,
+		logger: logger,
+		keys:   make(map[string]entry),
+		warned: make(map[string]bool),
+	}
+}
+
+// Refresh reloads every application key from the database
+func (r *Registry) Refresh(ctx context.Context) error {
+	apps, err := r.db.Applications.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	keys := make(map[string]entry)
+	for id, app := range apps {
+		// Legacy plaintext keys are hashed into Keys the first time they are
+		// loaded, so they can be revoked by prefix like any other key
+		if HashPlaintext(&app) {
+			err := r.db.Applications.Update(ctx, id, func(stored *database.Application) error {
+				HashPlaintext(stored)
+				return nil
+			})
+			if err != nil {
+				// The key keeps working, hashing is retried on the next refresh
+				r.warnOnce(id, "Failed to hash plaintext API key", "app", id, "error", err)
+			} else {
+				r.logger.Infow("Hashed plaintext API key", "app", id)
+			}
+		}
+
+		for _, key := range app.Keys {
+			keys[key.Hash] = entry{appID: id, expires: key.Expires}
+		}
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.mu.Unlock()
+
+	r.logger.Infow("Loaded applications", "apps", len(apps), "keys", len(keys))
+
+	return nil
+}
+
+// warnOnce logs a warning for app the first time it is called
+func (r *Registry) warnOnce(app string, msg string, keysAndValues ...interface{}) {
+	r.mu.Lock()
+	warned := r.warned[app]
+	r.warned[app] = true
+	r.mu.Unlock()
+
+	if !warned {
+		r.logger.Warnw(msg, keysAndValues...)
+	}
+}
+
+// Lookup returns the ID of the application that owns key, if the key is valid
+func (r *Registry) Lookup(key string) (string, bool) {
+	r.mu.RLock()
+	e, ok := r.keys[Hash(key)]
+	r.mu.RUnlock()
+
+	if !ok {
+		return "", false
+	}
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		return "", false
+	}
+
+	return e.appID, true
+}
+
+// Generate returns a new random key along with its stored representation
+func Generate() (string, database.APIKey, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", database.APIKey{}, err
+	}
+
+	key := keyPrefix + hex.EncodeToString(b)
+
+	return key, database.APIKey{
+		Hash:    Hash(key),
+		Prefix:  key[:displayPrefixLen],
+		Created: time.Now(),
+	}, nil
+}
+
+// Hash returns the hex encoded SHA-256 of key
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Rotate adds a new key to app and expires its current keys after overlap
+func Rotate(app *database.Application, overlap time.Duration) (string, error) {
+	key, apiKey, err := Generate()
+	if err != nil {
+		return "", err
+	}
+
+	// The plaintext key is hashed so it can expire with the others
+	HashPlaintext(app)
+
+	var (
+		now     = time.Now()
+		expires = now.Add(overlap)
+		keys    = filterExpired(app.Keys, now)
+	)
+
+	for i, k := range keys {
+		if k.Expires.IsZero() || k.Expires.After(expires) {
+			keys[i].Expires = expires
+		}
+	}
+
+	app.Keys = append(keys, apiKey)
+
+	return key, nil
+}
+
+// HashPlaintext moves the legacy plaintext key of app into its hashed Keys,
+// with the key's first characters as its prefix. It reports whether app
+// changed.
+func HashPlaintext(app *database.Application) bool {
+	if app.APIKey == "" {
+		return false
+	}
+
+	app.Keys = append(app.Keys, database.APIKey{
+		Hash:   Hash(app.APIKey),
+		Prefix: app.APIKey[:minInt(len(app.APIKey), displayPrefixLen)],
+	})
+	app.APIKey = ""
+	return true
+}
+
+// Revoke expires the key with the given prefix immediately, or every key if
+// prefix is empty. It returns the number of keys revoked.
+func Revoke(app *database.Application, prefix string) int {
+	HashPlaintext(app)
+
+	var (
+		now     = time.Now()
+		revoked int
+		keys    []database.APIKey
+	)
+
+	for _, k := range app.Keys {
+		if prefix != "" && k.Prefix != prefix {
+			keys = append(keys, k)
+			continue
+		}
+		revoked++
+	}
+
+	// Expired keys are dropped rather than kept around
+	app.Keys = filterExpired(keys, now)
+
+	return revoked
+}
+
+func filterExpired(keys []database.APIKey, now time.Time) []database.APIKey {
+	filtered := []database.APIKey{}
+	for _, k := range keys {
+		if !k.Expires.IsZero() && now.After(k.Expires) {
+			continue
+		}
+		filtered = append(filtered, k)
+	}
+	return filtered
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,79 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+var (
+	// ErrInvalidSignature means the signature was not made by the claimed signer
+	ErrInvalidSignature = errors.New("invalid_signature")
+	// ErrMalformedSignature means the signature or address could not be decoded
+	ErrMalformedSignature = errors.New("malformed_signature")
+)
+
+type contextKey int
+
+const signerKey contextKey = iota
+
+// WithSigner returns a context carrying the verified signer address
+func WithSigner(ctx context.Context, address string) context.Context {
+	return context.WithValue(ctx, signerKey, strings.ToLower(address))
+}
+
+// Signer returns the lowercase address verified for the request, if any
+func Signer(ctx context.Context) (string, bool) {
+	address, ok := ctx.Value(signerKey).(string)
+	return address, ok && address != ""
+}
+
+func isInvalidSignature(err error) bool {
+	return errors.Is(err, ErrInvalidSignature)
+}
+
+// recoverHash checks that the 65 byte EOA signature sig of hash was made by from
+func recoverHash(from common.Address, sig, hash []byte) error {
+	if len(sig) != 65 {
+		return fmt.Errorf("%w: malformed signature", ErrInvalidSignature)
+	}
+
+	// https://github.com/ethereum/go-ethereum/blob/55599ee95d4151a2502465e0afc7c47bd1acba77/internal/ethapi/api.go#L442
+	if sig[64] != 27 && sig[64] != 28 {
+		return fmt.Errorf("%w: bad recovery id", ErrInvalidSignature)
+	}
+
+	// Copy so the caller's signature keeps its recovery id
+	rsv := make([]byte, 65)
+	copy(rsv, sig)
+	rsv[64] -= 27
+
+	pubKey, err := crypto.SigToPub(hash, rsv)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	if from != crypto.PubkeyToAddress(*pubKey) {
+		return fmt.Errorf("%w: signer mismatch", ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// https://github.com/ethereum/go-ethereum/blob/55599ee95d4151a2502465e0afc7c47bd1acba77/internal/ethapi/api.go#L404
+// SignHash is a helper function that calculates a hash for the given message that can be
+// safely used to calculate a signature from.
+//
+// The hash is calculated as
+//
+//	keccak256("\x19Ethereum Signed Message:\n"${message length}${message}).
+//
+// This gives context to the signed message and prevents signing of transactions.
+func SignHash(data []byte) []byte {
+	msg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(data), data)
+	return crypto.Keccak256([]byte(msg))
+}
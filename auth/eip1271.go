@@ -0,0 +1,193 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core/vm"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/infura"
+	"go.uber.org/zap"
+)
+
+const (
+	erc1271ABI = `[{"name":"isValidSignature","type":"function","stateMutability":"view","inputs":[{"name":"hash","type":"bytes32"},{"name":"signature","type":"bytes"}],"outputs":[{"name":"magicValue","type":"bytes4"}]}]`
+	// maxCachedResults bounds the verification cache
+	maxCachedResults = 10000
+)
+
+// erc1271MagicValue is bytes4(keccak256("isValidSignature(bytes32,bytes)"))
+var erc1271MagicValue = []byte{0x16, 0x26, 0xba, 0x7e}
+
+// Verifier checks signatures from both EOAs and EIP-1271 contract wallets
+// such as Safe. Contract results are cached briefly since every check is an
+// eth_call.
+type Verifier struct {
+	caller bind.ContractCaller
+	abi    abi.ABI
+	ttl    time.Duration
+	logger *zap.SugaredLogger
+
+	mu    sync.Mutex
+	cache map[string]cachedResult
+}
+
+type cachedResult struct {
+	err     error
+	expires time.Time
+}
+
+// ProvideVerifier provides a signature verifier backed by the infura client
+func ProvideVerifier(cfg config.Config, logger *zap.SugaredLogger, infuraClient *infura.InfuraClient) *Verifier {
+	return NewVerifier(infuraClient.Client, cfg.SignatureCacheTTL, logger)
+}
+
+var Options = ProvideVerifier
+
+// NewVerifier creates a Verifier that makes EIP-1271 calls through caller,
+// which can be an ethclient or go-ethereum's simulated backend
+func NewVerifier(caller bind.ContractCaller, ttl time.Duration, logger *zap.SugaredLogger) *Verifier {
+	parsed, err := abi.JSON(strings.NewReader(erc1271ABI))
+	if err != nil {
+		panic(err)
+	}
+
+	return &Verifier{
+		caller: caller,
+		abi:    parsed,
+		ttl:    ttl,
+		logger: logger,
+		cache:  make(map[string]cachedResult),
+	}
+}
+
+// Verify checks that sigHex is a personal_sign signature of msg by from
+func (v *Verifier) Verify(ctx context.Context, from, sigHex string, msg []byte) error {
+	return v.VerifyHash(ctx, from, sigHex, SignHash(msg))
+}
+
+// VerifyHash checks that sigHex is a signature of hash by from. It falls back
+// to isValidSignature when ecrecover does not yield from and from is a contract.
+func (v *Verifier) VerifyHash(ctx context.Context, from, sigHex string, hash []byte) error {
+	if !common.IsHexAddress(from) {
+		return fmt.Errorf("%w: bad address", ErrMalformedSignature)
+	}
+	fromAddr := common.HexToAddress(from)
+
+	sig, err := hexutil.Decode(sigHex)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrMalformedSignature, err)
+	}
+
+	eoaErr := recoverHash(fromAddr, sig, hash)
+	if eoaErr == nil {
+		return nil
+	}
+
+	key := fmt.Sprintf("%s:%x:%x", fromAddr.Hex(), hash, sig)
+	if err, ok := v.cached(key); ok {
+		return err
+	}
+
+	code, err := v.caller.CodeAt(ctx, fromAddr, nil)
+	if err != nil {
+		return err
+	}
+	if len(code) == 0 {
+		// Not a contract, so the ecrecover result stands
+		return eoaErr
+	}
+
+	err = v.isValidSignature(ctx, fromAddr, hash, sig)
+	if err != nil && !isInvalidSignature(err) {
+		// Node errors are not cached so the next request can retry
+		return err
+	}
+
+	v.store(key, err)
+
+	return err
+}
+
+func (v *Verifier) isValidSignature(ctx context.Context, wallet common.Address, hash, sig []byte) error {
+	var digest [32]byte
+	copy(digest[:], hash)
+
+	data, err := v.abi.Pack("isValidSignature", digest, sig)
+	if err != nil {
+		return err
+	}
+
+	out, err := v.caller.CallContract(ctx, ethereum.CallMsg{To: &wallet, Data: data}, nil)
+	if err != nil {
+		// A revert means the wallet rejected the signature, anything else
+		// is a problem talking to the node
+		if isRevert(err) {
+			return fmt.Errorf("%w: rejected by contract wallet", ErrInvalidSignature)
+		}
+		v.logger.Errorw("isValidSignature call failed", "wallet", wallet.Hex(), "error", err)
+		return err
+	}
+
+	if len(out) < 4 || !bytes.Equal(out[:4], erc1271MagicValue) {
+		return fmt.Errorf("%w: rejected by contract wallet", ErrInvalidSignature)
+	}
+
+	return nil
+}
+
+// isRevert reports whether an eth_call error means the contract reverted.
+// Reverts with data carry the EIP-1474 code 3, geth sends reverts without
+// data as a server error whose message is vm.ErrExecutionReverted.
+func isRevert(err error) bool {
+	if errors.Is(err, vm.ErrExecutionReverted) {
+		return true
+	}
+
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) {
+		return rpcErr.ErrorCode() == 3 || rpcErr.Error() == vm.ErrExecutionReverted.Error()
+	}
+	return false
+}
+
+func (v *Verifier) cached(key string) (error, bool) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	result, ok := v.cache[key]
+	if !ok || time.Now().After(result.expires) {
+		return nil, false
+	}
+	return result.err, true
+}
+
+func (v *Verifier) store(key string, err error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	now := time.Now()
+	if len(v.cache) >= maxCachedResults {
+		for k, result := range v.cache {
+			if now.After(result.expires) {
+				delete(v.cache, k)
+			}
+		}
+	}
+	if len(v.cache) >= maxCachedResults {
+		return
+	}
+
+	v.cache[key] = cachedResult{err: err, expires: now.Add(v.ttl)}
+}
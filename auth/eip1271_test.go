@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"go.uber.org/zap"
+)
+
+// Runtime code of mock EIP-1271 wallets, whatever the call they return the
+// magic value, return another bytes4, revert without data or revert with
+// Error(string)'s selector as data
+var (
+	magicWallet        = hexutil.MustDecode("0x7f1626ba7e0000000000000000000000000000000000000000000000000000000060005260206000f3")
+	wrongValueWallet   = hexutil.MustDecode("0x7fdeadbeef0000000000000000000000000000000000000000000000000000000060005260206000f3")
+	revertWallet       = hexutil.MustDecode("0x60006000fd")
+	revertReasonWallet = hexutil.MustDecode("0x7f08c379a00000000000000000000000000000000000000000000000000000000060005260046000fd")
+)
+
+var (
+	magicAddr        = common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	wrongValueAddr   = common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+	revertAddr       = common.HexToAddress("0x0000000000000000000000000000000000000c0c")
+	revertReasonAddr = common.HexToAddress("0x0000000000000000000000000000000000000d0d")
+)
+
+// countingCaller counts the isValidSignature calls made through it
+type countingCaller struct {
+	*backends.SimulatedBackend
+	calls int
+}
+
+func (c *countingCaller) CallContract(ctx context.Context, call ethereum.CallMsg, blockNumber *big.Int) ([]byte, error) {
+	c.calls++
+	return c.SimulatedBackend.CallContract(ctx, call, blockNumber)
+}
+
+func newTestVerifier(t *testing.T) (*Verifier, *countingCaller) {
+	t.Helper()
+
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{
+		magicAddr:        {Code: magicWallet, Balance: common.Big0},
+		wrongValueAddr:   {Code: wrongValueWallet, Balance: common.Big0},
+		revertAddr:       {Code: revertWallet, Balance: common.Big0},
+		revertReasonAddr: {Code: revertReasonWallet, Balance: common.Big0},
+	}, 8000000)
+	t.Cleanup(func() { sim.Close() })
+
+	caller := &countingCaller{SimulatedBackend: sim}
+	return NewVerifier(caller, time.Minute, zap.NewNop().Sugar()), caller
+}
+
+func testSign(t *testing.T, msg []byte) (common.Address, string) {
+	t.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(SignHash(msg), key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+
+	return crypto.PubkeyToAddress(key.PublicKey), hexutil.Encode(sig)
+}
+
+func TestVerify(t *testing.T) {
+	msg := []byte("hello")
+	signer, sig := testSign(t, msg)
+
+	tests := []struct {
+		name string
+		from common.Address
+		sig  string
+		want error
+	}{
+		{"eoa", signer, sig, nil},
+		{"eoa mismatch", common.HexToAddress("0x0000000000000000000000000000000000000bad"), sig, ErrInvalidSignature},
+		{"contract magic value", magicAddr, sig, nil},
+		{"contract short signature", magicAddr, "0x", nil},
+		{"contract wrong value", wrongValueAddr, sig, ErrInvalidSignature},
+		{"contract revert", revertAddr, sig, ErrInvalidSignature},
+		{"contract revert with data", revertReasonAddr, sig, ErrInvalidSignature},
+		{"garbage signature", magicAddr, "0xzz", ErrMalformedSignature},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, _ := newTestVerifier(t)
+
+			err := v.Verify(context.Background(), tt.from.Hex(), tt.sig, msg)
+			if tt.want == nil && err != nil {
+				t.Fatalf("Verify() = %v, want nil", err)
+			}
+			if tt.want != nil && !errors.Is(err, tt.want) {
+				t.Fatalf("Verify() = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyCachesContractResults(t *testing.T) {
+	var (
+		msg    = []byte("hello")
+		_, sig = testSign(t, msg)
+		v, c   = newTestVerifier(t)
+	)
+
+	for _, from := range []common.Address{magicAddr, revertAddr, magicAddr, revertAddr} {
+		v.Verify(context.Background(), from.Hex(), sig, msg)
+	}
+
+	if c.calls != 2 {
+		t.Fatalf("isValidSignature called %d times, want 2", c.calls)
+	}
+}
+
+// rpcError is a JSON-RPC error as the rpc client returns it
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (e rpcError) Error() string  { return e.msg }
+func (e rpcError) ErrorCode() int { return e.code }
+
+func TestIsRevert(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"revert with data", rpcError{3, "execution reverted: nope"}, true},
+		{"revert without data", rpcError{-32000, "execution reverted"}, true},
+		{"other server error", rpcError{-32000, "header not found"}, false},
+		{"rate limited", rpcError{-32005, "daily request count exceeded, request rate limited"}, false},
+		{"transport", errors.New("dial tcp: connection refused, not reverted"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isRevert(tt.err); got != tt.want {
+				t.Fatalf("isRevert(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
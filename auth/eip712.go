@@ -0,0 +1,113 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/common/math"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+)
+
+const (
+	// DomainName and DomainVersion identify keiko in the EIP-712 domain
+	DomainName    = "floor.report"
+	DomainVersion = "1"
+)
+
+// ErrExpiredSignature is returned for actions signed with an expiry that
+// passed
+var ErrExpiredSignature = errors.New("signature has expired")
+
+// Actions that can be authorized with an EIP-712 signature
+const (
+	ActionFollowCollection   = "follow_collection"
+	ActionUnfollowCollection = "unfollow_collection"
+	ActionUpdateSettings     = "update_settings"
+	ActionUpdateAvatar       = "update_avatar"
+	ActionUpdateUser         = "update_user"
+	ActionNewUser            = "new_user"
+	ActionLinkWallet         = "link_wallet"
+	ActionUnlinkWallet       = "unlink_wallet"
+	ActionFollowAddress      = "follow_address"
+	ActionUnfollowAddress    = "unfollow_address"
+)
+
+// Action is the struct a wallet signs to authorize one protected request
+type Action struct {
+	Action string
+	// Target is the collection slug or lowercase address being changed
+	Target string
+	Signer string
+	Expiry time.Time
+	// Nonce is single-use, so a captured signature cannot be replayed
+	Nonce string
+	// BodyHash is the keccak256 hash of the request body, so the signature
+	// covers the payload
+	BodyHash common.Hash
+}
+
+// BodyHash returns the keccak256 hash of a raw request body
+func BodyHash(body []byte) common.Hash {
+	return crypto.Keccak256Hash(body)
+}
+
+// ActionTypedData returns the EIP-712 typed data for action on chainID. The
+// server rebuilds it from the request so clients cannot pick what is verified.
+func ActionTypedData(action Action, chainID int64) apitypes.TypedData {
+	return apitypes.TypedData{
+		Types: apitypes.Types{
+			"EIP712Domain": {
+				{Name: "name", Type: "string"},
+				{Name: "version", Type: "string"},
+				{Name: "chainId", Type: "uint256"},
+			},
+			"Action": {
+				{Name: "action", Type: "string"},
+				{Name: "target", Type: "string"},
+				{Name: "signer", Type: "address"},
+				{Name: "expiry", Type: "uint256"},
+				{Name: "nonce", Type: "string"},
+				{Name: "bodyHash", Type: "bytes32"},
+			},
+		},
+		PrimaryType: "Action",
+		Domain: apitypes.TypedDataDomain{
+			Name:    DomainName,
+			Version: DomainVersion,
+			ChainId: math.NewHexOrDecimal256(chainID),
+		},
+		Message: apitypes.TypedDataMessage{
+			"action":   action.Action,
+			"target":   strings.ToLower(action.Target),
+			"signer":   strings.ToLower(action.Signer),
+			"expiry":   (*math.HexOrDecimal256)(big.NewInt(action.Expiry.Unix())),
+			"nonce":    action.Nonce,
+			"bodyHash": hexutil.Encode(action.BodyHash[:]),
+		},
+	}
+}
+
+// CheckExpiry checks that a signed action has not expired and does not
+// expire further than maxAge from now
+func CheckExpiry(expiry time.Time, maxAge time.Duration) error {
+	now := time.Now()
+	if now.After(expiry) {
+		return ErrExpiredSignature
+	}
+	if expiry.After(now.Add(maxAge)) {
+		return fmt.Errorf("expiry must be within %s", maxAge)
+	}
+	return nil
+}
+
+// ActionHash returns the EIP-712 digest that is signed for action
+func ActionHash(action Action, chainID int64) ([]byte, error) {
+	hash, _, err := apitypes.TypedDataAndHash(ActionTypedData(action, chainID))
+	return hash, err
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"bytes"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+// encodeAction is the EIP-712 digest of action, encoded by hand from the spec
+func encodeAction(action Action, chainID int64) []byte {
+	var (
+		str = func(s string) []byte { return crypto.Keccak256([]byte(s)) }
+		num = func(n int64) []byte { return common.LeftPadBytes(big.NewInt(n).Bytes(), 32) }
+	)
+
+	domain := crypto.Keccak256(
+		str("EIP712Domain(string name,string version,uint256 chainId)"),
+		str(DomainName),
+		str(DomainVersion),
+		num(chainID),
+	)
+	message := crypto.Keccak256(
+		str("Action(string action,string target,address signer,uint256 expiry,string nonce,bytes32 bodyHash)"),
+		str(action.Action),
+		str(action.Target),
+		common.LeftPadBytes(common.HexToAddress(action.Signer).Bytes(), 32),
+		num(action.Expiry.Unix()),
+		str(action.Nonce),
+		action.BodyHash.Bytes(),
+	)
+
+	return crypto.Keccak256([]byte{0x19, 0x01}, domain, message)
+}
+
+func TestActionHash(t *testing.T) {
+	var (
+		signer = "0x064dca21b1377d1655ac3ca3e95282d9494b5611"
+		expiry = time.Unix(1660000000, 0)
+		nonce  = "0123456789abcdef"
+		body   = BodyHash([]byte(`{"bio":"gm"}`))
+	)
+
+	tests := []struct {
+		name string
+		// signed is what the client signs, want what the digest is encoded from
+		signed  Action
+		want    Action
+		chainID int64
+	}{
+		{
+			name:    "follow collection",
+			signed:  Action{Action: ActionFollowCollection, Target: "cryptopunks", Signer: signer, Expiry: expiry, Nonce: nonce, BodyHash: BodyHash(nil)},
+			want:    Action{Action: ActionFollowCollection, Target: "cryptopunks", Signer: signer, Expiry: expiry, Nonce: nonce, BodyHash: BodyHash(nil)},
+			chainID: 1,
+		},
+		{
+			name:    "another chain",
+			signed:  Action{Action: ActionFollowCollection, Target: "cryptopunks", Signer: signer, Expiry: expiry, Nonce: nonce, BodyHash: BodyHash(nil)},
+			want:    Action{Action: ActionFollowCollection, Target: "cryptopunks", Signer: signer, Expiry: expiry, Nonce: nonce, BodyHash: BodyHash(nil)},
+			chainID: 137,
+		},
+		{
+			name:    "mixed case target and signer",
+			signed:  Action{Action: ActionFollowAddress, Target: "0xABCdef0000000000000000000000000000000001", Signer: "0x064DCA21B1377D1655AC3CA3E95282D9494B5611", Expiry: expiry, Nonce: nonce},
+			want:    Action{Action: ActionFollowAddress, Target: "0xabcdef0000000000000000000000000000000001", Signer: signer, Expiry: expiry, Nonce: nonce},
+			chainID: 1,
+		},
+		{
+			name:    "body",
+			signed:  Action{Action: ActionUpdateUser, Target: signer, Signer: signer, Expiry: expiry, Nonce: nonce, BodyHash: body},
+			want:    Action{Action: ActionUpdateUser, Target: signer, Signer: signer, Expiry: expiry, Nonce: nonce, BodyHash: body},
+			chainID: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ActionHash(tt.signed, tt.chainID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := encodeAction(tt.want, tt.chainID); !bytes.Equal(got, want) {
+				t.Fatalf("ActionHash() = %x, want %x", got, want)
+			}
+		})
+	}
+}
+
+func TestBodyHash(t *testing.T) {
+	// keccak256 of an empty input
+	if got := BodyHash(nil).Hex(); got != "0xc5d2460186f7233c927e7db2dcc703c0e500b653ca82273b7bfad8045d85a470" {
+		t.Fatalf("BodyHash(nil) = %s, want the hash of an empty body", got)
+	}
+}
+
+func TestCheckExpiry(t *testing.T) {
+	tests := []struct {
+		name    string
+		expiry  time.Time
+		wantErr bool
+	}{
+		{"within max age", time.Now().Add(time.Minute), false},
+		{"expired", time.Now().Add(-time.Minute), true},
+		{"beyond max age", time.Now().Add(time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := CheckExpiry(tt.expiry, 10*time.Minute); (err != nil) != tt.wantErr {
+				t.Fatalf("CheckExpiry() = %v, want an error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+// SignerRequirement is who has to sign a request to a route
+type SignerRequirement int
+
+const (
+	// NoSigner means the route does not need a signature
+	NoSigner SignerRequirement = iota
+	// AnySigner means any verified signer, handlers act on their behalf
+	AnySigner
+	// PathAddressSigner means the signer must be the {address} path variable
+	PathAddressSigner
+)
+
+// Policy is the access policy a route declares when it is registered
+type Policy struct {
+	APIKey bool
+	Admin  bool
+	Signer SignerRequirement
+	// Action and TargetVar describe the EIP-712 Action for signed routes,
+	// the target is the signer's own address when TargetVar is empty
+	Action    string
+	TargetVar string
+}
+
+var (
+	// PolicyPublic routes are open to anyone
+	PolicyPublic = Policy{}
+	// PolicyAPIKey routes need an application API key
+	PolicyAPIKey = Policy{APIKey: true}
+	// PolicyAdmin routes need the admin key
+	PolicyAdmin = Policy{Admin: true}
+)
+
+// PolicySigned routes need an API key and a signature from any address
+func PolicySigned(action, targetVar string) Policy {
+	return Policy{
+		APIKey:    true,
+		Signer:    AnySigner,
+		Action:    action,
+		TargetVar: targetVar,
+	}
+}
+
+// PolicyOwner routes need an API key and a signature from the {address} in the path
+func PolicyOwner(action string) Policy {
+	return PolicyOwnerOf(action, "address")
+}
+
+// PolicyOwnerOf routes need an API key and a signature from the {address} in
+// the path, for an action on the targetVar path variable
+func PolicyOwnerOf(action, targetVar string) Policy {
+	return Policy{
+		APIKey:    true,
+		Signer:    PathAddressSigner,
+		Action:    action,
+		TargetVar: targetVar,
+	}
+}
+
+type policyHandler struct {
+	http.HandlerFunc
+	policy Policy
+}
+
+// Protect attaches policy to a route handler so the router middleware can
+// enforce it
+func Protect(policy Policy, h http.HandlerFunc) http.Handler {
+	return policyHandler{h, policy}
+}
+
+// RoutePolicy returns the policy of the matched route. Routes registered
+// without Protect need an API key.
+func RoutePolicy(r *http.Request) Policy {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return PolicyAPIKey
+	}
+
+	if h, ok := route.GetHandler().(policyHandler); ok {
+		return h.policy
+	}
+
+	return PolicyAPIKey
+}
@@ -0,0 +1,181 @@
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"image"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+
+	// Registers the GIF decoder, only the first frame is kept
+	_ "image/gif"
+
+	"github.com/mager/keiko/config"
+)
+
+const (
+	// maxDimension bounds the width and height of an upload so decoding
+	// cannot exhaust memory
+	maxDimension = 4096
+	jpegQuality  = 85
+)
+
+var (
+	ErrTooLarge        = errors.New("image_too_large")
+	ErrUnsupportedType = errors.New("unsupported_image_type")
+	ErrInvalidImage    = errors.New("invalid_image")
+)
+
+// allowedTypes are the sniffed content types accepted for upload
+var allowedTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+}
+
+// Thumbnail is one square rendition of an avatar
+type Thumbnail struct {
+	Size        int
+	Data        []byte
+	ContentType string
+	Ext         string
+}
+
+// Processor validates uploaded images and renders their thumbnails
+type Processor struct {
+	maxBytes int64
+	sizes    []int
+}
+
+// ProvideProcessor provides an avatar Processor
+func ProvideProcessor(cfg config.Config) *Processor {
+	return NewProcessor(cfg.AvatarMaxBytes, cfg.AvatarSizes)
+}
+
+var Options = ProvideProcessor
+
+// NewProcessor creates a Processor that accepts images up to maxBytes and
+// renders a thumbnail for each of sizes
+func NewProcessor(maxBytes int64, sizes []int) *Processor {
+	return &Processor{maxBytes: maxBytes, sizes: sizes}
+}
+
+// MaxBytes is the largest upload the Processor accepts
+func (p *Processor) MaxBytes() int64 {
+	return p.maxBytes
+}
+
+// Process validates data and returns a square thumbnail for each configured
+// size. The image is decoded and re-encoded so EXIF and other metadata are
+// never stored.
+func (p *Processor) Process(data []byte) ([]Thumbnail, error) {
+	if int64(len(data)) > p.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	// Trust the bytes rather than the client's Content-Type
+	if !allowedTypes[http.DetectContentType(data)] {
+		return nil, ErrUnsupportedType
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+	if cfg.Width == 0 || cfg.Height == 0 {
+		return nil, ErrInvalidImage
+	}
+	if cfg.Width > maxDimension || cfg.Height > maxDimension {
+		return nil, ErrTooLarge
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidImage, err)
+	}
+
+	square := cropSquare(src)
+	opaque := square.Opaque()
+
+	thumbnails := make([]Thumbnail, 0, len(p.sizes))
+	for _, size := range p.sizes {
+		thumbnail, err := encode(resize(square, size), opaque)
+		if err != nil {
+			return nil, err
+		}
+		thumbnail.Size = size
+		thumbnails = append(thumbnails, thumbnail)
+	}
+
+	return thumbnails, nil
+}
+
+// cropSquare copies the centered square of src into an RGBA image
+func cropSquare(src image.Image) *image.RGBA {
+	b := src.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+
+	origin := image.Pt(b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2)
+	dst := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(dst, dst.Bounds(), src, origin, draw.Src)
+
+	return dst
+}
+
+// resize scales the square src down to size with a box filter. Images
+// smaller than size are left as they are.
+func resize(src *image.RGBA, size int) *image.RGBA {
+	side := src.Bounds().Dx()
+	if size >= side {
+		return src
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		y0, y1 := y*side/size, (y+1)*side/size
+		for x := 0; x < size; x++ {
+			x0, x1 := x*side/size, (x+1)*side/size
+
+			var sum [4]int
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					for c := 0; c < 4; c++ {
+						sum[c] += int(row[sx*4+c])
+					}
+				}
+			}
+
+			n := (y1 - y0) * (x1 - x0)
+			i := y*dst.Stride + x*4
+			for c := 0; c < 4; c++ {
+				dst.Pix[i+c] = uint8(sum[c] / n)
+			}
+		}
+	}
+
+	return dst
+}
+
+// encode writes img as JPEG when it is opaque and as PNG otherwise, to keep
+// transparency
+func encode(img image.Image, opaque bool) (Thumbnail, error) {
+	var (
+		buf bytes.Buffer
+		err error
+	)
+
+	if opaque {
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+		return Thumbnail{Data: buf.Bytes(), ContentType: "image/jpeg", Ext: "jpg"}, err
+	}
+
+	err = png.Encode(&buf, img)
+	return Thumbnail{Data: buf.Bytes(), ContentType: "image/png", Ext: "png"}, err
+}
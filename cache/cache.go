@@ -0,0 +1,294 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/mager/keiko/config"
+	"go.uber.org/zap"
+)
+
+// fetchTimeout bounds a fetch, which runs detached from the callers waiting
+// on it
+const fetchTimeout = 30 * time.Second
+
+// ErrNotFound is returned by fetch functions for lookups that have no
+// result. It is cached for the NegativeTTL so misses are not retried on
+// every request.
+var ErrNotFound = errors.New("not_found")
+
+// Policy is how long a group keeps its results
+type Policy struct {
+	TTL time.Duration
+	// NegativeTTL is how long an ErrNotFound is cached, zero disables it
+	NegativeTTL time.Duration
+	// StaleTTL is how long after expiring a value is still served when the
+	// upstream fails
+	StaleTTL time.Duration
+}
+
+// Stats are the counters of a group
+type Stats struct {
+	Hits      int64 `json:"hits"`
+	Misses    int64 `json:"misses"`
+	Negatives int64 `json:"negatives"`
+	Stale     int64 `json:"stale"`
+	// Coalesced counts calls that waited on an identical call in flight
+	// instead of going upstream
+	Coalesced int64 `json:"coalesced"`
+	Errors    int64 `json:"errors"`
+}
+
+// Cache is an in-memory TTL cache shared by the upstream clients. Each
+// client works in its own Group.
+type Cache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[string]*entry
+	flights map[string]*flight
+	groups  map[string]*Group
+}
+
+type entry struct {
+	value      interface{}
+	err        error
+	expires    time.Time
+	staleUntil time.Time
+}
+
+type flight struct {
+	done  chan struct{}
+	value interface{}
+	err   error
+}
+
+// ProvideCache provides the shared cache
+func ProvideCache(cfg config.Config, logger *zap.SugaredLogger) *Cache {
+	logger.Infow("Using in-memory cache", "maxEntries", cfg.CacheMaxEntries)
+	return New(cfg.CacheMaxEntries)
+}
+
+var Options = ProvideCache
+
+// New creates a Cache holding at most maxEntries results
+func New(maxEntries int) *Cache {
+	return &Cache{
+		maxEntries: maxEntries,
+		entries:    make(map[string]*entry),
+		flights:    make(map[string]*flight),
+		groups:     make(map[string]*Group),
+	}
+}
+
+// Group returns the named group, creating it with policy the first time
+func (c *Cache) Group(name string, policy Policy) *Group {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if g, ok := c.groups[name]; ok {
+		return g
+	}
+
+	g := &Group{cache: c, name: name, policy: policy}
+	c.groups[name] = g
+	return g
+}
+
+// GroupStats is the name and counters of a group
+type GroupStats struct {
+	Name string `json:"name"`
+	Stats
+}
+
+// Stats returns the counters of every group, sorted by name
+func (c *Cache) Stats() []GroupStats {
+	c.mu.Lock()
+	groups := make([]*Group, 0, len(c.groups))
+	for _, g := range c.groups {
+		groups = append(groups, g)
+	}
+	c.mu.Unlock()
+
+	stats := make([]GroupStats, 0, len(groups))
+	for _, g := range groups {
+		stats = append(stats, GroupStats{Name: g.name, Stats: g.Stats()})
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Name < stats[j].Name
+	})
+
+	return stats
+}
+
+// Len returns the number of cached results
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return len(c.entries)
+}
+
+// set stores a result, making room by dropping expired entries first
+func (c *Cache) set(key string, e *entry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[key]; !ok && len(c.entries) >= c.maxEntries {
+		now := time.Now()
+		for k, old := range c.entries {
+			if now.After(old.staleUntil) {
+				delete(c.entries, k)
+			}
+		}
+		// Still full, drop whatever comes first
+		for k := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, k)
+		}
+	}
+
+	c.entries[key] = e
+}
+
+// Group is a namespace of the cache with its own policy and counters
+type Group struct {
+	cache  *Cache
+	name   string
+	policy Policy
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Get returns the cached result for key, or calls fetch to get it. Concurrent
+// calls for the same key share a single fetch, which gets its own context so
+// one caller going away does not fail the others.
+func (g *Group) Get(ctx context.Context, key string, fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	return g.GetTTL(ctx, key, 0, fetch)
+}
+
+// GetTTL is Get with a TTL for this key instead of the group's, a zero ttl
+// uses the group's
+func (g *Group) GetTTL(ctx context.Context, key string, ttl time.Duration, fetch func(ctx context.Context) (interface{}, error)) (interface{}, error) {
+	// A zero Group, e.g. from a client built without a cache, does not cache
+	if g == nil {
+		return fetch(ctx)
+	}
+
+	if ttl == 0 {
+		ttl = g.policy.TTL
+	}
+	key = g.name + ":" + key
+	c := g.cache
+
+	c.mu.Lock()
+	e, ok := c.entries[key]
+	if ok && time.Now().Before(e.expires) {
+		c.mu.Unlock()
+		if e.err != nil {
+			g.count(func(s *Stats) { s.Negatives++ })
+		} else {
+			g.count(func(s *Stats) { s.Hits++ })
+		}
+		return e.value, e.err
+	}
+
+	f, inFlight := c.flights[key]
+	if !inFlight {
+		f = &flight{done: make(chan struct{})}
+		c.flights[key] = f
+	}
+	c.mu.Unlock()
+
+	if inFlight {
+		g.count(func(s *Stats) { s.Coalesced++ })
+	} else {
+		g.count(func(s *Stats) { s.Misses++ })
+		// The fetch is not tied to ctx, other callers may be waiting on it
+		go g.fill(key, ttl, e, f, fetch)
+	}
+
+	select {
+	case <-f.done:
+		return f.value, f.err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// fill runs fetch for a flight and stores its result. stale is the expired
+// entry for key, if any, which is served when fetch fails.
+func (g *Group) fill(key string, ttl time.Duration, stale *entry, f *flight, fetch func(ctx context.Context) (interface{}, error)) {
+	c := g.cache
+	defer func() {
+		c.mu.Lock()
+		delete(c.flights, key)
+		c.mu.Unlock()
+		close(f.done)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), fetchTimeout)
+	defer cancel()
+
+	value, err := safeFetch(ctx, fetch)
+	now := time.Now()
+
+	switch {
+	case err == nil:
+		c.set(key, &entry{
+			value:      value,
+			expires:    now.Add(ttl),
+			staleUntil: now.Add(ttl + g.policy.StaleTTL),
+		})
+		f.value = value
+	case errors.Is(err, ErrNotFound):
+		if g.policy.NegativeTTL > 0 {
+			c.set(key, &entry{
+				value:      value,
+				err:        err,
+				expires:    now.Add(g.policy.NegativeTTL),
+				staleUntil: now.Add(g.policy.NegativeTTL),
+			})
+		}
+		f.value, f.err = value, err
+	case stale != nil && stale.err == nil && now.Before(stale.staleUntil):
+		g.count(func(s *Stats) { s.Stale++ })
+		f.value = stale.value
+	default:
+		g.count(func(s *Stats) { s.Errors++ })
+		f.value, f.err = value, err
+	}
+}
+
+// safeFetch calls fetch, turning a panic into an error since nothing above
+// the fill goroutine would recover it
+func safeFetch(ctx context.Context, fetch func(ctx context.Context) (interface{}, error)) (value interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			value, err = nil, fmt.Errorf("cache: fetch panicked: %v", r)
+		}
+	}()
+
+	return fetch(ctx)
+}
+
+// Stats returns the group's counters
+func (g *Group) Stats() Stats {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.stats
+}
+
+func (g *Group) count(f func(*Stats)) {
+	g.mu.Lock()
+	f(&g.stats)
+	g.mu.Unlock()
+}
@@ -0,0 +1,183 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestGetCoalesces(t *testing.T) {
+	var (
+		g       = New(10).Group("test", Policy{TTL: time.Minute})
+		calls   int32
+		release = make(chan struct{})
+		wg      sync.WaitGroup
+	)
+
+	fetch := func(ctx context.Context) (interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return "value", nil
+	}
+
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			v, err := g.Get(context.Background(), "key", fetch)
+			if err != nil || v != "value" {
+				t.Errorf("Get() = %v, %v, want value", v, err)
+			}
+		}()
+	}
+
+	// Let every caller join the flight before it lands
+	for g.Stats().Misses+g.Stats().Coalesced < 5 {
+		time.Sleep(time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if calls != 1 {
+		t.Fatalf("fetch called %d times, want 1", calls)
+	}
+	if s := g.Stats(); s.Misses != 1 || s.Coalesced != 4 {
+		t.Fatalf("Stats() = %+v, want 1 miss and 4 coalesced", s)
+	}
+
+	// The result is now cached
+	if _, err := g.Get(context.Background(), "key", fetch); err != nil || calls != 1 {
+		t.Fatalf("cached Get() = %v with %d calls, want a hit", err, calls)
+	}
+}
+
+func TestGetPolicies(t *testing.T) {
+	var (
+		errUpstream = errors.New("upstream down")
+		notFound    = func(ctx context.Context) (interface{}, error) { return nil, ErrNotFound }
+		failing     = func(ctx context.Context) (interface{}, error) { return nil, errUpstream }
+		ok          = func(ctx context.Context) (interface{}, error) { return "fresh", nil }
+	)
+
+	tests := []struct {
+		name    string
+		policy  Policy
+		fetches []func(ctx context.Context) (interface{}, error)
+		// wait is slept between the fetches
+		wait    time.Duration
+		want    interface{}
+		wantErr error
+	}{
+		{
+			name:    "negative result is cached",
+			policy:  Policy{TTL: time.Minute, NegativeTTL: time.Minute},
+			fetches: []func(ctx context.Context) (interface{}, error){notFound, ok},
+			wantErr: ErrNotFound,
+		},
+		{
+			name:    "negative caching disabled",
+			policy:  Policy{TTL: time.Minute},
+			fetches: []func(ctx context.Context) (interface{}, error){notFound, ok},
+			want:    "fresh",
+		},
+		{
+			name:    "stale value served while upstream fails",
+			policy:  Policy{TTL: time.Millisecond, StaleTTL: time.Minute},
+			fetches: []func(ctx context.Context) (interface{}, error){ok, failing},
+			wait:    5 * time.Millisecond,
+			want:    "fresh",
+		},
+		{
+			name:    "error once stale window passed",
+			policy:  Policy{TTL: time.Millisecond, StaleTTL: time.Millisecond},
+			fetches: []func(ctx context.Context) (interface{}, error){ok, failing},
+			wait:    5 * time.Millisecond,
+			wantErr: errUpstream,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			g := New(10).Group("test", tt.policy)
+
+			var (
+				v   interface{}
+				err error
+			)
+			for i, fetch := range tt.fetches {
+				if i > 0 {
+					time.Sleep(tt.wait)
+				}
+				v, err = g.Get(context.Background(), "key", fetch)
+			}
+
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && v != tt.want) {
+				t.Fatalf("Get() = %v, %v, want %v, %v", v, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestGetRecoversPanics(t *testing.T) {
+	g := New(10).Group("test", Policy{TTL: time.Minute})
+
+	_, err := g.Get(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		panic("bad decoder")
+	})
+	if err == nil {
+		t.Fatal("Get() returned no error for a panicking fetch")
+	}
+
+	// The flight is cleared so the next call fetches again
+	v, err := g.Get(context.Background(), "key", func(ctx context.Context) (interface{}, error) {
+		return "value", nil
+	})
+	if err != nil || v != "value" {
+		t.Fatalf("Get() = %v, %v after a panic, want value", v, err)
+	}
+}
+
+func TestGetDetachesFetchFromCaller(t *testing.T) {
+	var (
+		g       = New(10).Group("test", Policy{TTL: time.Minute})
+		started = make(chan struct{})
+		release = make(chan struct{})
+		result  = make(chan error, 1)
+	)
+
+	fetch := func(ctx context.Context) (interface{}, error) {
+		close(started)
+		<-release
+		return "value", ctx.Err()
+	}
+
+	// The first caller gives up while the fetch is running
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := g.Get(ctx, "key", fetch)
+		result <- err
+	}()
+	<-started
+
+	waiter := make(chan interface{}, 1)
+	go func() {
+		v, _ := g.Get(context.Background(), "key", fetch)
+		waiter <- v
+	}()
+	for g.Stats().Coalesced < 1 {
+		time.Sleep(time.Millisecond)
+	}
+
+	cancel()
+	if err := <-result; !errors.Is(err, context.Canceled) {
+		t.Fatalf("canceled Get() = %v, want context.Canceled", err)
+	}
+	close(release)
+
+	if v := <-waiter; v != "value" {
+		t.Fatalf("coalesced Get() = %v, want value", v)
+	}
+}
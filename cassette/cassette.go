@@ -0,0 +1,310 @@
+package cassette
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/mager/keiko/config"
+)
+
+const (
+	// ModeRecord sends requests upstream and saves them with their responses
+	ModeRecord = "record"
+	// ModeReplay serves saved responses and never calls upstream
+	ModeReplay = "replay"
+)
+
+// redacted replaces API keys in saved requests
+const redacted = "REDACTED"
+
+// keyParams are the query parameters upstreams take API keys in
+var keyParams = []string{"apikey", "api_key", "key"}
+
+// Interaction is a request to an upstream and its response
+type Interaction struct {
+	Request  Request  `json:"request"`
+	Response Response `json:"response"`
+}
+
+type Request struct {
+	Method string `json:"method"`
+	URL    string `json:"url"`
+	Body   string `json:"body,omitempty"`
+}
+
+type Response struct {
+	Status int         `json:"status"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body"`
+}
+
+// Cassette is an http.RoundTripper that records the interactions with one
+// upstream to a file, or replays them from it
+type Cassette struct {
+	path    string
+	mode    string
+	secrets []string
+	base    http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []Interaction
+	// index holds the interactions of each request key in order, played
+	// counts how many were replayed so repeated requests are answered in turn
+	index  map[string][]int
+	played map[string]int
+}
+
+// Transport returns base wrapped in the cassette of upstream when
+// cfg.HTTPMode is record or replay, and base otherwise. A nil base is
+// http.DefaultTransport. Recording starts a new cassette.
+func Transport(cfg config.Config, upstream string, base http.RoundTripper) (http.RoundTripper, error) {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	switch cfg.HTTPMode {
+	case "":
+		return base, nil
+	case ModeRecord, ModeReplay:
+	default:
+		return nil, fmt.Errorf("unknown HTTP mode %q", cfg.HTTPMode)
+	}
+
+	c := &Cassette{
+		path:   filepath.Join(cfg.CassetteDir, upstream+".json"),
+		mode:   cfg.HTTPMode,
+		base:   base,
+		index:  make(map[string][]int),
+		played: make(map[string]int),
+	}
+	for _, secret := range []string{cfg.OpenSeaAPIKey, cfg.EtherscanAPIKey, cfg.InfuraKey} {
+		if secret != "" {
+			c.secrets = append(c.secrets, secret)
+		}
+	}
+
+	if c.mode == ModeReplay {
+		if err := c.load(); err != nil {
+			return nil, err
+		}
+	}
+
+	return c, nil
+}
+
+// RoundTrip records or replays req
+func (c *Cassette) RoundTrip(req *http.Request) (*http.Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	request := Request{
+		Method: req.Method,
+		URL:    c.redact(normalizeURL(req.URL)),
+		Body:   c.redact(string(body)),
+	}
+
+	if c.mode == ModeReplay {
+		return c.replay(req, request)
+	}
+
+	out := req.Clone(req.Context())
+	out.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp, err := c.base.RoundTrip(out)
+	if err != nil {
+		return nil, err
+	}
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(respBody))
+
+	header := resp.Header.Clone()
+	header.Del("Set-Cookie")
+	err = c.record(Interaction{
+		Request: request,
+		Response: Response{
+			Status: resp.StatusCode,
+			Header: header,
+			Body:   string(respBody),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("cassette: %w", err)
+	}
+
+	return resp, nil
+}
+
+func (c *Cassette) replay(req *http.Request, request Request) (*http.Response, error) {
+	key := requestKey(request)
+
+	c.mu.Lock()
+	matches := c.index[key]
+	if len(matches) == 0 {
+		c.mu.Unlock()
+		return nil, fmt.Errorf("cassette %s: no recorded response for %s %s", filepath.Base(c.path), request.Method, request.URL)
+	}
+	n := c.played[key]
+	if n >= len(matches) {
+		n = len(matches) - 1
+	}
+	c.played[key]++
+	recorded := c.interactions[matches[n]].Response
+	c.mu.Unlock()
+
+	body := []byte(recorded.Body)
+	if id, ok := rpcID(request.Body); ok {
+		body = withRPCID(body, id)
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", recorded.Status, http.StatusText(recorded.Status)),
+		StatusCode:    recorded.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        recorded.Header.Clone(),
+		Body:          ioutil.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+// record adds the interaction and rewrites the cassette file
+func (c *Cassette) record(interaction Interaction) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.interactions = append(c.interactions, interaction)
+
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c.interactions); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(c.path), 0755); err != nil {
+		return err
+	}
+	tmp := c.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data.Bytes(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, c.path)
+}
+
+func (c *Cassette) load() error {
+	data, err := ioutil.ReadFile(c.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, &c.interactions); err != nil {
+		return fmt.Errorf("cassette %s: %w", c.path, err)
+	}
+	for i, interaction := range c.interactions {
+		key := requestKey(interaction.Request)
+		c.index[key] = append(c.index[key], i)
+	}
+
+	return nil
+}
+
+// normalizeURL replaces the API key of u whether it is configured or not, so
+// a cassette recorded with a key replays with another one or none
+func normalizeURL(u *url.URL) string {
+	n := *u
+
+	q := n.Query()
+	for _, param := range keyParams {
+		if _, ok := q[param]; ok {
+			q.Set(param, redacted)
+		}
+	}
+	n.RawQuery = q.Encode()
+
+	// Infura takes the key as the last path segment, and is called
+	// without one when no key is set
+	if strings.HasSuffix(n.Host, ".infura.io") && (n.Path == "/v3" || strings.HasPrefix(n.Path, "/v3/")) {
+		n.Path = "/v3/" + redacted
+		n.RawPath = ""
+	}
+
+	return n.String()
+}
+
+func (c *Cassette) redact(s string) string {
+	for _, secret := range c.secrets {
+		s = strings.ReplaceAll(s, secret, redacted)
+	}
+	return s
+}
+
+// requestKey is what a replayed request is matched on. JSON-RPC IDs count up
+// per client, so they are left out.
+func requestKey(r Request) string {
+	body := r.Body
+	if _, ok := rpcID(body); ok {
+		var msg map[string]json.RawMessage
+		json.Unmarshal([]byte(body), &msg)
+		delete(msg, "id")
+		normalized, _ := json.Marshal(msg)
+		body = string(normalized)
+	}
+
+	return r.Method + " " + r.URL + " " + body
+}
+
+// rpcID returns the ID of a JSON-RPC request
+func rpcID(body string) (json.RawMessage, bool) {
+	if !strings.HasPrefix(strings.TrimSpace(body), "{") {
+		return nil, false
+	}
+
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(body), &msg); err != nil {
+		return nil, false
+	}
+	if _, ok := msg["jsonrpc"]; !ok {
+		return nil, false
+	}
+	return msg["id"], true
+}
+
+// withRPCID sets the ID of a recorded JSON-RPC response to the ID of the
+// request it is replayed for
+func withRPCID(body []byte, id json.RawMessage) []byte {
+	var msg map[string]json.RawMessage
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return body
+	}
+	msg["id"] = id
+
+	out, err := json.Marshal(msg)
+	if err != nil {
+		return body
+	}
+	return out
+}
@@ -0,0 +1,135 @@
+package cassette
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mager/keiko/config"
+)
+
+// roundTripFunc answers requests in record mode instead of an upstream
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestNormalizeURL(t *testing.T) {
+	tests := []struct {
+		name string
+		url  string
+		want string
+	}{
+		{"etherscan key", "https://api.etherscan.io/api?module=account&apikey=s3cret", "https://api.etherscan.io/api?apikey=REDACTED&module=account"},
+		{"empty etherscan key", "https://api.etherscan.io/api?apikey=&module=account", "https://api.etherscan.io/api?apikey=REDACTED&module=account"},
+		{"other key params", "https://example.com/?api_key=a&key=b", "https://example.com/?api_key=REDACTED&key=REDACTED"},
+		{"no key", "https://api.opensea.io/api/v2/collections/doodles", "https://api.opensea.io/api/v2/collections/doodles"},
+		{"infura key", "https://mainnet.infura.io/v3/s3cret", "https://mainnet.infura.io/v3/REDACTED"},
+		{"infura without key", "https://polygon-mainnet.infura.io/v3", "https://polygon-mainnet.infura.io/v3/REDACTED"},
+		{"other v3 host", "https://rpc.example.com/v3/abc", "https://rpc.example.com/v3/abc"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			u, err := url.Parse(tt.url)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := normalizeURL(u); got != tt.want {
+				t.Fatalf("normalizeURL(%s) = %s, want %s", tt.url, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplayWithoutKeys(t *testing.T) {
+	var (
+		dir      = t.TempDir()
+		requests = []struct {
+			method, url, body string
+		}{
+			{"GET", "https://api.etherscan.io/api?module=account&apikey=%s", ""},
+			{"POST", "https://mainnet.infura.io/v3/%s", `{"jsonrpc":"2.0","id":1,"method":"eth_blockNumber","params":[]}`},
+		}
+	)
+
+	send := func(t *testing.T, tr http.RoundTripper, key string) []string {
+		t.Helper()
+
+		var bodies []string
+		for _, r := range requests {
+			u := strings.Replace(r.url, "%s", key, 1)
+			if key == "" {
+				u = strings.TrimSuffix(u, "/")
+			}
+			req, err := http.NewRequest(r.method, u, strings.NewReader(r.body))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp, err := tr.RoundTrip(req)
+			if err != nil {
+				t.Fatalf("%s %s: %v", r.method, u, err)
+			}
+			var body struct {
+				Result string `json:"result"`
+			}
+			if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+			bodies = append(bodies, body.Result)
+		}
+		return bodies
+	}
+
+	upstream := roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{},
+			Body:       ioutil.NopCloser(strings.NewReader(`{"jsonrpc":"2.0","id":1,"result":"` + req.URL.Host + `"}`)),
+		}, nil
+	})
+	record, err := Transport(config.Config{
+		HTTPMode:        ModeRecord,
+		CassetteDir:     dir,
+		EtherscanAPIKey: "s3cret",
+		InfuraKey:       "s3cret",
+	}, "test", upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := send(t, record, "s3cret")
+
+	saved, err := ioutil.ReadFile(filepath.Join(dir, "test.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(saved), "s3cret") {
+		t.Fatalf("cassette contains the API key:\n%s", saved)
+	}
+
+	for _, key := range []string{"", "other"} {
+		t.Run("key "+key, func(t *testing.T) {
+			replay, err := Transport(config.Config{
+				HTTPMode:        ModeReplay,
+				CassetteDir:     dir,
+				EtherscanAPIKey: key,
+				InfuraKey:       key,
+			}, "test", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := send(t, replay, key)
+			for i := range want {
+				if got[i] != want[i] {
+					t.Fatalf("replayed %s, want %s", got[i], want[i])
+				}
+			}
+		})
+	}
+}
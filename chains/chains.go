@@ -0,0 +1,87 @@
+package chains
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+// Ethereum is the chain every portfolio starts from
+const Ethereum = "ethereum"
+
+// Chain is an EVM chain portfolios can be read from
+type Chain struct {
+	// Name is how the chain is named in config and requests
+	Name string
+	// ID is the EIP-155 chain ID
+	ID int64
+	// OpenSeaChain is the chain in OpenSea v2 routes
+	OpenSeaChain string
+	// NativeSymbol is the token gas is paid in, and CoinstatsID where its
+	// price is read from when it is not ETH
+	NativeSymbol string
+	CoinstatsID  string
+	// InfuraNetwork is the subdomain of the chain's Infura endpoint
+	InfuraNetwork string
+}
+
+// Known are the chains that can be enabled
+var Known = []Chain{
+	{Name: Ethereum, ID: 1, OpenSeaChain: "ethereum", NativeSymbol: "ETH", InfuraNetwork: "mainnet"},
+	{Name: "polygon", ID: 137, OpenSeaChain: "matic", NativeSymbol: "MATIC", CoinstatsID: "matic-network", InfuraNetwork: "polygon-mainnet"},
+	{Name: "base", ID: 8453, OpenSeaChain: "base", NativeSymbol: "ETH", InfuraNetwork: "base-mainnet"},
+	{Name: "arbitrum", ID: 42161, OpenSeaChain: "arbitrum", NativeSymbol: "ETH", InfuraNetwork: "arbitrum-mainnet"},
+	{Name: "optimism", ID: 10, OpenSeaChain: "optimism", NativeSymbol: "ETH", InfuraNetwork: "optimism-mainnet"},
+}
+
+// Lookup returns the known chain named name, or with name as its OpenSea
+// chain or chain ID
+func Lookup(name string) (Chain, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for _, c := range Known {
+		if c.Name == name || c.OpenSeaChain == name || strconv.FormatInt(c.ID, 10) == name {
+			return c, true
+		}
+	}
+	return Chain{}, false
+}
+
+// ParseAddress splits a chain-aware address, either chain:address such as
+// polygon:0x… or CAIP-10 such as eip155:137:0x…, into its chain and address.
+// Anything without a chain, like a bare address or an ENS name, is returned
+// as is with an empty chain.
+func ParseAddress(s string) (string, string, error) {
+	parts := strings.Split(s, ":")
+	switch {
+	case len(parts) == 1:
+		return "", s, nil
+	case len(parts) == 3 && strings.EqualFold(parts[0], "eip155"):
+		parts = parts[1:]
+	case len(parts) != 2:
+		return "", "", fmt.Errorf("invalid chain address %q", s)
+	}
+
+	c, ok := Lookup(parts[0])
+	if !ok {
+		return "", "", fmt.Errorf("unknown chain %q", parts[0])
+	}
+	if !common.IsHexAddress(parts[1]) {
+		return "", "", fmt.Errorf("invalid address %q", parts[1])
+	}
+	return c.Name, parts[1], nil
+}
+
+// PriceSymbol is the token symbol is priced as, wrapped tokens are priced as
+// the token they wrap
+func PriceSymbol(symbol string) string {
+	symbol = strings.ToUpper(symbol)
+	switch symbol {
+	case "WETH":
+		return "ETH"
+	case "WMATIC", "POL":
+		return "MATIC"
+	}
+	return symbol
+}
@@ -0,0 +1,238 @@
+package chains
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/cassette"
+	"github.com/mager/keiko/coinstats"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/infura"
+	"github.com/mager/keiko/opensea"
+	"github.com/mager/keiko/oracle"
+	"go.uber.org/zap"
+)
+
+// ErrUnpricedToken is returned for tokens there is no price source for
+var ErrUnpricedToken = errors.New("unpriced_token")
+
+// weiPerETH converts native balances, every known chain has 18 decimals
+var weiPerETH = new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(18), nil))
+
+// Client reads one chain through its RPC endpoint and OpenSea
+type Client struct {
+	Chain
+	RPC     *ethclient.Client
+	OpenSea *opensea.OpenSeaClient
+	cache   *cache.Group
+	// balances caches the native balances read from RPC
+	balances *cache.Group
+}
+
+// NewClient creates a Client for chain, collections are cached in group and
+// native balances in balances
+func NewClient(chain Chain, rpcClient *ethclient.Client, os *opensea.OpenSeaClient, group, balances *cache.Group) *Client {
+	return &Client{
+		Chain:    chain,
+		RPC:      rpcClient,
+		OpenSea:  os,
+		cache:    group,
+		balances: balances,
+	}
+}
+
+// Collections returns the visible collections address holds on the chain,
+// cached for the OpenSeaTTL
+func (c *Client) Collections(ctx context.Context, address string) ([]opensea.OpenSeaCollectionV2, error) {
+	address = strings.ToLower(address)
+
+	v, err := c.cache.Get(ctx, c.Name+":"+address, func(ctx context.Context) (interface{}, error) {
+		return c.OpenSea.GetAllCollectionsForAddressOnChain(ctx, c.OpenSeaChain, address)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return v.([]opensea.OpenSeaCollectionV2), nil
+}
+
+// Balance returns the native token balance of address, in NativeSymbol,
+// cached for the BalanceTTL
+func (c *Client) Balance(ctx context.Context, address string) (float64, error) {
+	address = strings.ToLower(address)
+
+	v, err := c.balances.Get(ctx, c.Name+":"+address, func(ctx context.Context) (interface{}, error) {
+		wei, err := c.RPC.BalanceAt(ctx, common.HexToAddress(address), nil)
+		if err != nil {
+			return nil, apierror.Unreachable(c.Name, err)
+		}
+
+		balance, _ := new(big.Float).Quo(new(big.Float).SetInt(wei), weiPerETH).Float64()
+		return balance, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return v.(float64), nil
+}
+
+// Registry holds a Client per enabled chain, in the order of the Chains
+// config, and prices their tokens
+type Registry struct {
+	clients []*Client
+	prices  *oracle.Oracle
+	cs      coinstats.CoinstatsClient
+	logger  *zap.SugaredLogger
+}
+
+// ProvideRegistry provides a Registry of the Chains. Ethereum reuses the
+// Infura client, the others dial their own endpoint. Every chain shares the
+// OpenSea client, so they share its rate limit.
+func ProvideRegistry(
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	c *cache.Cache,
+	infuraClient *infura.InfuraClient,
+	os *opensea.OpenSeaClient,
+	prices *oracle.Oracle,
+	cs coinstats.CoinstatsClient,
+) *Registry {
+	endpoints := make(map[string]string)
+	for _, pair := range cfg.ChainRPCURLs {
+		kv := strings.SplitN(pair, "=", 2)
+		chain, ok := Lookup(kv[0])
+		if len(kv) != 2 || !ok {
+			logger.Fatalw("Invalid chain RPC URL, use chain=url", "value", pair)
+		}
+		endpoints[chain.Name] = kv[1]
+	}
+
+	group := c.Group("chaincollections", cache.Policy{
+		TTL:         cfg.OpenSeaTTL,
+		NegativeTTL: cfg.CacheNegativeTTL,
+		StaleTTL:    cfg.CacheStaleTTL,
+	})
+	balances := c.Group("chainbalances", cache.Policy{
+		TTL:      cfg.BalanceTTL,
+		StaleTTL: cfg.CacheStaleTTL,
+	})
+
+	var (
+		clients []*Client
+		enabled = make(map[string]bool)
+	)
+	for _, name := range cfg.Chains {
+		chain, ok := Lookup(name)
+		if !ok {
+			logger.Fatalw("Unknown chain", "chain", name)
+		}
+		if enabled[chain.Name] {
+			continue
+		}
+		enabled[chain.Name] = true
+		if chain.Name != Ethereum && cfg.OpenSeaAPIVersion != "v2" {
+			logger.Fatalw("Chains other than ethereum need the v2 OpenSea API", "chain", chain.Name)
+		}
+
+		rpcClient := infuraClient.Client
+		endpoint, ok := endpoints[chain.Name]
+		if !ok && chain.Name != Ethereum {
+			endpoint, ok = fmt.Sprintf("https://%s.infura.io/v3", chain.InfuraNetwork), true
+			if cfg.InfuraKey != "" {
+				endpoint += "/" + cfg.InfuraKey
+			}
+		}
+		if ok {
+			rpcClient = dial(cfg, logger, chain, endpoint)
+		}
+
+		clients = append(clients, NewClient(chain, rpcClient, os.OnChain(chain.OpenSeaChain), group, balances))
+	}
+
+	return NewRegistry(clients, prices, cs, logger)
+}
+
+var Options = ProvideRegistry
+
+func dial(cfg config.Config, logger *zap.SugaredLogger, chain Chain, endpoint string) *ethclient.Client {
+	tr, err := cassette.Transport(cfg, "infura-"+chain.Name, nil)
+	if err != nil {
+		logger.Fatalw("Failed to set up the chain transport", "chain", chain.Name, "error", err)
+	}
+
+	rpcClient, err := rpc.DialHTTPWithClient(endpoint, &http.Client{Transport: tr})
+	if err != nil {
+		logger.Fatalw("Invalid chain RPC URL", "chain", chain.Name, "error", err)
+	}
+	return ethclient.NewClient(rpcClient)
+}
+
+// NewRegistry creates a Registry of clients
+func NewRegistry(clients []*Client, prices *oracle.Oracle, cs coinstats.CoinstatsClient, logger *zap.SugaredLogger) *Registry {
+	return &Registry{
+		clients: clients,
+		prices:  prices,
+		cs:      cs,
+		logger:  logger,
+	}
+}
+
+// All returns the client of every enabled chain
+func (r *Registry) All() []*Client {
+	return r.clients
+}
+
+// Get returns the client of the enabled chain named name
+func (r *Registry) Get(name string) (*Client, error) {
+	if chain, ok := Lookup(name); ok {
+		for _, c := range r.clients {
+			if c.Name == chain.Name {
+				return c, nil
+			}
+		}
+	}
+
+	var names []string
+	for _, c := range r.clients {
+		names = append(names, c.Name)
+	}
+	return nil, apierror.Errorf(apierror.CodeInvalidInput, "chain %q is not enabled, use one of %s", name, strings.Join(names, ", "))
+}
+
+// Price quotes one symbol on chain in currency. ETH is quoted by the oracle
+// and the chain's native token by Coinstats, wrapped tokens are priced as
+// the token they wrap and an empty symbol is the native token.
+func (r *Registry) Price(ctx context.Context, chain Chain, symbol, currency string) (oracle.Quote, error) {
+	if symbol == "" {
+		symbol = chain.NativeSymbol
+	}
+	symbol = PriceSymbol(symbol)
+
+	switch {
+	case symbol == "ETH":
+		return r.prices.ETHPrice(ctx, currency)
+	case symbol == chain.NativeSymbol && chain.CoinstatsID != "":
+		price, err := r.cs.GetCoinPriceIn(chain.CoinstatsID, currency)
+		if err != nil {
+			return oracle.Quote{}, err
+		}
+		return oracle.Quote{
+			Currency:  price.Currency,
+			Rate:      price.Rate,
+			Timestamp: price.Timestamp,
+			Source:    "coinstats",
+		}, nil
+	}
+
+	return oracle.Quote{}, fmt.Errorf("%w: %s on %s", ErrUnpricedToken, symbol, chain.Name)
+}
@@ -0,0 +1,34 @@
+// Command migrate-users rewrites the user documents written by the first
+// version of POST /users to the sweeper's schema. Reads adapt them in
+// memory, so it only needs to run once.
+package main
+
+import (
+	"context"
+	"log"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/logger"
+)
+
+func main() {
+	var (
+		ctx = context.Background()
+		cfg = config.ProvideConfig()
+		l   = logger.ProvideLogger()
+	)
+
+	client, err := firestore.NewClient(ctx, cfg.FirestoreProjectID)
+	if err != nil {
+		log.Fatalf("Failed to create client: %v", err)
+	}
+	defer client.Close()
+
+	migrated, err := database.MigrateLegacyUsers(ctx, client, l)
+	if err != nil {
+		log.Fatalf("Failed to migrate users: %v", err)
+	}
+	l.Infow("Migrated legacy users", "count", migrated)
+}
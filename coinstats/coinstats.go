@@ -1,11 +1,19 @@
 package coinstats
 
 import (
+	"context"
 	"encoding/json"
-	"log"
+	"fmt"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
+
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/cassette"
+	"github.com/mager/keiko/config"
+	"go.uber.org/zap"
 )
 
 type Coin struct {
@@ -19,62 +27,175 @@ type CoinsResp struct {
 	Coins Coins `json:"coins"`
 }
 
+// CoinResp is the response from /coins/{id}
+type CoinResp struct {
+	Coin Coin `json:"coin"`
+}
+
+// requestTimeout leaves the oracle time to fall back to Chainlink when
+// Coinstats hangs
+const requestTimeout = 5 * time.Second
+
 type CoinstatsClient struct {
 	httpClient *http.Client
+	baseURL    string
+	cache      *cache.Group
+	logger     *zap.SugaredLogger
 }
 
 // ProvideCoinstats provides an HTTP client
-func ProvideCoinstats() CoinstatsClient {
-	tr := &http.Transport{
+func ProvideCoinstats(cfg config.Config, logger *zap.SugaredLogger, c *cache.Cache) CoinstatsClient {
+	tr, err := cassette.Transport(cfg, "coinstats", &http.Transport{
 		MaxIdleConns:       10,
 		IdleConnTimeout:    30 * time.Second,
 		DisableCompression: true,
+	})
+	if err != nil {
+		logger.Fatalw("Failed to set up the Coinstats transport", "error", err)
 	}
 
 	return CoinstatsClient{
-		httpClient: &http.Client{Transport: tr},
+		httpClient: &http.Client{Transport: tr, Timeout: requestTimeout},
+		baseURL:    strings.TrimSuffix(cfg.CoinstatsBaseURL, "/"),
+		cache: c.Group("coinstats", cache.Policy{
+			TTL:      cfg.ETHPriceTTL,
+			StaleTTL: cfg.CacheStaleTTL,
+		}),
+		logger: logger,
 	}
 }
 
 var Options = ProvideCoinstats
 
-// GetCoins returns the coin prices
+// Price is the price of one coin, ETH unless said otherwise, in a fiat
+// currency
+type Price struct {
+	Currency string
+	Rate     float64
+	// Timestamp is when the rate was fetched
+	Timestamp time.Time
+}
+
+// pricedCoins are the coin prices in one currency along with when they were
+// fetched
+type pricedCoins struct {
+	coins   CoinsResp
+	fetched time.Time
+}
+
+// GetCoins returns the coin prices in USD
 func (c *CoinstatsClient) GetCoins() (CoinsResp, error) {
+	priced, err := c.getCoinsIn("USD")
+	return priced.coins, err
+}
+
+// getCoinsIn returns the coin prices in currency, cached per currency for the
+// ETHPriceTTL
+func (c *CoinstatsClient) getCoinsIn(currency string) (pricedCoins, error) {
+	currency = strings.ToUpper(currency)
+
+	v, err := c.cache.Get(context.Background(), "coins:"+currency, func(ctx context.Context) (interface{}, error) {
+		coins, err := c.fetchCoins(currency)
+		return pricedCoins{coins: coins, fetched: time.Now()}, err
+	})
+	if err != nil {
+		return pricedCoins{}, err
+	}
+	return v.(pricedCoins), nil
+}
+
+func (c *CoinstatsClient) fetchCoins(currency string) (CoinsResp, error) {
 	var coinsResp CoinsResp
-	u, err := url.Parse("https://api.coinstats.app/public/v1/coins?skip=0&limit=5&currency=USD")
+	u, err := url.Parse(c.baseURL + "/coins?skip=0&limit=5")
 	if err != nil {
-		log.Fatal(err)
-		return coinsResp, nil
+		return coinsResp, err
 	}
+	q := u.Query()
+	q.Set("currency", currency)
+	u.RawQuery = q.Encode()
 
 	// Fetch ETH price
+	err = c.get(u, &coinsResp)
+	return coinsResp, err
+}
+
+// GetCoinPriceIn returns the price of the coin with the Coinstats ID id, such
+// as "matic-network", in currency. Coins are cached per currency for the
+// ETHPriceTTL.
+func (c *CoinstatsClient) GetCoinPriceIn(id, currency string) (Price, error) {
+	currency = strings.ToUpper(currency)
+
+	v, err := c.cache.Get(context.Background(), "coin:"+id+":"+currency, func(ctx context.Context) (interface{}, error) {
+		coin, err := c.fetchCoin(id, currency)
+		if err != nil {
+			return Price{}, err
+		}
+		return Price{Currency: currency, Rate: coin.Price, Timestamp: time.Now()}, nil
+	})
+	if err != nil {
+		return Price{}, err
+	}
+	return v.(Price), nil
+}
+
+func (c *CoinstatsClient) fetchCoin(id, currency string) (Coin, error) {
+	var coinResp CoinResp
+	u, err := url.Parse(c.baseURL + "/coins/" + url.PathEscape(id))
+	if err != nil {
+		return Coin{}, err
+	}
+	q := u.Query()
+	q.Set("currency", currency)
+	u.RawQuery = q.Encode()
+
+	if err := c.get(u, &coinResp); err != nil {
+		return Coin{}, err
+	}
+	if coinResp.Coin.ID != id || coinResp.Coin.Price <= 0 {
+		return Coin{}, apierror.Upstream("coinstats", apierror.CodeBadResponse, "no price", fmt.Errorf("no %s price in %s", id, currency))
+	}
+
+	return coinResp.Coin, nil
+}
+
+// get fetches u from the Coinstats API and decodes the JSON response into out
+func (c *CoinstatsClient) get(u *url.URL, out interface{}) error {
 	resp, err := c.httpClient.Get(u.String())
 	if err != nil {
-		log.Fatal(err)
-		return coinsResp, nil
+		c.logger.Warnw("Failed to fetch from Coinstats", "path", u.Path, "error", err)
+		return apierror.Unreachable("coinstats", err)
 	}
 	defer resp.Body.Close()
 
-	err = json.NewDecoder(resp.Body).Decode(&coinsResp)
+	if err := apierror.FromResponse("coinstats", resp); err != nil {
+		return err
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(out)
 	if err != nil {
-		log.Fatal(err)
-		return coinsResp, nil
+		c.logger.Warnw("Failed to decode Coinstats response", "path", u.Path, "error", err)
+		return apierror.Decode("coinstats", err)
 	}
 
-	return coinsResp, nil
+	return nil
 }
 
-func (c *CoinstatsClient) GetETHPrice() float64 {
-	coinsResp, err := c.GetCoins()
+// GetETHPriceIn returns the price of ETH in currency
+func (c *CoinstatsClient) GetETHPriceIn(currency string) (Price, error) {
+	priced, err := c.getCoinsIn(currency)
 	if err != nil {
-		return 0.0
+		return Price{}, err
 	}
 
-	for _, coin := range coinsResp.Coins {
+	for _, coin := range priced.coins.Coins {
 		if coin.ID == "ethereum" {
-			return coin.Price
+			return Price{
+				Currency:  strings.ToUpper(currency),
+				Rate:      coin.Price,
+				Timestamp: priced.fetched,
+			}, nil
 		}
 	}
 
-	return 0.0
+	return Price{}, apierror.Upstream("coinstats", apierror.CodeBadResponse, "no ethereum price", fmt.Errorf("no ethereum price in %s", currency))
 }
@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"time"
 
 	"github.com/kelseyhightower/envconfig"
 )
@@ -11,6 +12,146 @@ type Config struct {
 	DiscordAuthToken string
 	InfuraKey        string
 	EtherscanAPIKey  string
+
+	// Upstreams
+	EtherscanBaseURL string `default:"https://api.etherscan.io/api"`
+	CoinstatsBaseURL string `default:"https://api.coinstats.app/public/v1"`
+	// InfuraURL is the JSON-RPC endpoint, the InfuraKey is appended to it
+	InfuraURL      string `default:"https://mainnet.infura.io/v3"`
+	SweeperBaseURL string `default:"https://sweeper.floor.report"`
+	// EtherscanMaxRetries is how many times a rate limited or timed out
+	// Etherscan query is retried, waiting EtherscanRetryDelay doubled
+	// each time
+	EtherscanMaxRetries int           `default:"3"`
+	EtherscanRetryDelay time.Duration `default:"1s"`
+	// TransferSyncInterval is how long synced transfers are served before a
+	// contract is synced again
+	TransferSyncInterval time.Duration `default:"1m"`
+	// TransferSource is "etherscan" or "logs" to read Transfer logs from
+	// Infura with the indexer instead
+	TransferSource string `default:"etherscan"`
+	// IndexerConfirmations is how far behind the chain head the indexer
+	// stays. IndexerBlockRange is the first block range it asks logs for,
+	// widened up to IndexerMaxRange while queries return few logs and
+	// narrowed when they return too many.
+	IndexerConfirmations int64         `default:"12"`
+	IndexerBlockRange    int64         `default:"10000"`
+	IndexerMaxRange      int64         `default:"1000000"`
+	IndexerPollInterval  time.Duration `default:"1m"`
+	// HTTPMode is "record" to save every upstream request and its response
+	// to a cassette per upstream in CassetteDir, or "replay" to answer them
+	// from the cassettes without the network
+	HTTPMode    string
+	CassetteDir string `default:"cassettes"`
+
+	// Currencies are the fiat currencies values can be converted to
+	Currencies      []string `default:"USD,EUR,GBP,JPY"`
+	DefaultCurrency string   `default:"USD"`
+
+	// ETH price oracle
+	// PriceSources are tried in order until one has an acceptable quote
+	PriceSources []string `default:"coinstats,chainlink"`
+	// PriceMaxAge is how old a quote from each source can be
+	PriceMaxAge map[string]time.Duration `default:"coinstats:15m,chainlink:2h"`
+	// PriceMaxDeviation is how far a quote can be from the last accepted
+	// one before a second source has to confirm it
+	PriceMaxDeviation float64 `default:"0.2"`
+	// ChainlinkFeeds are the mainnet aggregators keyed by pair, ETH/USD is
+	// required and {currency}/USD feeds convert to other currencies
+	ChainlinkFeeds map[string]string `default:"ETH/USD:0x5f4eC3Df9cbd43714FE2740f5E3616155c5b8419,EUR/USD:0xb49f677943BC038e9857d61E7d053CaA2C1734C1,GBP/USD:0x5c0Ab2d9b5a7ed9f470386e82BB36A3613cDd4b5,JPY/USD:0xBcE206caE7f0ec07b545EddE332A47C2F75bbeb3"`
+
+	// OpenSea
+	// OpenSeaBaseURL is the OpenSea API, OpenSeaAPIVersion picks its "v1"
+	// or "v2" routes and OpenSeaChain is the chain v2 lookups are scoped to
+	OpenSeaBaseURL    string `default:"https://api.opensea.io"`
+	OpenSeaAPIVersion string `default:"v2"`
+	OpenSeaChain      string `default:"ethereum"`
+	// OpenSeaRequestsPerSecond and OpenSeaBurst size the token bucket shared
+	// by every request to OpenSea
+	OpenSeaRequestsPerSecond float64 `default:"4"`
+	OpenSeaBurst             int     `default:"4"`
+	// OpenSeaMaxRetries is how many times a 429 or 5xx is retried, backing
+	// off exponentially from OpenSeaBackoffBase up to OpenSeaBackoffMax
+	OpenSeaMaxRetries  int           `default:"4"`
+	OpenSeaBackoffBase time.Duration `default:"500ms"`
+	OpenSeaBackoffMax  time.Duration `default:"10s"`
+	// OpenSeaBreakerThreshold failures in a row open the circuit breaker,
+	// which fails requests fast for OpenSeaBreakerCooldown
+	OpenSeaBreakerThreshold int           `default:"5"`
+	OpenSeaBreakerCooldown  time.Duration `default:"30s"`
+
+	// Chains
+	// Chains are the chains portfolios are read from, of ethereum, polygon,
+	// base, arbitrum and optimism. Chains other than ethereum need the v2
+	// OpenSea API.
+	Chains []string `default:"ethereum"`
+	// ChainRPCURLs override the JSON-RPC endpoint of a chain as chain=url,
+	// used as is. Otherwise it is Infura's endpoint for the chain with the
+	// InfuraKey appended, and the InfuraURL for ethereum.
+	ChainRPCURLs []string
+
+	// Cache
+	CacheMaxEntries int           `default:"100000"`
+	ETHPriceTTL     time.Duration `default:"1m"`
+	ENSTTL          time.Duration `default:"1h"`
+	OpenSeaTTL      time.Duration `default:"5m"`
+	BalanceTTL      time.Duration `default:"30s"`
+	// CacheNegativeTTL is how long lookups without a result are cached
+	CacheNegativeTTL time.Duration `default:"10m"`
+	// CacheStaleTTL is how long expired results are served when the
+	// upstream is down
+	CacheStaleTTL time.Duration `default:"1h"`
+
+	// Database
+	DatabaseBackend    string `default:"firestore"`
+	FirestoreProjectID string `default:"floorreport"`
+	MemorySeedFile     string
+
+	// API keys
+	AdminKey                   string
+	APIKeyRoutes               []string
+	APIKeyRotationOverlap      time.Duration `default:"24h"`
+	ApplicationRefreshInterval time.Duration `default:"1m"`
+
+	// Sign-In with Ethereum
+	SIWEDomains  []string      `default:"floor.report"`
+	SIWEChainIDs []int         `default:"1"`
+	NonceTTL     time.Duration `default:"10m"`
+	SessionTTL   time.Duration `default:"24h"`
+	// LegacySignatures allows the raw X-Signature/X-Message headers on the
+	// follow and unfollow collection routes that took them before EIP-712,
+	// they can be replayed and are being phased out
+	LegacySignatures bool `default:"false"`
+	// SignatureCacheTTL is how long EIP-1271 contract wallet checks are cached
+	SignatureCacheTTL time.Duration `default:"1m"`
+	// MaxLinkedWallets is how many wallets can be linked to one profile
+	MaxLinkedWallets int `default:"10"`
+
+	// EIP-712
+	EIP712ChainID int64 `default:"1"`
+	// ActionSignatureMaxAge is the furthest in the future an action expiry can be
+	ActionSignatureMaxAge time.Duration `default:"10m"`
+
+	// Avatars
+	AvatarMaxBytes int64 `default:"5242880"`
+	AvatarSizes    []int `default:"64,256,512"`
+	// BlobBackend is "gcs" or "local"
+	BlobBackend  string `default:"local"`
+	BlobBucket   string `default:"floorreport-avatars"`
+	BlobLocalDir string `default:".blobs"`
+	// NFTAvatarRecheckInterval is how often NFT avatar ownership is re-checked
+	NFTAvatarRecheckInterval time.Duration `default:"6h"`
+
+	// Collection stats
+	StatsSnapshotInterval time.Duration `default:"15m"`
+	// StatsMaxPoints bounds the length of a returned time series
+	StatsMaxPoints int `default:"500"`
+
+	// Portfolio history
+	PortfolioCheckInterval time.Duration `default:"1h"`
+	// PortfolioSnapshotMaxAge is how often a wallet is snapshotted when it
+	// is not refreshed
+	PortfolioSnapshotMaxAge time.Duration `default:"24h"`
 }
 
 func ProvideConfig() Config {
@@ -2,58 +2,269 @@ package database
 
 import (
 	"context"
+	"fmt"
 	"log"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
 
 	"cloud.google.com/go/firestore"
-	"google.golang.org/api/iterator"
+	"github.com/mager/keiko/config"
+	sweeperdb "github.com/mager/sweeper/database"
+	"go.uber.org/zap"
 )
 
 type DatabaseClient struct {
-	Client *firestore.Client
-	Apps   map[string]Application
+	Users        UserStore
+	Collections  CollectionStore
+	Features     FeatureStore
+	Applications ApplicationStore
+	Nonces       NonceStore
+	Sessions     SessionStore
+	Stats        StatStore
+	Portfolios   PortfolioStore
+	Transfers    TransferStore
+	WalletLinks  WalletLinkStore
+	Follows      FollowStore
 }
 
-// ProvideDB provides a firestore client
-func ProvideDB() *DatabaseClient {
-	projectID := "floorreport"
+// ProvideDB provides the database selected by the DatabaseBackend config
+func ProvideDB(cfg config.Config, logger *zap.SugaredLogger) *DatabaseClient {
+	var db *DatabaseClient
 
-	client, err := firestore.NewClient(context.TODO(), projectID)
-	if err != nil {
-		log.Fatalf("Failed to create client: %v", err)
+	switch cfg.DatabaseBackend {
+	case "memory":
+		var seed MemorySeed
+		if cfg.MemorySeedFile != "" {
+			var err error
+			seed, err = LoadMemorySeed(cfg.MemorySeedFile)
+			if err != nil {
+				log.Fatalf("Failed to load seed file: %v", err)
+			}
+		}
+		logger.Infow("Using in-memory database", "seed", cfg.MemorySeedFile)
+		db = NewMemoryDatabase(seed)
+	case "firestore":
+		client, err := firestore.NewClient(context.TODO(), cfg.FirestoreProjectID)
+		if err != nil {
+			log.Fatalf("Failed to create client: %v", err)
+		}
+		db = NewFirestoreDatabase(client)
+	default:
+		log.Fatalf("Unknown database backend: %s", cfg.DatabaseBackend)
 	}
 
-	apps := GetApplicationMap(client)
-
-	return &DatabaseClient{
-		Client: client,
-		Apps:   apps,
-	}
+	return db
 }
 
 var Options = ProvideDB
 
-type Application struct {
-	Name   string `firestore:"name" json:"name"`
-	APIKey string `firestore:"apiKey" json:"apiKey"`
-}
-
-func GetApplicationMap(db *firestore.Client) map[string]Application {
-	// Fetch apps from database
-	ctx := context.Background()
-	iter := db.Collection("applications").Documents(ctx)
-	apps := make(map[string]Application)
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
+// User is the sweeper user document along with the fields only keiko writes
+type User struct {
+	sweeperdb.User
+
+	Avatar *Avatar `firestore:"avatar,omitempty" json:"avatar,omitempty"`
+	// OpenSea is the user's OpenSea username
+	OpenSea string `firestore:"openSea,omitempty" json:"openSea,omitempty"`
+	// Currency is the fiat currency values are shown in when a request
+	// does not ask for one
+	Currency string `firestore:"currency,omitempty" json:"currency,omitempty"`
+}
+
+// Avatar records where a user's profile picture lives
+type Avatar struct {
+	// Source is "upload" for images stored in the blob store, "url" for an
+	// external image or "nft" for a token the user owns
+	Source string `firestore:"source" json:"source"`
+	// URL is the external image for the "url" and "nft" sources
+	URL string `firestore:"url,omitempty" json:"url,omitempty"`
+	// Keys maps each thumbnail size to its blob key for the "upload" source
+	Keys        map[string]string `firestore:"keys,omitempty" json:"keys,omitempty"`
+	ContentType string            `firestore:"contentType,omitempty" json:"contentType,omitempty"`
+	Updated     time.Time         `firestore:"updated" json:"updated"`
+
+	// NFT is the token shown for the "nft" source
+	NFT *AvatarNFT `firestore:"nft,omitempty" json:"nft,omitempty"`
+}
+
+// AvatarNFT identifies the token used as an avatar
+type AvatarNFT struct {
+	Contract string `firestore:"contract" json:"contract"`
+	TokenID  string `firestore:"tokenId" json:"tokenId"`
+	// Standard is "erc721" or "erc1155"
+	Standard string `firestore:"standard" json:"standard"`
+	// Verified is when ownership was last confirmed on-chain
+	Verified time.Time `firestore:"verified" json:"verified"`
+}
+
+// Avatar sources
+const (
+	AvatarSourceUpload = "upload"
+	AvatarSourceURL    = "url"
+	AvatarSourceNFT    = "nft"
+)
+
+// CollectionStat is a snapshot of a collection's market stats
+type CollectionStat struct {
+	Floor float64 `firestore:"floor" json:"floor"`
+	// Volume is the one day volume in ETH
+	Volume    float64   `firestore:"volume" json:"volume"`
+	Owners    int       `firestore:"owners" json:"owners"`
+	Timestamp time.Time `firestore:"timestamp" json:"timestamp"`
+}
+
+// PortfolioSnapshot is the value of a user's wallet at a point in time
+type PortfolioSnapshot struct {
+	Timestamp time.Time `firestore:"timestamp" json:"timestamp"`
+	TotalETH  float64   `firestore:"totalETH" json:"totalETH"`
+	TotalUSD  float64   `firestore:"totalUSD" json:"totalUSD"`
+	// ETHPriceUSD is the price TotalUSD was computed with
+	ETHPriceUSD float64 `firestore:"ethPriceUSD" json:"ethPriceUSD"`
+	// ETHPrices are the ETH prices in every configured currency when the
+	// snapshot was taken, keyed by currency code
+	ETHPrices map[string]float64 `firestore:"ethPrices,omitempty" json:"ethPrices,omitempty"`
+	// WalletUpdated is when the wallet the snapshot was taken from was synced
+	WalletUpdated time.Time             `firestore:"walletUpdated" json:"walletUpdated"`
+	Collections   []PortfolioCollection `firestore:"collections" json:"collections"`
+}
+
+// PortfolioCollection is the value of one collection in a PortfolioSnapshot
+type PortfolioCollection struct {
+	Slug     string  `firestore:"slug" json:"slug"`
+	ValueETH float64 `firestore:"valueETH" json:"valueETH"`
+	NumOwned int     `firestore:"numOwned" json:"numOwned"`
+}
+
+// Token standards of a Transfer
+const (
+	StandardERC721  = "erc721"
+	StandardERC1155 = "erc1155"
+)
+
+// Transfer is an NFT transfer of a contract, as reported by Etherscan
+type Transfer struct {
+	Hash        string `firestore:"hash" json:"hash"`
+	BlockNumber int64  `firestore:"blockNumber" json:"blockNumber"`
+	// TransactionIndex orders the transfers within a block
+	TransactionIndex int       `firestore:"transactionIndex" json:"transactionIndex"`
+	From             string    `firestore:"from" json:"from"`
+	To               string    `firestore:"to" json:"to"`
+	TokenID          string    `firestore:"tokenId" json:"tokenId"`
+	Timestamp        time.Time `firestore:"timestamp" json:"timestamp"`
+	// Standard is empty for transfers stored before ERC-1155 support, which
+	// are all ERC-721
+	Standard string `firestore:"standard,omitempty" json:"standard,omitempty"`
+	// Value is the decimal quantity moved, empty for ERC-721 where it is
+	// always one
+	Value string `firestore:"value,omitempty" json:"value,omitempty"`
+	// LogIndex orders the transfers within a block. Etherscan does not
+	// return it, so transfers from Etherscan are numbered in the order it
+	// lists them within their block instead.
+	LogIndex int `firestore:"logIndex,omitempty" json:"logIndex,omitempty"`
+	// BatchIndex is the position of the transfer in its TransferBatch log
+	BatchIndex int `firestore:"batchIndex,omitempty" json:"batchIndex,omitempty"`
+}
+
+// BlockRef identifies a block
+type BlockRef struct {
+	Number int64  `firestore:"number" json:"number"`
+	Hash   string `firestore:"hash" json:"hash"`
+}
+
+// Checkpoint is the block the log indexer has indexed a contract up to.
+// Recent holds the blocks of earlier checkpoints, newest first, to find where
+// the chain forked after a reorg.
+type Checkpoint struct {
+	Block   BlockRef   `firestore:"block" json:"block"`
+	Recent  []BlockRef `firestore:"recent" json:"recent"`
+	Updated time.Time  `firestore:"updated" json:"updated"`
+}
+
+// SortTransfers sorts transfers oldest first
+func SortTransfers(transfers []Transfer) {
+	sort.SliceStable(transfers, func(i, j int) bool {
+		if transfers[i].BlockNumber != transfers[j].BlockNumber {
+			return transfers[i].BlockNumber < transfers[j].BlockNumber
 		}
-		if err != nil {
-			log.Fatalf("Failed to iterate: %v", err)
+		if transfers[i].TransactionIndex != transfers[j].TransactionIndex {
+			return transfers[i].TransactionIndex < transfers[j].TransactionIndex
+		}
+		if transfers[i].LogIndex != transfers[j].LogIndex {
+			return transfers[i].LogIndex < transfers[j].LogIndex
 		}
-		app := Application{}
-		doc.DataTo(&app)
-		apps[doc.Ref.ID] = app
+		return transfers[i].BatchIndex < transfers[j].BatchIndex
+	})
+}
+
+// TokenStandard returns the standard of the transfer
+func (t Transfer) TokenStandard() string {
+	if t.Standard == "" {
+		return StandardERC721
+	}
+	return t.Standard
+}
+
+// Quantity returns how many of the token the transfer moved
+func (t Transfer) Quantity() (*big.Int, bool) {
+	if t.Value == "" {
+		return big.NewInt(1), true
 	}
+	return new(big.Int).SetString(t.Value, 10)
+}
+
+// ID identifies the transfer by its place in the log it was read from. A
+// transaction can move the same token back and forth, and a TransferBatch
+// can list it twice.
+func (t Transfer) ID() string {
+	return strings.ToLower(fmt.Sprintf("%s-%s-%d-%d", t.Hash, t.TokenStandard(), t.LogIndex, t.BatchIndex))
+}
+
+type Application struct {
+	Name string   `firestore:"name" json:"name"`
+	Keys []APIKey `firestore:"keys" json:"keys"`
+
+	// Deprecated: APIKey is the legacy plaintext key, it is cleared on the
+	// first rotation
+	APIKey string `firestore:"apiKey,omitempty" json:"apiKey,omitempty"`
+}
+
+// Session is a Sign-In with Ethereum session
+type Session struct {
+	Address string    `firestore:"address" json:"address"`
+	ChainID int       `firestore:"chainId" json:"chainId"`
+	Domain  string    `firestore:"domain" json:"domain"`
+	Created time.Time `firestore:"created" json:"created"`
+	Expires time.Time `firestore:"expires" json:"expires"`
+}
+
+// WalletLink is a wallet proven to belong to the profile of Owner
+type WalletLink struct {
+	Wallet string    `firestore:"wallet" json:"wallet"`
+	Owner  string    `firestore:"owner" json:"owner"`
+	Linked time.Time `firestore:"linked" json:"linked"`
+}
+
+// Follow is a profile following the wallet at Followee
+type Follow struct {
+	Follower string    `firestore:"follower" json:"follower"`
+	Followee string    `firestore:"followee" json:"followee"`
+	Created  time.Time `firestore:"created" json:"created"`
+}
+
+// FollowCounts are kept up to date as follows are created and deleted
+type FollowCounts struct {
+	Followers int `firestore:"followers" json:"followers"`
+	Following int `firestore:"following" json:"following"`
+}
 
-	return apps
+// APIKey is a hashed API key belonging to an Application
+type APIKey struct {
+	// Hash is the hex encoded SHA-256 of the key
+	Hash string `firestore:"hash" json:"hash"`
+	// Prefix is the first few characters of the key, used to identify it
+	Prefix  string    `firestore:"prefix" json:"prefix"`
+	Created time.Time `firestore:"created" json:"created"`
+	// Expires is set when the key is rotated or revoked, zero means never
+	Expires time.Time `firestore:"expires" json:"expires"`
 }
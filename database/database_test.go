@@ -0,0 +1,181 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestApplicationUpdate(t *testing.T) {
+	var (
+		store = NewMemoryDatabase(MemorySeed{}).Applications
+		ctx   = context.Background()
+		errs  = make(chan error, 10)
+	)
+	if err := store.Create(ctx, "app", Application{Name: "App"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent updates do not overwrite each other
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			errs <- store.Update(ctx, "app", func(app *Application) error {
+				app.Keys = append(app.Keys, APIKey{Prefix: fmt.Sprint(i)})
+				return nil
+			})
+		}(i)
+	}
+	for i := 0; i < cap(errs); i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	app, err := store.Get(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(app.Keys) != cap(errs) {
+		t.Fatalf("%d keys, want %d", len(app.Keys), cap(errs))
+	}
+
+	if err := store.Update(ctx, "missing", func(*Application) error { return nil }); err != ErrNotFound {
+		t.Fatalf("Update() error = %v, want %v", err, ErrNotFound)
+	}
+}
+
+func TestPortfolioAddIfDue(t *testing.T) {
+	var (
+		store = NewMemoryDatabase(MemorySeed{}).Portfolios
+		ctx   = context.Background()
+		added = make(chan bool, 10)
+		now   = time.Now()
+	)
+
+	// Concurrent recorders add the first snapshot once
+	for i := 0; i < cap(added); i++ {
+		go func(i int) {
+			snapshot := PortfolioSnapshot{Timestamp: now.Add(time.Duration(i) * time.Second)}
+			ok, err := store.AddIfDue(ctx, "0xa", snapshot, func(latest *PortfolioSnapshot) bool {
+				return latest == nil
+			})
+			if err != nil {
+				t.Error(err)
+			}
+			added <- ok
+		}(i)
+	}
+
+	var n int
+	for i := 0; i < cap(added); i++ {
+		if <-added {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Fatalf("added %d snapshots, want 1", n)
+	}
+}
+
+func TestTransferID(t *testing.T) {
+	var (
+		// A TransferBatch listing the same token twice, and a later log of
+		// the same transaction sending it back
+		transfers = []Transfer{
+			{Hash: "0xA", Standard: StandardERC1155, TokenID: "7", From: "0x1", To: "0x2", Value: "1", LogIndex: 3},
+			{Hash: "0xA", Standard: StandardERC1155, TokenID: "7", From: "0x1", To: "0x2", Value: "1", LogIndex: 3, BatchIndex: 1},
+			{Hash: "0xA", Standard: StandardERC1155, TokenID: "7", From: "0x2", To: "0x1", Value: "1", LogIndex: 4},
+		}
+		store = NewMemoryDatabase(MemorySeed{}).Transfers
+		ctx   = context.Background()
+	)
+
+	if err := store.AddIndexed(ctx, "0xc", transfers, Checkpoint{}); err != nil {
+		t.Fatal(err)
+	}
+	// Storing them again replaces them
+	if err := store.AddIndexed(ctx, "0xc", transfers, Checkpoint{}); err != nil {
+		t.Fatal(err)
+	}
+
+	stored, err := store.List(ctx, "0xc")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored) != len(transfers) {
+		t.Fatalf("stored %d transfers, want %d", len(stored), len(transfers))
+	}
+	if transfers[0].ID() != "0xa-erc1155-3-0" {
+		t.Fatalf("ID() = %s, want 0xa-erc1155-3-0", transfers[0].ID())
+	}
+}
+
+func TestWalletLinkLimit(t *testing.T) {
+	var (
+		store = NewMemoryDatabase(MemorySeed{}).WalletLinks
+		ctx   = context.Background()
+		errs  = make(chan error, 10)
+	)
+
+	// Concurrent links cannot go over the limit
+	for i := 0; i < cap(errs); i++ {
+		go func(i int) {
+			errs <- store.Create(ctx, WalletLink{Wallet: fmt.Sprintf("0x%d", i), Owner: "0xowner"}, 3)
+		}(i)
+	}
+
+	var limited int
+	for i := 0; i < cap(errs); i++ {
+		switch err := <-errs; err {
+		case nil:
+		case ErrLimitReached:
+			limited++
+		default:
+			t.Fatal(err)
+		}
+	}
+	if limited != cap(errs)-3 {
+		t.Fatalf("%d links over the limit, want %d", limited, cap(errs)-3)
+	}
+
+	links, err := store.ListByOwner(ctx, "0xowner")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(ctx, WalletLink{Wallet: links[0].Wallet, Owner: "0xother"}, 3); err != ErrAlreadyExists {
+		t.Fatalf("Create() error = %v, want %v", err, ErrAlreadyExists)
+	}
+}
+
+func TestFollowCounts(t *testing.T) {
+	var (
+		store = NewMemoryDatabase(MemorySeed{}).Follows
+		ctx   = context.Background()
+	)
+
+	for _, follow := range []Follow{
+		{Follower: "0xa", Followee: "0xb"},
+		{Follower: "0xa", Followee: "0xc"},
+		{Follower: "0xc", Followee: "0xa"},
+	} {
+		if err := store.Create(ctx, follow); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.Delete(ctx, "0xa", "0xc"); err != nil {
+		t.Fatal(err)
+	}
+	// Deleting a follow that does not exist changes nothing
+	if err := store.Delete(ctx, "0xa", "0xc"); err != nil {
+		t.Fatal(err)
+	}
+
+	counts, err := store.Counts(ctx, "0xa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := (FollowCounts{Followers: 1, Following: 1}); counts != want {
+		t.Fatalf("Counts() = %+v, want %+v", counts, want)
+	}
+}
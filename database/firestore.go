@@ -0,0 +1,1018 @@
+package database
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"time"
+
+	"cloud.google.com/go/firestore"
+	"github.com/mager/keiko/utils"
+	sweeperdb "github.com/mager/sweeper/database"
+	"go.uber.org/zap"
+	"google.golang.org/api/iterator"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// NewFirestoreDatabase returns a DatabaseClient backed by Firestore
+func NewFirestoreDatabase(client *firestore.Client) *DatabaseClient {
+	return &DatabaseClient{
+		Users:        &firestoreUserStore{client.Collection("users")},
+		Collections:  &firestoreCollectionStore{client, client.Collection("collections")},
+		Features:     &firestoreFeatureStore{client.Collection("features")},
+		Applications: &firestoreApplicationStore{client, client.Collection("applications")},
+		Nonces:       &firestoreNonceStore{client, client.Collection("nonces")},
+		Sessions:     &firestoreSessionStore{client.Collection("sessions")},
+		Stats:        &firestoreStatStore{client.Collection("collections")},
+		Portfolios:   &firestorePortfolioStore{client, client.Collection("users")},
+		Transfers:    &firestoreTransferStore{client, client.Collection("contracts")},
+		WalletLinks:  &firestoreWalletLinkStore{client, client.Collection("walletLinks")},
+		Follows:      &firestoreFollowStore{client, client.Collection("follows"), client.Collection("followCounts")},
+	}
+}
+
+func adaptFirestoreError(err error) error {
+	switch status.Code(err) {
+	case codes.NotFound:
+		return ErrNotFound
+	case codes.AlreadyExists:
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+type firestoreUserStore struct {
+	users *firestore.CollectionRef
+}
+
+func (s *firestoreUserStore) Get(ctx context.Context, address string) (User, error) {
+	docsnap, err := s.users.Doc(address).Get(ctx)
+	if err != nil {
+		return User{}, adaptFirestoreError(err)
+	}
+
+	return decodeUser(docsnap)
+}
+
+// firestoreUser is a user document as it may be stored: the first version
+// of POST /users stored the photo URL in "photo" and capitalized "IsFren"
+type firestoreUser struct {
+	User
+
+	Photo        interface{} `firestore:"photo"`
+	LegacyIsFren *bool       `firestore:"IsFren"`
+}
+
+// decodeUser reads a user document, adapting the legacy fields in memory.
+// MigrateLegacyUsers rewrites them.
+func decodeUser(docsnap *firestore.DocumentSnapshot) (User, error) {
+	var stored firestoreUser
+	if err := docsnap.DataTo(&stored); err != nil {
+		return User{}, err
+	}
+
+	user := stored.User
+	switch photo := stored.Photo.(type) {
+	case bool:
+		user.Photo = photo
+	case string:
+		// The URL becomes an external avatar
+		if user.Avatar == nil && utils.IsHTTPURL(photo) {
+			user.Avatar = &Avatar{Source: AvatarSourceURL, URL: photo, Updated: docsnap.UpdateTime}
+		}
+		user.Photo = user.Avatar != nil
+	}
+	if stored.LegacyIsFren != nil {
+		user.IsFren = *stored.LegacyIsFren
+	}
+
+	return user, nil
+}
+
+// legacyUserUpdates returns the updates that rewrite the legacy fields of a
+// user document, if it has any
+func legacyUserUpdates(docsnap *firestore.DocumentSnapshot) []firestore.Update {
+	var (
+		data    = docsnap.Data()
+		updates []firestore.Update
+	)
+
+	if photo, ok := data["photo"].(string); ok {
+		// photo is only set when an avatar is stored
+		_, hasAvatar := data["avatar"]
+		isURL := !hasAvatar && utils.IsHTTPURL(photo)
+		if isURL {
+			updates = append(updates, firestore.Update{Path: "avatar", Value: Avatar{
+				Source:  AvatarSourceURL,
+				URL:     photo,
+				Updated: time.Now(),
+			}})
+		}
+		updates = append(updates, firestore.Update{Path: "photo", Value: hasAvatar || isURL})
+	}
+	if isFren, ok := data["IsFren"].(bool); ok {
+		updates = append(updates,
+			firestore.Update{Path: "isFren", Value: isFren},
+			firestore.Update{Path: "IsFren", Value: firestore.Delete},
+		)
+	}
+
+	return updates
+}
+
+// MigrateLegacyUsers rewrites the user documents written by the first
+// version of POST /users and returns how many were migrated. A document
+// that changes while it is migrated is skipped.
+func MigrateLegacyUsers(ctx context.Context, client *firestore.Client, logger *zap.SugaredLogger) (int, error) {
+	var migrated int
+
+	iter := client.Collection("users").Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return migrated, err
+		}
+
+		updates := legacyUserUpdates(doc)
+		if len(updates) == 0 {
+			continue
+		}
+
+		_, err = doc.Ref.Update(ctx, updates, firestore.LastUpdateTime(doc.UpdateTime))
+		if status.Code(err) == codes.FailedPrecondition {
+			logger.Warnw("User changed while migrating, skipping", "address", doc.Ref.ID)
+			continue
+		}
+		if err != nil {
+			return migrated, err
+		}
+		migrated++
+	}
+
+	return migrated, nil
+}
+
+func (s *firestoreUserStore) Create(ctx context.Context, address string, user User) error {
+	_, err := s.users.Doc(address).Create(ctx, user)
+	return adaptFirestoreError(err)
+}
+
+func (s *firestoreUserStore) Set(ctx context.Context, address string, user User) error {
+	_, err := s.users.Doc(address).Set(ctx, user)
+	return err
+}
+
+func (s *firestoreUserStore) UpdateAvatar(ctx context.Context, address string, avatar *Avatar) error {
+	var value interface{} = firestore.Delete
+	if avatar != nil {
+		value = avatar
+	}
+
+	_, err := s.users.Doc(address).Update(ctx, []firestore.Update{
+		{Path: "avatar", Value: value},
+		{Path: "photo", Value: avatar != nil},
+	})
+	return adaptFirestoreError(err)
+}
+
+func (s *firestoreUserStore) UpdateCurrency(ctx context.Context, address, currency string) error {
+	var value interface{} = firestore.Delete
+	if currency != "" {
+		value = currency
+	}
+
+	_, err := s.users.Doc(address).Update(ctx, []firestore.Update{
+		{Path: "currency", Value: value},
+	})
+	return adaptFirestoreError(err)
+}
+
+func (s *firestoreUserStore) ListByAvatarSource(ctx context.Context, source string) ([]UserRecord, error) {
+	return s.list(ctx, s.users.Where("avatar.source", "==", source))
+}
+
+func (s *firestoreUserStore) ListFrens(ctx context.Context) ([]UserRecord, error) {
+	return s.list(ctx, s.users.Where("isFren", "==", true).Where("photo", "==", true))
+}
+
+func (s *firestoreUserStore) List(ctx context.Context) ([]UserRecord, error) {
+	return s.list(ctx, s.users.Query)
+}
+
+func (s *firestoreUserStore) list(ctx context.Context, query firestore.Query) ([]UserRecord, error) {
+	var records []UserRecord
+
+	iter := query.Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return records, err
+		}
+		user, err := decodeUser(doc)
+		if err != nil {
+			return records, err
+		}
+
+		records = append(records, UserRecord{Address: doc.Ref.ID, User: user})
+	}
+
+	return records, nil
+}
+
+type firestoreCollectionStore struct {
+	client      *firestore.Client
+	collections *firestore.CollectionRef
+}
+
+func (s *firestoreCollectionStore) Get(ctx context.Context, slug string) (sweeperdb.Collection, error) {
+	var collection sweeperdb.Collection
+	docsnap, err := s.collections.Doc(slug).Get(ctx)
+	if err != nil {
+		return collection, adaptFirestoreError(err)
+	}
+
+	return adaptCollectionDoc(docsnap)
+}
+
+func (s *firestoreCollectionStore) GetAll(ctx context.Context, slugs []string) ([]sweeperdb.Collection, error) {
+	var (
+		collections []sweeperdb.Collection
+		docRefs     = make([]*firestore.DocumentRef, 0, len(slugs))
+	)
+
+	for _, slug := range slugs {
+		docRefs = append(docRefs, s.collections.Doc(slug))
+	}
+
+	docsnaps, err := s.client.GetAll(ctx, docRefs)
+	if err != nil {
+		return collections, err
+	}
+
+	for _, docsnap := range docsnaps {
+		if !docsnap.Exists() {
+			continue
+		}
+
+		collection, err := adaptCollectionDoc(docsnap)
+		if err != nil {
+			return collections, err
+		}
+		collections = append(collections, collection)
+	}
+
+	return collections, nil
+}
+
+func (s *firestoreCollectionStore) List(ctx context.Context) ([]sweeperdb.Collection, error) {
+	return collectCollections(s.collections.Documents(ctx))
+}
+
+func (s *firestoreCollectionStore) TopByWeeklyVolume(ctx context.Context, limit int) ([]sweeperdb.Collection, error) {
+	return collectCollections(s.collections.OrderBy("7d", firestore.Desc).Limit(limit).Documents(ctx))
+}
+
+func (s *firestoreCollectionStore) SearchBySlugPrefix(ctx context.Context, prefix string) ([]sweeperdb.Collection, error) {
+	return collectCollections(
+		s.collections.
+			Where("slug", ">=", prefix).
+			Where("slug", "<=", prefix+"\uf8ff").
+			Documents(ctx),
+	)
+}
+
+func collectCollections(iter *firestore.DocumentIterator) ([]sweeperdb.Collection, error) {
+	var collections []sweeperdb.Collection
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return collections, err
+		}
+
+		collection, err := adaptCollectionDoc(doc)
+		if err != nil {
+			return collections, err
+		}
+		collections = append(collections, collection)
+	}
+
+	return collections, nil
+}
+
+func adaptCollectionDoc(doc *firestore.DocumentSnapshot) (sweeperdb.Collection, error) {
+	var collection sweeperdb.Collection
+	if err := doc.DataTo(&collection); err != nil {
+		return collection, err
+	}
+
+	// The slug is the document ID
+	if collection.Slug == "" {
+		collection.Slug = doc.Ref.ID
+	}
+
+	return collection, nil
+}
+
+type firestoreFeatureStore struct {
+	features *firestore.CollectionRef
+}
+
+func (s *firestoreFeatureStore) Get(ctx context.Context, id string, v interface{}) error {
+	docsnap, err := s.features.Doc(id).Get(ctx)
+	if err != nil {
+		return adaptFirestoreError(err)
+	}
+
+	return docsnap.DataTo(v)
+}
+
+type firestoreApplicationStore struct {
+	client       *firestore.Client
+	applications *firestore.CollectionRef
+}
+
+func (s *firestoreApplicationStore) Get(ctx context.Context, id string) (Application, error) {
+	var app Application
+	docsnap, err := s.applications.Doc(id).Get(ctx)
+	if err != nil {
+		return app, adaptFirestoreError(err)
+	}
+
+	err = docsnap.DataTo(&app)
+	return app, err
+}
+
+func (s *firestoreApplicationStore) Create(ctx context.Context, id string, app Application) error {
+	_, err := s.applications.Doc(id).Create(ctx, app)
+	return adaptFirestoreError(err)
+}
+
+func (s *firestoreApplicationStore) Update(ctx context.Context, id string, update func(*Application) error) error {
+	doc := s.applications.Doc(id)
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docsnap, err := tx.Get(doc)
+		if err != nil {
+			return err
+		}
+
+		var app Application
+		if err := docsnap.DataTo(&app); err != nil {
+			return err
+		}
+		if err := update(&app); err != nil {
+			return err
+		}
+		return tx.Set(doc, app)
+	})
+	return adaptFirestoreError(err)
+}
+
+func (s *firestoreApplicationStore) List(ctx context.Context) (map[string]Application, error) {
+	apps := make(map[string]Application)
+
+	iter := s.applications.Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return apps, err
+		}
+
+		app := Application{}
+		if err := doc.DataTo(&app); err != nil {
+			return apps, err
+		}
+		apps[doc.Ref.ID] = app
+	}
+
+	return apps, nil
+}
+
+type firestoreNonceStore struct {
+	client *firestore.Client
+	nonces *firestore.CollectionRef
+}
+
+type firestoreNonce struct {
+	Expires time.Time `firestore:"expires"`
+}
+
+func (s *firestoreNonceStore) Create(ctx context.Context, nonce string, expires time.Time) error {
+	_, err := s.nonces.Doc(nonce).Create(ctx, firestoreNonce{Expires: expires})
+	return adaptFirestoreError(err)
+}
+
+func (s *firestoreNonceStore) Consume(ctx context.Context, nonce string) (time.Time, error) {
+	var (
+		doc = s.nonces.Doc(nonce)
+		n   firestoreNonce
+	)
+
+	// Read and delete in a transaction so a nonce can only be used once
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docsnap, err := tx.Get(doc)
+		if err != nil {
+			return err
+		}
+		if err := docsnap.DataTo(&n); err != nil {
+			return err
+		}
+		return tx.Delete(doc)
+	})
+
+	return n.Expires, adaptFirestoreError(err)
+}
+
+type firestoreSessionStore struct {
+	sessions *firestore.CollectionRef
+}
+
+func (s *firestoreSessionStore) Create(ctx context.Context, id string, session Session) error {
+	_, err := s.sessions.Doc(id).Create(ctx, session)
+	return adaptFirestoreError(err)
+}
+
+func (s *firestoreSessionStore) Get(ctx context.Context, id string) (Session, error) {
+	var session Session
+	docsnap, err := s.sessions.Doc(id).Get(ctx)
+	if err != nil {
+		return session, adaptFirestoreError(err)
+	}
+
+	err = docsnap.DataTo(&session)
+	return session, err
+}
+
+func (s *firestoreSessionStore) Delete(ctx context.Context, id string) error {
+	_, err := s.sessions.Doc(id).Delete(ctx)
+	return err
+}
+
+// firestoreStatStore keeps snapshots in a stats subcollection of each
+// collection, keyed by their Unix timestamp
+type firestoreStatStore struct {
+	collections *firestore.CollectionRef
+}
+
+func (s *firestoreStatStore) stats(slug string) *firestore.CollectionRef {
+	return s.collections.Doc(slug).Collection("stats")
+}
+
+func (s *firestoreStatStore) Add(ctx context.Context, slug string, stat CollectionStat) error {
+	id := strconv.FormatInt(stat.Timestamp.Unix(), 10)
+	_, err := s.stats(slug).Doc(id).Set(ctx, stat)
+	return err
+}
+
+func (s *firestoreStatStore) Range(ctx context.Context, slug string, from, to time.Time) ([]CollectionStat, error) {
+	query := s.stats(slug).Where("timestamp", "<", to)
+	if !from.IsZero() {
+		query = query.Where("timestamp", ">=", from)
+	}
+	return collectStats(query.OrderBy("timestamp", firestore.Asc).Documents(ctx))
+}
+
+func (s *firestoreStatStore) Latest(ctx context.Context, slug string) (CollectionStat, error) {
+	stats, err := collectStats(s.stats(slug).OrderBy("timestamp", firestore.Desc).Limit(1).Documents(ctx))
+	if err != nil {
+		return CollectionStat{}, err
+	}
+	if len(stats) == 0 {
+		return CollectionStat{}, ErrNotFound
+	}
+	return stats[0], nil
+}
+
+func collectStats(iter *firestore.DocumentIterator) ([]CollectionStat, error) {
+	var stats []CollectionStat
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return stats, err
+		}
+
+		var stat CollectionStat
+		if err := doc.DataTo(&stat); err != nil {
+			return stats, err
+		}
+		stats = append(stats, stat)
+	}
+
+	return stats, nil
+}
+
+// firestorePortfolioStore keeps snapshots in a portfolio subcollection of
+// each user, keyed by their Unix timestamp
+type firestorePortfolioStore struct {
+	client *firestore.Client
+	users  *firestore.CollectionRef
+}
+
+func (s *firestorePortfolioStore) portfolio(address string) *firestore.CollectionRef {
+	return s.users.Doc(address).Collection("portfolio")
+}
+
+func (s *firestorePortfolioStore) Add(ctx context.Context, address string, snapshot PortfolioSnapshot) error {
+	id := strconv.FormatInt(snapshot.Timestamp.Unix(), 10)
+	_, err := s.portfolio(address).Doc(id).Set(ctx, snapshot)
+	return err
+}
+
+func (s *firestorePortfolioStore) AddIfDue(ctx context.Context, address string, snapshot PortfolioSnapshot, due func(latest *PortfolioSnapshot) bool) (bool, error) {
+	var added bool
+
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		added = false
+
+		snapshots, err := collectPortfolioSnapshots(tx.Documents(s.portfolio(address).OrderBy("timestamp", firestore.Desc).Limit(1)))
+		if err != nil {
+			return err
+		}
+		var latest *PortfolioSnapshot
+		if len(snapshots) > 0 {
+			latest = &snapshots[0]
+		}
+		if !due(latest) {
+			return nil
+		}
+
+		id := strconv.FormatInt(snapshot.Timestamp.Unix(), 10)
+		added = true
+		return tx.Set(s.portfolio(address).Doc(id), snapshot)
+	})
+	return added, err
+}
+
+func (s *firestorePortfolioStore) Range(ctx context.Context, address string, from, to time.Time) ([]PortfolioSnapshot, error) {
+	query := s.portfolio(address).Where("timestamp", "<", to)
+	if !from.IsZero() {
+		query = query.Where("timestamp", ">=", from)
+	}
+	return collectPortfolioSnapshots(query.OrderBy("timestamp", firestore.Asc).Documents(ctx))
+}
+
+func (s *firestorePortfolioStore) Latest(ctx context.Context, address string) (PortfolioSnapshot, error) {
+	snapshots, err := collectPortfolioSnapshots(s.portfolio(address).OrderBy("timestamp", firestore.Desc).Limit(1).Documents(ctx))
+	if err != nil {
+		return PortfolioSnapshot{}, err
+	}
+	if len(snapshots) == 0 {
+		return PortfolioSnapshot{}, ErrNotFound
+	}
+	return snapshots[0], nil
+}
+
+func collectPortfolioSnapshots(iter *firestore.DocumentIterator) ([]PortfolioSnapshot, error) {
+	var snapshots []PortfolioSnapshot
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return snapshots, err
+		}
+
+		var snapshot PortfolioSnapshot
+		if err := doc.DataTo(&snapshot); err != nil {
+			return snapshots, err
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+
+	return snapshots, nil
+}
+
+// firestoreTransferStore keeps the synced blocks on a document per contract
+// and its transfers in a transfers subcollection, keyed by their ID
+type firestoreTransferStore struct {
+	client    *firestore.Client
+	contracts *firestore.CollectionRef
+}
+
+// transferBatchSize is the most writes Firestore allows in a batch
+const transferBatchSize = 500
+
+// Sources a contract's transfers can be stored from, they number the
+// transfers of a block differently
+const (
+	transferSourceEtherscan = "etherscan"
+	transferSourceLogs      = "logs"
+)
+
+type firestoreContract struct {
+	// SyncedBlocks is keyed by token standard
+	SyncedBlocks map[string]int64 `firestore:"syncedBlocks"`
+	Synced       time.Time        `firestore:"synced"`
+	Checkpoint   *Checkpoint      `firestore:"checkpoint"`
+	// Source is where the stored transfers were read from. It is empty for
+	// transfers stored before their ID had a log index.
+	Source string `firestore:"source"`
+}
+
+func (s *firestoreTransferStore) transfers(contract string) *firestore.CollectionRef {
+	return s.contracts.Doc(contract).Collection("transfers")
+}
+
+func (s *firestoreTransferStore) Add(ctx context.Context, contract, standard string, transfers []Transfer, syncedBlock int64) error {
+	if err := s.put(ctx, contract, transfers); err != nil {
+		return err
+	}
+
+	// The synced block moves last, so a failed sync is picked up again. The
+	// merge leaves the blocks of the other standards alone.
+	_, err := s.contracts.Doc(contract).Set(ctx, map[string]interface{}{
+		"syncedBlocks": map[string]interface{}{standard: syncedBlock},
+		"synced":       time.Now(),
+		"source":       transferSourceEtherscan,
+	}, firestore.MergeAll)
+	return err
+}
+
+func (s *firestoreTransferStore) SyncedBlock(ctx context.Context, contract, standard string) (int64, error) {
+	c, err := s.contract(ctx, contract, transferSourceEtherscan)
+	if err != nil {
+		return 0, err
+	}
+	block, ok := c.SyncedBlocks[standard]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return block, nil
+}
+
+func (s *firestoreTransferStore) List(ctx context.Context, contract string) ([]Transfer, error) {
+	iter := s.transfers(contract).OrderBy("blockNumber", firestore.Asc).Documents(ctx)
+	defer iter.Stop()
+
+	var transfers []Transfer
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return transfers, err
+		}
+
+		var transfer Transfer
+		if err := doc.DataTo(&transfer); err != nil {
+			return transfers, err
+		}
+		transfers = append(transfers, transfer)
+	}
+
+	// Ordering by the transaction index too would need a composite index
+	SortTransfers(transfers)
+	return transfers, nil
+}
+
+func (s *firestoreTransferStore) AddIndexed(ctx context.Context, contract string, transfers []Transfer, checkpoint Checkpoint) error {
+	if err := s.put(ctx, contract, transfers); err != nil {
+		return err
+	}
+
+	// The checkpoint moves last, so a failed batch is indexed again
+	return s.setCheckpoint(ctx, contract, checkpoint)
+}
+
+func (s *firestoreTransferStore) Checkpoint(ctx context.Context, contract string) (Checkpoint, error) {
+	c, err := s.contract(ctx, contract, transferSourceLogs)
+	if err != nil {
+		return Checkpoint{}, err
+	}
+	if c.Checkpoint == nil {
+		return Checkpoint{}, ErrNotFound
+	}
+	return *c.Checkpoint, nil
+}
+
+func (s *firestoreTransferStore) Rollback(ctx context.Context, contract string, checkpoint Checkpoint) error {
+	if err := s.delete(ctx, s.transfers(contract).Where("blockNumber", ">", checkpoint.Block.Number)); err != nil {
+		return err
+	}
+
+	return s.setCheckpoint(ctx, contract, checkpoint)
+}
+
+// contract returns the contract's document. Transfers stored from another
+// source than source have other IDs, so they are deleted along with the
+// progress of their sync, and the contract is synced again from the start.
+func (s *firestoreTransferStore) contract(ctx context.Context, contract, source string) (firestoreContract, error) {
+	var c firestoreContract
+
+	docsnap, err := s.contracts.Doc(contract).Get(ctx)
+	if err != nil {
+		return c, adaptFirestoreError(err)
+	}
+	if err := docsnap.DataTo(&c); err != nil {
+		return c, err
+	}
+	if c.Source == source {
+		return c, nil
+	}
+
+	if err := s.delete(ctx, s.transfers(contract).Query); err != nil {
+		return c, err
+	}
+	if _, err := docsnap.Ref.Set(ctx, map[string]interface{}{"source": source}); err != nil {
+		return c, err
+	}
+	return firestoreContract{Source: source}, nil
+}
+
+// delete deletes the transfers q matches in batches
+func (s *firestoreTransferStore) delete(ctx context.Context, q firestore.Query) error {
+	iter := q.Documents(ctx)
+	defer iter.Stop()
+
+	var refs []*firestore.DocumentRef
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		refs = append(refs, doc.Ref)
+	}
+
+	for start := 0; start < len(refs); start += transferBatchSize {
+		end := start + transferBatchSize
+		if end > len(refs) {
+			end = len(refs)
+		}
+
+		batch := s.client.Batch()
+		for _, ref := range refs[start:end] {
+			batch.Delete(ref)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *firestoreTransferStore) Indexed(ctx context.Context) ([]string, error) {
+	iter := s.contracts.Documents(ctx)
+	defer iter.Stop()
+
+	var contracts []string
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return contracts, err
+		}
+
+		var c firestoreContract
+		if err := doc.DataTo(&c); err != nil {
+			return contracts, err
+		}
+		if c.Checkpoint != nil {
+			contracts = append(contracts, doc.Ref.ID)
+		}
+	}
+
+	return contracts, nil
+}
+
+// put writes transfers in batches, replacing ones with the same ID
+func (s *firestoreTransferStore) put(ctx context.Context, contract string, transfers []Transfer) error {
+	for start := 0; start < len(transfers); start += transferBatchSize {
+		end := start + transferBatchSize
+		if end > len(transfers) {
+			end = len(transfers)
+		}
+
+		batch := s.client.Batch()
+		for _, transfer := range transfers[start:end] {
+			batch.Set(s.transfers(contract).Doc(transfer.ID()), transfer)
+		}
+		if _, err := batch.Commit(ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *firestoreTransferStore) setCheckpoint(ctx context.Context, contract string, checkpoint Checkpoint) error {
+	_, err := s.contracts.Doc(contract).Set(ctx, map[string]interface{}{
+		"checkpoint": checkpoint,
+		"source":     transferSourceLogs,
+	}, firestore.MergeAll)
+	return err
+}
+
+type firestoreWalletLinkStore struct {
+	client *firestore.Client
+	links  *firestore.CollectionRef
+}
+
+func (s *firestoreWalletLinkStore) Create(ctx context.Context, link WalletLink, max int) error {
+	// Count and create in a transaction so concurrent links cannot go over max
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		docs, err := tx.Documents(s.links.Where("owner", "==", link.Owner).Limit(max)).GetAll()
+		if err != nil {
+			return err
+		}
+		if len(docs) >= max {
+			return ErrLimitReached
+		}
+		return tx.Create(s.links.Doc(link.Wallet), link)
+	})
+	return adaptFirestoreError(err)
+}
+
+func (s *firestoreWalletLinkStore) Get(ctx context.Context, wallet string) (WalletLink, error) {
+	var link WalletLink
+	docsnap, err := s.links.Doc(wallet).Get(ctx)
+	if err != nil {
+		return link, adaptFirestoreError(err)
+	}
+
+	err = docsnap.DataTo(&link)
+	return link, err
+}
+
+func (s *firestoreWalletLinkStore) ListByOwner(ctx context.Context, owner string) ([]WalletLink, error) {
+	var links []WalletLink
+
+	iter := s.links.Where("owner", "==", owner).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return links, err
+		}
+
+		var link WalletLink
+		if err := doc.DataTo(&link); err != nil {
+			return links, err
+		}
+		links = append(links, link)
+	}
+
+	// Sorted here rather than in the query so it needs no composite index
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Linked.Before(links[j].Linked)
+	})
+	return links, nil
+}
+
+func (s *firestoreWalletLinkStore) Delete(ctx context.Context, wallet string) error {
+	_, err := s.links.Doc(wallet).Delete(ctx)
+	return err
+}
+
+type firestoreFollowStore struct {
+	client  *firestore.Client
+	follows *firestore.CollectionRef
+	// counts holds the FollowCounts of each address
+	counts *firestore.CollectionRef
+}
+
+// followID is the document ID of a follow, one per follower and followee
+func followID(follower, followee string) string {
+	return follower + ":" + followee
+}
+
+func (s *firestoreFollowStore) Create(ctx context.Context, follow Follow) error {
+	err := s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		if err := tx.Create(s.follows.Doc(followID(follow.Follower, follow.Followee)), follow); err != nil {
+			return err
+		}
+		return s.count(tx, follow, 1)
+	})
+	return adaptFirestoreError(err)
+}
+
+// count adds delta to the counts of the follower and the followee
+func (s *firestoreFollowStore) count(tx *firestore.Transaction, follow Follow, delta int) error {
+	err := tx.Set(s.counts.Doc(follow.Follower), map[string]interface{}{
+		"following": firestore.Increment(delta),
+	}, firestore.MergeAll)
+	if err != nil {
+		return err
+	}
+	return tx.Set(s.counts.Doc(follow.Followee), map[string]interface{}{
+		"followers": firestore.Increment(delta),
+	}, firestore.MergeAll)
+}
+
+func (s *firestoreFollowStore) Counts(ctx context.Context, address string) (FollowCounts, error) {
+	var counts FollowCounts
+	docsnap, err := s.counts.Doc(address).Get(ctx)
+	if status.Code(err) == codes.NotFound {
+		return counts, nil
+	}
+	if err != nil {
+		return counts, err
+	}
+
+	err = docsnap.DataTo(&counts)
+	return counts, err
+}
+
+func (s *firestoreFollowStore) Get(ctx context.Context, follower, followee string) (Follow, error) {
+	var follow Follow
+	docsnap, err := s.follows.Doc(followID(follower, followee)).Get(ctx)
+	if err != nil {
+		return follow, adaptFirestoreError(err)
+	}
+
+	err = docsnap.DataTo(&follow)
+	return follow, err
+}
+
+func (s *firestoreFollowStore) Following(ctx context.Context, follower string) ([]Follow, error) {
+	return s.list(ctx, "follower", follower)
+}
+
+func (s *firestoreFollowStore) Followers(ctx context.Context, followee string) ([]Follow, error) {
+	return s.list(ctx, "followee", followee)
+}
+
+func (s *firestoreFollowStore) list(ctx context.Context, field, address string) ([]Follow, error) {
+	var follows []Follow
+
+	iter := s.follows.Where(field, "==", address).Documents(ctx)
+	defer iter.Stop()
+
+	for {
+		doc, err := iter.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return follows, err
+		}
+
+		var follow Follow
+		if err := doc.DataTo(&follow); err != nil {
+			return follows, err
+		}
+		follows = append(follows, follow)
+	}
+
+	// Sorted here rather than in the query so it needs no composite index
+	sort.Slice(follows, func(i, j int) bool {
+		return follows[i].Created.Before(follows[j].Created)
+	})
+	return follows, nil
+}
+
+func (s *firestoreFollowStore) Delete(ctx context.Context, follower, followee string) error {
+	doc := s.follows.Doc(followID(follower, followee))
+
+	return s.client.RunTransaction(ctx, func(ctx context.Context, tx *firestore.Transaction) error {
+		// Only count follows that exist
+		if _, err := tx.Get(doc); status.Code(err) == codes.NotFound {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		if err := tx.Delete(doc); err != nil {
+			return err
+		}
+		return s.count(tx, Follow{Follower: follower, Followee: followee}, -1)
+	})
+}
@@ -0,0 +1,815 @@
+package database
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	sweeperdb "github.com/mager/sweeper/database"
+)
+
+// MemorySeed is the JSON fixture format used to populate the in-memory database
+type MemorySeed struct {
+	Users        map[string]User                 `json:"users"`
+	Collections  map[string]sweeperdb.Collection `json:"collections"`
+	Features     map[string]json.RawMessage      `json:"features"`
+	Applications map[string]Application          `json:"applications"`
+	Stats        map[string][]CollectionStat     `json:"stats"`
+}
+
+// NewMemoryDatabase returns a DatabaseClient that keeps everything in memory
+func NewMemoryDatabase(seed MemorySeed) *DatabaseClient {
+	m := &memoryDB{
+		users:        make(map[string]User),
+		collections:  make(map[string]sweeperdb.Collection),
+		features:     make(map[string]json.RawMessage),
+		applications: make(map[string]Application),
+		nonces:       make(map[string]time.Time),
+		sessions:     make(map[string]Session),
+		stats:        make(map[string][]CollectionStat),
+		portfolios:   make(map[string][]PortfolioSnapshot),
+		transfers:    make(map[string]*memoryContract),
+		walletLinks:  make(map[string]WalletLink),
+		follows:      make(map[string]Follow),
+	}
+
+	for address, user := range seed.Users {
+		m.users[address] = user
+	}
+	for slug, collection := range seed.Collections {
+		if collection.Slug == "" {
+			collection.Slug = slug
+		}
+		m.collections[slug] = collection
+	}
+	for id, feature := range seed.Features {
+		m.features[id] = feature
+	}
+	for id, app := range seed.Applications {
+		m.applications[id] = app
+	}
+	statStore := &memoryStatStore{m}
+	for slug, stats := range seed.Stats {
+		for _, stat := range stats {
+			statStore.Add(context.Background(), slug, stat)
+		}
+	}
+
+	return &DatabaseClient{
+		Users:        &memoryUserStore{m},
+		Collections:  &memoryCollectionStore{m},
+		Features:     &memoryFeatureStore{m},
+		Applications: &memoryApplicationStore{m},
+		Nonces:       &memoryNonceStore{m},
+		Sessions:     &memorySessionStore{m},
+		Stats:        statStore,
+		Portfolios:   &memoryPortfolioStore{m},
+		Transfers:    &memoryTransferStore{m},
+		WalletLinks:  &memoryWalletLinkStore{m},
+		Follows:      &memoryFollowStore{m},
+	}
+}
+
+// LoadMemorySeed reads a MemorySeed from a JSON file
+func LoadMemorySeed(path string) (MemorySeed, error) {
+	var seed MemorySeed
+
+	f, err := os.Open(path)
+	if err != nil {
+		return seed, err
+	}
+	defer f.Close()
+
+	err = json.NewDecoder(f).Decode(&seed)
+	return seed, err
+}
+
+type memoryDB struct {
+	mu           sync.RWMutex
+	users        map[string]User
+	collections  map[string]sweeperdb.Collection
+	features     map[string]json.RawMessage
+	applications map[string]Application
+	nonces       map[string]time.Time
+	sessions     map[string]Session
+	// stats are kept sorted by timestamp
+	stats map[string][]CollectionStat
+	// portfolios are kept sorted by timestamp
+	portfolios map[string][]PortfolioSnapshot
+	transfers  map[string]*memoryContract
+	// walletLinks are keyed by the linked wallet
+	walletLinks map[string]WalletLink
+	// follows are keyed by followID
+	follows map[string]Follow
+}
+
+type memoryContract struct {
+	// syncedBlocks is keyed by token standard
+	syncedBlocks map[string]int64
+	checkpoint   *Checkpoint
+	// transfers are keyed by ID, index holds their order of arrival
+	transfers map[string]Transfer
+	index     []string
+}
+
+type memoryUserStore struct {
+	*memoryDB
+}
+
+func (s *memoryUserStore) Get(ctx context.Context, address string) (User, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	user, ok := s.users[address]
+	if !ok {
+		return user, ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *memoryUserStore) Create(ctx context.Context, address string, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.users[address]; ok {
+		return ErrAlreadyExists
+	}
+	s.users[address] = user
+	return nil
+}
+
+func (s *memoryUserStore) Set(ctx context.Context, address string, user User) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.users[address] = user
+	return nil
+}
+
+func (s *memoryUserStore) List(ctx context.Context) ([]UserRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []UserRecord
+	for address, user := range s.users {
+		records = append(records, UserRecord{Address: address, User: user})
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Address < records[j].Address
+	})
+
+	return records, nil
+}
+
+func (s *memoryUserStore) UpdateAvatar(ctx context.Context, address string, avatar *Avatar) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[address]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Avatar = avatar
+	user.Photo = avatar != nil
+	s.users[address] = user
+	return nil
+}
+
+func (s *memoryUserStore) UpdateCurrency(ctx context.Context, address, currency string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[address]
+	if !ok {
+		return ErrNotFound
+	}
+	user.Currency = currency
+	s.users[address] = user
+	return nil
+}
+
+func (s *memoryUserStore) ListByAvatarSource(ctx context.Context, source string) ([]UserRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []UserRecord
+	for address, user := range s.users {
+		if user.Avatar != nil && user.Avatar.Source == source {
+			records = append(records, UserRecord{Address: address, User: user})
+		}
+	}
+
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Address < records[j].Address
+	})
+
+	return records, nil
+}
+
+func (s *memoryUserStore) ListFrens(ctx context.Context) ([]UserRecord, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []UserRecord
+	for address, user := range s.users {
+		if user.IsFren && user.Photo {
+			records = append(records, UserRecord{Address: address, User: user})
+		}
+	}
+
+	// Match Firestore, which returns documents ordered by ID
+	sort.Slice(records, func(i, j int) bool {
+		return records[i].Address < records[j].Address
+	})
+
+	return records, nil
+}
+
+type memoryCollectionStore struct {
+	*memoryDB
+}
+
+func (s *memoryCollectionStore) Get(ctx context.Context, slug string) (sweeperdb.Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	collection, ok := s.collections[slug]
+	if !ok {
+		return collection, ErrNotFound
+	}
+	return collection, nil
+}
+
+func (s *memoryCollectionStore) GetAll(ctx context.Context, slugs []string) ([]sweeperdb.Collection, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var collections []sweeperdb.Collection
+	for _, slug := range slugs {
+		if collection, ok := s.collections[slug]; ok {
+			collections = append(collections, collection)
+		}
+	}
+	return collections, nil
+}
+
+func (s *memoryCollectionStore) List(ctx context.Context) ([]sweeperdb.Collection, error) {
+	return s.filter(func(c sweeperdb.Collection) bool { return true }), nil
+}
+
+func (s *memoryCollectionStore) TopByWeeklyVolume(ctx context.Context, limit int) ([]sweeperdb.Collection, error) {
+	collections := s.filter(func(c sweeperdb.Collection) bool { return true })
+
+	sort.SliceStable(collections, func(i, j int) bool {
+		return collections[i].SevenDayVolume > collections[j].SevenDayVolume
+	})
+	if len(collections) > limit {
+		collections = collections[:limit]
+	}
+
+	return collections, nil
+}
+
+func (s *memoryCollectionStore) SearchBySlugPrefix(ctx context.Context, prefix string) ([]sweeperdb.Collection, error) {
+	return s.filter(func(c sweeperdb.Collection) bool {
+		return strings.HasPrefix(c.Slug, prefix)
+	}), nil
+}
+
+// filter returns the matching collections ordered by slug
+func (s *memoryCollectionStore) filter(match func(sweeperdb.Collection) bool) []sweeperdb.Collection {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var collections []sweeperdb.Collection
+	for _, collection := range s.collections {
+		if match(collection) {
+			collections = append(collections, collection)
+		}
+	}
+
+	sort.Slice(collections, func(i, j int) bool {
+		return collections[i].Slug < collections[j].Slug
+	})
+
+	return collections
+}
+
+type memoryFeatureStore struct {
+	*memoryDB
+}
+
+func (s *memoryFeatureStore) Get(ctx context.Context, id string, v interface{}) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	feature, ok := s.features[id]
+	if !ok {
+		return ErrNotFound
+	}
+	return json.Unmarshal(feature, v)
+}
+
+type memoryApplicationStore struct {
+	*memoryDB
+}
+
+func (s *memoryApplicationStore) Get(ctx context.Context, id string) (Application, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	app, ok := s.applications[id]
+	if !ok {
+		return app, ErrNotFound
+	}
+	return app, nil
+}
+
+func (s *memoryApplicationStore) Create(ctx context.Context, id string, app Application) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.applications[id]; ok {
+		return ErrAlreadyExists
+	}
+	s.applications[id] = app
+	return nil
+}
+
+func (s *memoryApplicationStore) Update(ctx context.Context, id string, update func(*Application) error) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	app, ok := s.applications[id]
+	if !ok {
+		return ErrNotFound
+	}
+	// Keys are copied so a failed update leaves the stored ones untouched
+	app.Keys = append([]APIKey(nil), app.Keys...)
+	if err := update(&app); err != nil {
+		return err
+	}
+	s.applications[id] = app
+	return nil
+}
+
+func (s *memoryApplicationStore) List(ctx context.Context) (map[string]Application, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	apps := make(map[string]Application, len(s.applications))
+	for id, app := range s.applications {
+		apps[id] = app
+	}
+	return apps, nil
+}
+
+type memoryNonceStore struct {
+	*memoryDB
+}
+
+func (s *memoryNonceStore) Create(ctx context.Context, nonce string, expires time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.nonces[nonce]; ok {
+		return ErrAlreadyExists
+	}
+	s.nonces[nonce] = expires
+	return nil
+}
+
+func (s *memoryNonceStore) Consume(ctx context.Context, nonce string) (time.Time, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires, ok := s.nonces[nonce]
+	if !ok {
+		return expires, ErrNotFound
+	}
+	delete(s.nonces, nonce)
+	return expires, nil
+}
+
+type memorySessionStore struct {
+	*memoryDB
+}
+
+func (s *memorySessionStore) Create(ctx context.Context, id string, session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.sessions[id]; ok {
+		return ErrAlreadyExists
+	}
+	s.sessions[id] = session
+	return nil
+}
+
+func (s *memorySessionStore) Get(ctx context.Context, id string) (Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return session, ErrNotFound
+	}
+	return session, nil
+}
+
+func (s *memorySessionStore) Delete(ctx context.Context, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, id)
+	return nil
+}
+
+type memoryStatStore struct {
+	*memoryDB
+}
+
+func (s *memoryStatStore) Add(ctx context.Context, slug string, stat CollectionStat) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Firestore keys snapshots by the second
+	stat.Timestamp = stat.Timestamp.Truncate(time.Second)
+
+	stats := s.stats[slug]
+	i := sort.Search(len(stats), func(i int) bool {
+		return !stats[i].Timestamp.Before(stat.Timestamp)
+	})
+	if i < len(stats) && stats[i].Timestamp.Equal(stat.Timestamp) {
+		stats[i] = stat
+		return nil
+	}
+
+	stats = append(stats, CollectionStat{})
+	copy(stats[i+1:], stats[i:])
+	stats[i] = stat
+	s.stats[slug] = stats
+	return nil
+}
+
+func (s *memoryStatStore) Range(ctx context.Context, slug string, from, to time.Time) ([]CollectionStat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var stats []CollectionStat
+	for _, stat := range s.stats[slug] {
+		if stat.Timestamp.Before(from) || !stat.Timestamp.Before(to) {
+			continue
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+func (s *memoryStatStore) Latest(ctx context.Context, slug string) (CollectionStat, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stats := s.stats[slug]
+	if len(stats) == 0 {
+		return CollectionStat{}, ErrNotFound
+	}
+	return stats[len(stats)-1], nil
+}
+
+type memoryPortfolioStore struct {
+	*memoryDB
+}
+
+func (s *memoryPortfolioStore) Add(ctx context.Context, address string, snapshot PortfolioSnapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.add(address, snapshot)
+	return nil
+}
+
+func (s *memoryPortfolioStore) AddIfDue(ctx context.Context, address string, snapshot PortfolioSnapshot, due func(latest *PortfolioSnapshot) bool) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var latest *PortfolioSnapshot
+	if snapshots := s.portfolios[address]; len(snapshots) > 0 {
+		latest = &snapshots[len(snapshots)-1]
+	}
+	if !due(latest) {
+		return false, nil
+	}
+
+	s.add(address, snapshot)
+	return true, nil
+}
+
+// add inserts snapshot in timestamp order, the caller holds mu
+func (s *memoryPortfolioStore) add(address string, snapshot PortfolioSnapshot) {
+	// Firestore keys snapshots by the second
+	snapshot.Timestamp = snapshot.Timestamp.Truncate(time.Second)
+
+	snapshots := s.portfolios[address]
+	i := sort.Search(len(snapshots), func(i int) bool {
+		return !snapshots[i].Timestamp.Before(snapshot.Timestamp)
+	})
+	if i < len(snapshots) && snapshots[i].Timestamp.Equal(snapshot.Timestamp) {
+		snapshots[i] = snapshot
+		return
+	}
+
+	snapshots = append(snapshots, PortfolioSnapshot{})
+	copy(snapshots[i+1:], snapshots[i:])
+	snapshots[i] = snapshot
+	s.portfolios[address] = snapshots
+}
+
+func (s *memoryPortfolioStore) Range(ctx context.Context, address string, from, to time.Time) ([]PortfolioSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var snapshots []PortfolioSnapshot
+	for _, snapshot := range s.portfolios[address] {
+		if snapshot.Timestamp.Before(from) || !snapshot.Timestamp.Before(to) {
+			continue
+		}
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, nil
+}
+
+func (s *memoryPortfolioStore) Latest(ctx context.Context, address string) (PortfolioSnapshot, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshots := s.portfolios[address]
+	if len(snapshots) == 0 {
+		return PortfolioSnapshot{}, ErrNotFound
+	}
+	return snapshots[len(snapshots)-1], nil
+}
+
+type memoryTransferStore struct {
+	*memoryDB
+}
+
+func (s *memoryTransferStore) Add(ctx context.Context, contract, standard string, transfers []Transfer, syncedBlock int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.contract(contract)
+	c.put(transfers)
+	c.syncedBlocks[standard] = syncedBlock
+	return nil
+}
+
+func (s *memoryTransferStore) SyncedBlock(ctx context.Context, contract, standard string) (int64, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.memoryDB.transfers[contract]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	block, ok := c.syncedBlocks[standard]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	return block, nil
+}
+
+func (s *memoryTransferStore) List(ctx context.Context, contract string) ([]Transfer, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.memoryDB.transfers[contract]
+	if !ok {
+		return nil, nil
+	}
+
+	transfers := make([]Transfer, 0, len(c.index))
+	for _, id := range c.index {
+		transfers = append(transfers, c.transfers[id])
+	}
+	SortTransfers(transfers)
+	return transfers, nil
+}
+
+func (s *memoryTransferStore) AddIndexed(ctx context.Context, contract string, transfers []Transfer, checkpoint Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.contract(contract)
+	c.put(transfers)
+	c.checkpoint = &checkpoint
+	return nil
+}
+
+func (s *memoryTransferStore) Checkpoint(ctx context.Context, contract string) (Checkpoint, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	c, ok := s.memoryDB.transfers[contract]
+	if !ok || c.checkpoint == nil {
+		return Checkpoint{}, ErrNotFound
+	}
+	return *c.checkpoint, nil
+}
+
+func (s *memoryTransferStore) Rollback(ctx context.Context, contract string, checkpoint Checkpoint) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c := s.contract(contract)
+	index := c.index[:0]
+	for _, id := range c.index {
+		if c.transfers[id].BlockNumber > checkpoint.Block.Number {
+			delete(c.transfers, id)
+			continue
+		}
+		index = append(index, id)
+	}
+	c.index = index
+	c.checkpoint = &checkpoint
+	return nil
+}
+
+func (s *memoryTransferStore) Indexed(ctx context.Context) ([]string, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var contracts []string
+	for contract, c := range s.memoryDB.transfers {
+		if c.checkpoint != nil {
+			contracts = append(contracts, contract)
+		}
+	}
+	sort.Strings(contracts)
+	return contracts, nil
+}
+
+// contract returns the contract, adding it when it is new. The caller holds
+// the write lock.
+func (s *memoryTransferStore) contract(contract string) *memoryContract {
+	c, ok := s.memoryDB.transfers[contract]
+	if !ok {
+		c = &memoryContract{
+			syncedBlocks: make(map[string]int64),
+			transfers:    make(map[string]Transfer),
+		}
+		s.memoryDB.transfers[contract] = c
+	}
+	return c
+}
+
+func (c *memoryContract) put(transfers []Transfer) {
+	for _, transfer := range transfers {
+		id := transfer.ID()
+		if _, ok := c.transfers[id]; !ok {
+			c.index = append(c.index, id)
+		}
+		c.transfers[id] = transfer
+	}
+}
+
+type memoryWalletLinkStore struct {
+	*memoryDB
+}
+
+func (s *memoryWalletLinkStore) Create(ctx context.Context, link WalletLink, max int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.walletLinks[link.Wallet]; ok {
+		return ErrAlreadyExists
+	}
+	var links int
+	for _, l := range s.walletLinks {
+		if l.Owner == link.Owner {
+			links++
+		}
+	}
+	if links >= max {
+		return ErrLimitReached
+	}
+	s.walletLinks[link.Wallet] = link
+	return nil
+}
+
+func (s *memoryWalletLinkStore) Get(ctx context.Context, wallet string) (WalletLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	link, ok := s.walletLinks[wallet]
+	if !ok {
+		return link, ErrNotFound
+	}
+	return link, nil
+}
+
+func (s *memoryWalletLinkStore) ListByOwner(ctx context.Context, owner string) ([]WalletLink, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var links []WalletLink
+	for _, link := range s.walletLinks {
+		if link.Owner == owner {
+			links = append(links, link)
+		}
+	}
+
+	sort.Slice(links, func(i, j int) bool {
+		return links[i].Linked.Before(links[j].Linked)
+	})
+	return links, nil
+}
+
+func (s *memoryWalletLinkStore) Delete(ctx context.Context, wallet string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.walletLinks, wallet)
+	return nil
+}
+
+type memoryFollowStore struct {
+	*memoryDB
+}
+
+func (s *memoryFollowStore) Create(ctx context.Context, follow Follow) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	id := followID(follow.Follower, follow.Followee)
+	if _, ok := s.follows[id]; ok {
+		return ErrAlreadyExists
+	}
+	s.follows[id] = follow
+	return nil
+}
+
+func (s *memoryFollowStore) Get(ctx context.Context, follower, followee string) (Follow, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	follow, ok := s.follows[followID(follower, followee)]
+	if !ok {
+		return follow, ErrNotFound
+	}
+	return follow, nil
+}
+
+func (s *memoryFollowStore) Following(ctx context.Context, follower string) ([]Follow, error) {
+	return s.list(func(f Follow) bool { return f.Follower == follower }), nil
+}
+
+func (s *memoryFollowStore) Followers(ctx context.Context, followee string) ([]Follow, error) {
+	return s.list(func(f Follow) bool { return f.Followee == followee }), nil
+}
+
+func (s *memoryFollowStore) Counts(ctx context.Context, address string) (FollowCounts, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var counts FollowCounts
+	for _, follow := range s.follows {
+		if follow.Followee == address {
+			counts.Followers++
+		}
+		if follow.Follower == address {
+			counts.Following++
+		}
+	}
+	return counts, nil
+}
+
+func (s *memoryFollowStore) list(match func(Follow) bool) []Follow {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var follows []Follow
+	for _, follow := range s.follows {
+		if match(follow) {
+			follows = append(follows, follow)
+		}
+	}
+
+	sort.Slice(follows, func(i, j int) bool {
+		return follows[i].Created.Before(follows[j].Created)
+	})
+	return follows
+}
+
+func (s *memoryFollowStore) Delete(ctx context.Context, follower, followee string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.follows, followID(follower, followee))
+	return nil
+}
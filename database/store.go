@@ -0,0 +1,161 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	sweeperdb "github.com/mager/sweeper/database"
+)
+
+var (
+	// ErrNotFound is returned by the stores when a document does not exist
+	ErrNotFound = errors.New("not_found")
+	// ErrAlreadyExists is returned when creating a document that already exists
+	ErrAlreadyExists = errors.New("already_exists")
+	// ErrLimitReached is returned when creating a document would go over a limit
+	ErrLimitReached = errors.New("limit_reached")
+)
+
+// UserRecord is a user along with the address it is stored under
+type UserRecord struct {
+	Address string
+	User    User
+}
+
+// UserStore persists users keyed by their lowercase address
+type UserStore interface {
+	Get(ctx context.Context, address string) (User, error)
+	Create(ctx context.Context, address string, user User) error
+	Set(ctx context.Context, address string, user User) error
+	ListFrens(ctx context.Context) ([]UserRecord, error)
+	List(ctx context.Context) ([]UserRecord, error)
+	// UpdateAvatar replaces the user's avatar and sets Photo accordingly,
+	// a nil avatar removes it
+	UpdateAvatar(ctx context.Context, address string, avatar *Avatar) error
+	ListByAvatarSource(ctx context.Context, source string) ([]UserRecord, error)
+	// UpdateCurrency sets the user's default fiat currency, an empty
+	// currency removes it
+	UpdateCurrency(ctx context.Context, address, currency string) error
+}
+
+// CollectionStore persists collections keyed by their OpenSea slug
+type CollectionStore interface {
+	Get(ctx context.Context, slug string) (sweeperdb.Collection, error)
+	// GetAll returns the collections that exist for the given slugs, in order
+	GetAll(ctx context.Context, slugs []string) ([]sweeperdb.Collection, error)
+	List(ctx context.Context) ([]sweeperdb.Collection, error)
+	TopByWeeklyVolume(ctx context.Context, limit int) ([]sweeperdb.Collection, error)
+	SearchBySlugPrefix(ctx context.Context, prefix string) ([]sweeperdb.Collection, error)
+}
+
+// FeatureStore holds the singleton documents used by the home page
+type FeatureStore interface {
+	Get(ctx context.Context, id string, v interface{}) error
+}
+
+// ApplicationStore holds the third-party applications allowed to call the API
+type ApplicationStore interface {
+	Get(ctx context.Context, id string) (Application, error)
+	Create(ctx context.Context, id string, app Application) error
+	// Update applies update to the stored application atomically, it
+	// returns ErrNotFound when there is no such application
+	Update(ctx context.Context, id string, update func(*Application) error) error
+	List(ctx context.Context) (map[string]Application, error)
+}
+
+// NonceStore holds single-use sign-in nonces
+type NonceStore interface {
+	Create(ctx context.Context, nonce string, expires time.Time) error
+	// Consume deletes the nonce and returns its expiry, it returns
+	// ErrNotFound if the nonce was never issued or was already used
+	Consume(ctx context.Context, nonce string) (time.Time, error)
+}
+
+// SessionStore holds sign-in sessions keyed by the hash of their token
+type SessionStore interface {
+	Create(ctx context.Context, id string, session Session) error
+	Get(ctx context.Context, id string) (Session, error)
+	Delete(ctx context.Context, id string) error
+}
+
+// StatStore holds the stat snapshots of each collection
+type StatStore interface {
+	// Add records a snapshot, snapshots with the same timestamp are replaced
+	Add(ctx context.Context, slug string, stat CollectionStat) error
+	// Range returns the snapshots taken in [from, to), oldest first. A zero
+	// from means since the first snapshot.
+	Range(ctx context.Context, slug string, from, to time.Time) ([]CollectionStat, error)
+	// Latest returns the most recent snapshot or ErrNotFound
+	Latest(ctx context.Context, slug string) (CollectionStat, error)
+}
+
+// TransferStore holds the NFT transfers of each contract along with the block
+// each token standard is synced up to
+type TransferStore interface {
+	// Add stores transfers, replacing ones with the same ID, then moves the
+	// contract's synced block for standard to syncedBlock
+	Add(ctx context.Context, contract, standard string, transfers []Transfer, syncedBlock int64) error
+	// SyncedBlock returns the block the contract's transfers of standard are
+	// synced up to, or ErrNotFound when they were never synced
+	SyncedBlock(ctx context.Context, contract, standard string) (int64, error)
+	// List returns the contract's transfers, oldest first
+	List(ctx context.Context, contract string) ([]Transfer, error)
+
+	// AddIndexed stores transfers read from the chain's logs, then moves the
+	// contract's checkpoint to checkpoint
+	AddIndexed(ctx context.Context, contract string, transfers []Transfer, checkpoint Checkpoint) error
+	// Checkpoint returns how far the contract's logs are indexed, or
+	// ErrNotFound when they were never indexed
+	Checkpoint(ctx context.Context, contract string) (Checkpoint, error)
+	// Rollback deletes the contract's transfers after the checkpoint's block
+	// and moves the checkpoint back to it
+	Rollback(ctx context.Context, contract string, checkpoint Checkpoint) error
+	// Indexed returns the contracts that have a checkpoint
+	Indexed(ctx context.Context) ([]string, error)
+}
+
+// PortfolioStore holds the portfolio snapshots of each user
+type PortfolioStore interface {
+	Add(ctx context.Context, address string, snapshot PortfolioSnapshot) error
+	// Range returns the snapshots taken in [from, to), oldest first. A zero
+	// from means since the first snapshot.
+	Range(ctx context.Context, address string, from, to time.Time) ([]PortfolioSnapshot, error)
+	// Latest returns the most recent snapshot or ErrNotFound
+	Latest(ctx context.Context, address string) (PortfolioSnapshot, error)
+	// AddIfDue adds snapshot when due reports that the latest one, nil when
+	// there is none, is due to be replaced. The check and the write are
+	// atomic so concurrent recorders add one snapshot.
+	AddIfDue(ctx context.Context, address string, snapshot PortfolioSnapshot, due func(latest *PortfolioSnapshot) bool) (bool, error)
+}
+
+// WalletLinkStore holds the wallets linked to a profile, keyed by the
+// lowercase address of the linked wallet so it belongs to one profile
+type WalletLinkStore interface {
+	// Create links a wallet, it returns ErrAlreadyExists when the wallet is
+	// already linked to a profile and ErrLimitReached when the owner already
+	// has max linked wallets
+	Create(ctx context.Context, link WalletLink, max int) error
+	// Get returns the link of wallet or ErrNotFound
+	Get(ctx context.Context, wallet string) (WalletLink, error)
+	// ListByOwner returns the wallets linked to owner, oldest link first
+	ListByOwner(ctx context.Context, owner string) ([]WalletLink, error)
+	Delete(ctx context.Context, wallet string) error
+}
+
+// FollowStore holds the wallets each profile follows, by lowercase address
+type FollowStore interface {
+	// Create returns ErrAlreadyExists when the follower already follows the
+	// followee
+	Create(ctx context.Context, follow Follow) error
+	// Get returns the follow of followee by follower or ErrNotFound
+	Get(ctx context.Context, follower, followee string) (Follow, error)
+	// Following returns the follows of follower, oldest first
+	Following(ctx context.Context, follower string) ([]Follow, error)
+	// Followers returns the follows of followee, oldest first
+	Followers(ctx context.Context, followee string) ([]Follow, error)
+	// Counts returns how many profiles follow address and how many wallets
+	// it follows
+	Counts(ctx context.Context, address string) (FollowCounts, error)
+	Delete(ctx context.Context, follower, followee string) error
+}
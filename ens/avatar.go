@@ -0,0 +1,79 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/mager/keiko/nft"
+)
+
+// mainnetChainID is the only chain NFT avatars are read from
+const mainnetChainID = "1"
+
+// nftAvatarPattern matches ENSIP-12 NFT avatars, e.g.
+// eip155:1/erc721:0xb47e3cd837ddf8e4c57f05d70ab865de6e193bbb/0
+var nftAvatarPattern = regexp.MustCompile(`^eip155:(\d+)/(erc721|erc1155):(0x[0-9a-fA-F]{40})/(\d+)$`)
+
+var (
+	ErrUnsupportedAvatar = errors.New("unsupported_avatar")
+	// ErrAvatarNotOwned is returned for NFT avatars the address does not
+	// hold, which ENSIP-12 says must not be shown
+	ErrAvatarNotOwned = errors.New("avatar_not_owned")
+)
+
+// avatarURL returns a URL an <img> can show for the avatar record of owner,
+// per ENSIP-12. HTTP(S), IPFS, Arweave and data URIs are used directly, NFT
+// avatars are checked to be held by owner and then read from the token
+// metadata.
+func (s *Service) avatarURL(ctx context.Context, owner, record string) (string, error) {
+	record = strings.TrimSpace(record)
+
+	if m := nftAvatarPattern.FindStringSubmatch(strings.ToLower(record)); m != nil {
+		return s.nftAvatarURL(ctx, owner, m[1], m[2], m[3], m[4])
+	}
+
+	if strings.HasPrefix(record, "data:image/") {
+		return record, nil
+	}
+	link := nft.GatewayURL(record)
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedAvatar, record)
+	}
+	return link, nil
+}
+
+func (s *Service) nftAvatarURL(ctx context.Context, owner, chainID, standard, contract, id string) (string, error) {
+	if chainID != mainnetChainID {
+		return "", fmt.Errorf("%w: chain %s", ErrUnsupportedAvatar, chainID)
+	}
+	tokenID, ok := new(big.Int).SetString(id, 10)
+	if !ok {
+		return "", fmt.Errorf("%w: token ID %q", ErrUnsupportedAvatar, id)
+	}
+
+	owns, err := s.nft.Owns(ctx, standard, common.HexToAddress(owner), common.HexToAddress(contract), tokenID)
+	if err != nil {
+		return "", err
+	}
+	if !owns {
+		return "", ErrAvatarNotOwned
+	}
+
+	uri, err := s.nft.TokenURI(ctx, standard, common.HexToAddress(contract), tokenID)
+	if err != nil {
+		return "", err
+	}
+	md, err := s.nft.Metadata(ctx, uri)
+	if err != nil {
+		return "", err
+	}
+
+	return md.ImageLink()
+}
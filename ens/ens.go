@@ -0,0 +1,173 @@
+package ens
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/infura"
+	"github.com/mager/keiko/nft"
+	goens "github.com/wealdtech/go-ens/v3"
+	"go.uber.org/zap"
+)
+
+// Text record keys, per ENSIP-5
+const (
+	keyAvatar      = "avatar"
+	keyURL         = "url"
+	keyTwitter     = "com.twitter"
+	keyGitHub      = "com.github"
+	keyDescription = "description"
+)
+
+// Profile is the ENS profile of an address
+type Profile struct {
+	Address string
+	// Name is the primary name, only set when it resolves back to Address
+	Name string
+	// Avatar is the avatar record and AvatarURL the image it points to
+	Avatar      string
+	AvatarURL   string
+	URL         string
+	Twitter     string
+	GitHub      string
+	Description string
+	// ContentHash is in EIP-1577 text format, e.g. /ipfs/<cid>
+	ContentHash string
+}
+
+// Service resolves ENS profiles through Infura
+type Service struct {
+	infura *infura.InfuraClient
+	nft    *nft.Client
+	cache  *cache.Group
+	logger *zap.SugaredLogger
+}
+
+// ProvideENS provides an ENS Service that caches profiles for the ENSTTL
+func ProvideENS(cfg config.Config, logger *zap.SugaredLogger, infuraClient *infura.InfuraClient, c *cache.Cache) *Service {
+	return NewService(
+		infuraClient,
+		nft.NewClient(infuraClient.Client, logger),
+		c.Group("ensprofile", cache.Policy{
+			TTL:         cfg.ENSTTL,
+			NegativeTTL: cfg.CacheNegativeTTL,
+			StaleTTL:    cfg.CacheStaleTTL,
+		}),
+		logger,
+	)
+}
+
+var Options = ProvideENS
+
+// NewService creates an ENS Service
+func NewService(infuraClient *infura.InfuraClient, nftClient *nft.Client, group *cache.Group, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		infura: infuraClient,
+		nft:    nftClient,
+		cache:  group,
+		logger: logger,
+	}
+}
+
+// PrimaryName returns the reverse record of address once it is verified to
+// resolve back to address. Addresses without one, or with a name pointing
+// elsewhere, are apierror.ErrNotFound.
+func (s *Service) PrimaryName(address string) (string, error) {
+	name, err := s.infura.GetENSNameFromAddress(address)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := s.infura.GetAddressFromENSName(name)
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(resolved, address) {
+		return "", apierror.Errorf(apierror.CodeNotFound, "ens: %s does not resolve to %s", name, address)
+	}
+
+	return name, nil
+}
+
+// Profile returns the ENS profile of address. An address without a verified
+// primary name has an empty profile. A broken avatar only leaves AvatarURL
+// empty.
+func (s *Service) Profile(ctx context.Context, address string) (Profile, error) {
+	address = strings.ToLower(address)
+
+	v, err := s.cache.Get(ctx, address, func(ctx context.Context) (interface{}, error) {
+		return s.fetchProfile(ctx, address)
+	})
+	if err != nil {
+		return Profile{}, err
+	}
+
+	return v.(Profile), nil
+}
+
+func (s *Service) fetchProfile(ctx context.Context, address string) (Profile, error) {
+	p := Profile{Address: address}
+
+	name, err := s.PrimaryName(address)
+	if errors.Is(err, apierror.ErrNotFound) {
+		return p, nil
+	}
+	if err != nil {
+		return p, err
+	}
+	p.Name = name
+
+	resolver, err := goens.NewResolver(s.infura.Client, name)
+	if err != nil {
+		return p, apierror.Unreachable("infura", err)
+	}
+
+	for _, record := range []struct {
+		key   string
+		value *string
+	}{
+		{keyAvatar, &p.Avatar},
+		{keyURL, &p.URL},
+		{keyTwitter, &p.Twitter},
+		{keyGitHub, &p.GitHub},
+		{keyDescription, &p.Description},
+	} {
+		value, err := resolver.Text(record.key)
+		if isRevert(err) {
+			// Old resolvers have no text records
+			break
+		}
+		if err != nil {
+			return p, apierror.Unreachable("infura", err)
+		}
+		*record.value = value
+	}
+
+	contenthash, err := resolver.Contenthash()
+	switch {
+	case isRevert(err):
+	case err != nil:
+		return p, apierror.Unreachable("infura", err)
+	case len(contenthash) > 0:
+		if p.ContentHash, err = goens.ContenthashToString(contenthash); err != nil {
+			s.logger.Warnw("Invalid ENS contenthash", "name", name, "error", err)
+		}
+	}
+
+	if p.Avatar != "" {
+		p.AvatarURL, err = s.avatarURL(ctx, address, p.Avatar)
+		if err != nil {
+			s.logger.Warnw("Failed to resolve ENS avatar", "name", name, "avatar", p.Avatar, "error", err)
+		}
+	}
+
+	return p, nil
+}
+
+func isRevert(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "revert")
+}
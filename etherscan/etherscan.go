@@ -1,13 +1,18 @@
 package etherscan
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/cassette"
 	"github.com/mager/keiko/config"
 	etherscan "github.com/nanmu42/etherscan-api"
 	"go.uber.org/zap"
@@ -16,82 +21,306 @@ import (
 type EtherscanClient struct {
 	Client     *etherscan.Client
 	apiKey     string
+	baseURL    string
 	httpClient *http.Client
 	logger     *zap.SugaredLogger
+	maxRetries int
+	retryDelay time.Duration
 }
 
 func ProvideEtherscan(cfg config.Config, logger *zap.SugaredLogger) *EtherscanClient {
-	client := etherscan.New(etherscan.Mainnet, cfg.EtherscanAPIKey)
+	tr, err := cassette.Transport(cfg, "etherscan", nil)
+	if err != nil {
+		logger.Fatalw("Failed to set up the Etherscan transport", "error", err)
+	}
+	httpClient := &http.Client{
+		Transport: tr,
+		Timeout:   5 * time.Second,
+	}
+
+	client := etherscan.NewCustomized(etherscan.Customization{
+		Key:     cfg.EtherscanAPIKey,
+		BaseURL: cfg.EtherscanBaseURL + "?",
+		Client:  httpClient,
+	})
 
 	return &EtherscanClient{
-		Client: client,
-		apiKey: cfg.EtherscanAPIKey,
-		httpClient: &http.Client{
-			Timeout: 5 * time.Second,
-		},
-		logger: logger,
+		Client:     client,
+		apiKey:     cfg.EtherscanAPIKey,
+		baseURL:    cfg.EtherscanBaseURL,
+		httpClient: httpClient,
+		logger:     logger,
+		maxRetries: cfg.EtherscanMaxRetries,
+		retryDelay: cfg.EtherscanRetryDelay,
 	}
 }
 
 var Options = ProvideEtherscan
 
+// EtherscanResp is the envelope of every Etherscan response. Result is a
+// string instead of a list when Status is "0".
 type EtherscanResp struct {
-	Result []EtherscanTrx `json:"result"`
+	Status  string          `json:"status"`
+	Message string          `json:"message"`
+	Result  json.RawMessage `json:"result"`
 }
 
 type EtherscanTrx struct {
-	From      string `json:"from"`
-	To        string `json:"to"`
-	TokenID   string `json:"tokenID"`
-	Timestamp string `json:"timeStamp"`
+	BlockNumber      string `json:"blockNumber"`
+	TransactionIndex string `json:"transactionIndex"`
+	Hash             string `json:"hash"`
+	From             string `json:"from"`
+	To               string `json:"to"`
+	TokenID          string `json:"tokenID"`
+	// TokenValue is the quantity moved, only ERC-1155 transfers have it
+	TokenValue string `json:"tokenValue"`
+	Timestamp  string `json:"timeStamp"`
+}
+
+// Block returns the number of the block the transfer is in
+func (t EtherscanTrx) Block() (int64, error) {
+	block, err := strconv.ParseInt(t.BlockNumber, 10, 64)
+	if err != nil {
+		return 0, apierror.Decode("etherscan", fmt.Errorf("block number %q: %w", t.BlockNumber, err))
+	}
+	return block, nil
 }
 
+// Actions that list the transfers of a token standard
+const (
+	ActionERC721  = "tokennfttx"
+	ActionERC1155 = "token1155tx"
+)
+
+const (
+	// pageSize is how many transfers are asked for at once
+	pageSize = 1000
+	// maxResults is how far Etherscan pages into the results of a query
+	maxResults = 10000
+	// latestBlock is Etherscan's endblock for the chain head
+	latestBlock = 99999999
+)
+
 func (e *EtherscanClient) GetNFTTransactionsForContract(
+	ctx context.Context,
 	contract string,
 	page int,
 	offset int,
 ) ([]EtherscanTrx, error) {
-	u, err := url.Parse("https://api.etherscan.io/api")
+	return e.getNFTTransactions(ctx, ActionERC721, contract, 0, latestBlock, page, offset)
+}
+
+// getNFTTransactions returns a page of the transfers listed by action of
+// contract in [startBlock, endBlock], oldest first. Rate limits and timeouts
+// are retried until ctx is done.
+func (e *EtherscanClient) getNFTTransactions(ctx context.Context, action, contract string, startBlock, endBlock int64, page, offset int) ([]EtherscanTrx, error) {
+	for attempt := 0; ; attempt++ {
+		txs, err := e.fetchNFTTransactions(ctx, action, contract, startBlock, endBlock, page, offset)
+		if err == nil {
+			return txs, nil
+		}
+		if ctx.Err() != nil {
+			return txs, ctx.Err()
+		}
+		if !errors.Is(err, apierror.ErrRateLimited) && !errors.Is(err, apierror.ErrUpstreamUnavailable) {
+			return txs, err
+		}
+		if attempt >= e.maxRetries {
+			e.logger.Warnw("Etherscan request failed", "contract", contract, "attempts", attempt+1, "error", err)
+			return txs, err
+		}
+
+		delay := e.retryDelay << attempt
+		e.logger.Infow("Retrying Etherscan request", "contract", contract, "attempt", attempt+1, "delay", delay, "error", err)
+		if err := sleep(ctx, delay); err != nil {
+			return txs, err
+		}
+	}
+}
+
+// sleep waits for d, it returns early with ctx's error once ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *EtherscanClient) fetchNFTTransactions(ctx context.Context, action, contract string, startBlock, endBlock int64, page, offset int) ([]EtherscanTrx, error) {
+	u, err := url.Parse(e.baseURL)
 	if err != nil {
-		log.Fatal(err)
-		return []EtherscanTrx{}, nil
+		return []EtherscanTrx{}, err
 	}
 
 	q := u.Query()
 	q.Set("apikey", e.apiKey)
 	q.Set("contractaddress", contract)
 	q.Set("module", "account")
-	q.Set("action", "tokennfttx")
+	q.Set("action", action)
 	q.Set("sort", "asc")
+	q.Set("startblock", fmt.Sprintf("%d", startBlock))
+	q.Set("endblock", fmt.Sprintf("%d", endBlock))
 	q.Set("page", fmt.Sprintf("%d", page))
 	q.Set("offset", fmt.Sprintf("%d", offset))
 	u.RawQuery = q.Encode()
 
-	req, err := http.NewRequest("GET", u.String(), nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if err != nil {
-		log.Fatal(err)
-		return []EtherscanTrx{}, nil
+		return []EtherscanTrx{}, err
 	}
 
 	resp, err := e.httpClient.Do(req)
 	if err != nil {
-		log.Fatal(err)
-		return []EtherscanTrx{}, nil
+		return []EtherscanTrx{}, apierror.Unreachable("etherscan", err)
 	}
 	defer resp.Body.Close()
 
+	if err := apierror.FromResponse("etherscan", resp); err != nil {
+		return []EtherscanTrx{}, err
+	}
+
 	var etherscanResp EtherscanResp
 	err = json.NewDecoder(resp.Body).Decode(&etherscanResp)
 	if err != nil {
-		log.Fatal(err)
-		return []EtherscanTrx{}, nil
+		return []EtherscanTrx{}, apierror.Decode("etherscan", err)
+	}
+
+	if etherscanResp.Status != "1" {
+		return []EtherscanTrx{}, adaptEtherscanError(etherscanResp)
+	}
+
+	var txs []EtherscanTrx
+	err = json.Unmarshal(etherscanResp.Result, &txs)
+	if err != nil {
+		return []EtherscanTrx{}, apierror.Decode("etherscan", err)
 	}
 
-	return etherscanResp.Result, nil
+	return txs, nil
 }
 
+// adaptEtherscanError returns the error for a response with status "0", or
+// nil when it only means there were no results
+func adaptEtherscanError(resp EtherscanResp) error {
+	var result string
+	json.Unmarshal(resp.Result, &result)
+
+	var (
+		err    = fmt.Errorf("%s: %s", resp.Message, result)
+		detail = strings.ToLower(resp.Message + " " + result)
+	)
+	switch {
+	case strings.HasPrefix(strings.ToLower(resp.Message), "no transactions found"):
+		return nil
+	case strings.Contains(detail, "rate limit"):
+		return apierror.Upstream("etherscan", apierror.CodeRateLimited, "rate limited, try again later", err)
+	case strings.Contains(detail, "api key"):
+		// Our key was rejected, which is not the caller's fault
+		return apierror.Upstream("etherscan", apierror.CodeBadResponse, "request rejected", err)
+	case strings.Contains(detail, "timeout"), strings.Contains(detail, "timed out"):
+		return apierror.Upstream("etherscan", apierror.CodeUpstreamUnavailable, "unavailable", err)
+	case strings.Contains(detail, "invalid"):
+		return apierror.Upstream("etherscan", apierror.CodeInvalidInput, result, err)
+	default:
+		return apierror.Upstream("etherscan", apierror.CodeBadResponse, "request rejected", err)
+	}
+}
+
+// GetAllNFTTransactionsForContract returns every ERC-721 transfer of
+// contract, oldest first
 func (e *EtherscanClient) GetAllNFTTransactionsForContract(
+	ctx context.Context,
 	contract string,
 ) ([]EtherscanTrx, error) {
-	return e.GetNFTTransactionsForContract(contract, 0, 1000)
+	var all []EtherscanTrx
+	err := e.WalkNFTTransactionsForContract(ctx, contract, ActionERC721, 0, func(txs []EtherscanTrx) error {
+		all = append(all, txs...)
+		return nil
+	})
+	if err != nil {
+		return []EtherscanTrx{}, err
+	}
+
+	return all, nil
+}
+
+// WalkNFTTransactionsForContract calls fn with batches of the transfers of
+// contract listed by action, ActionERC721 or ActionERC1155, from startBlock
+// on, oldest first. A batch always ends with the last transfer of a block.
+// Etherscan only pages through the first 10000 results of a query, so each
+// query starts at the last block seen instead. It stops with ctx's error once
+// ctx is done.
+func (e *EtherscanClient) WalkNFTTransactionsForContract(ctx context.Context, contract, action string, startBlock int64, fn func([]EtherscanTrx) error) error {
+	for {
+		txs, err := e.getNFTTransactions(ctx, action, contract, startBlock, latestBlock, 1, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(txs) < pageSize {
+			if len(txs) == 0 {
+				return nil
+			}
+			return fn(txs)
+		}
+
+		first, err := txs[0].Block()
+		if err != nil {
+			return err
+		}
+		last, err := txs[len(txs)-1].Block()
+		if err != nil {
+			return err
+		}
+
+		if first == last {
+			// A whole page of one block, page through the block alone
+			if err := e.walkBlock(ctx, action, contract, last, fn); err != nil {
+				return err
+			}
+			startBlock = last + 1
+			continue
+		}
+
+		// The last block may go on in the next page, so it is left for
+		// the next query
+		end := len(txs)
+		for end > 0 {
+			block, err := txs[end-1].Block()
+			if err != nil {
+				return err
+			}
+			if block != last {
+				break
+			}
+			end--
+		}
+		if err := fn(txs[:end]); err != nil {
+			return err
+		}
+		startBlock = last
+	}
+}
+
+// walkBlock calls fn with the pages of the transfers of contract in block
+func (e *EtherscanClient) walkBlock(ctx context.Context, action, contract string, block int64, fn func([]EtherscanTrx) error) error {
+	for page := 1; page*pageSize <= maxResults; page++ {
+		txs, err := e.getNFTTransactions(ctx, action, contract, block, block, page, pageSize)
+		if err != nil {
+			return err
+		}
+		if len(txs) > 0 {
+			if err := fn(txs); err != nil {
+				return err
+			}
+		}
+		if len(txs) < pageSize {
+			return nil
+		}
+	}
+
+	return apierror.Upstream("etherscan", apierror.CodeBadResponse, "too many transfers", fmt.Errorf("more than %d transfers of %s in block %d", maxResults, contract, block))
 }
@@ -0,0 +1,48 @@
+package etherscan
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+func TestWalkStopsRetryingWhenContextIsDone(t *testing.T) {
+	var calls int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&calls, 1)
+		w.Write([]byte(`{"status":"0","message":"NOTOK","result":"Max rate limit reached"}`))
+	}))
+	defer srv.Close()
+
+	e := &EtherscanClient{
+		baseURL:    srv.URL,
+		httpClient: srv.Client(),
+		logger:     zap.NewNop().Sugar(),
+		maxRetries: 3,
+		retryDelay: time.Hour,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	err := e.WalkNFTTransactionsForContract(ctx, "0xabc", ActionERC721, 0, func([]EtherscanTrx) error {
+		t.Fatal("called with transfers of a rate limited query")
+		return nil
+	})
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Walk() = %v, want context.DeadlineExceeded", err)
+	}
+	if time.Since(start) > time.Second {
+		t.Fatalf("Walk() waited %v for a retry after ctx was done", time.Since(start))
+	}
+	if calls != 1 {
+		t.Fatalf("Etherscan called %d times, want 1", calls)
+	}
+}
@@ -4,10 +4,10 @@ go 1.16
 
 require (
 	cloud.google.com/go/firestore v1.6.1
+	cloud.google.com/go/storage v1.24.0
 	github.com/ethereum/go-ethereum v1.11.5
 	github.com/gorilla/mux v1.8.0
 	github.com/kelseyhightower/envconfig v1.4.0
-	github.com/mager/go-opensea v0.3.3
 	github.com/mager/sweeper v0.4.0
 	github.com/nanmu42/etherscan-api v1.8.0
 	github.com/wealdtech/go-ens/v3 v3.5.3
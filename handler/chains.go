@@ -0,0 +1,257 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strings"
+
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/chains"
+	"github.com/mager/keiko/oracle"
+	"github.com/mager/keiko/utils"
+	"github.com/mager/sweeper/database"
+)
+
+// ChainValue is the part of an address's portfolio on one chain
+type ChainValue struct {
+	Chain        string `json:"chain"`
+	ChainID      int64  `json:"chainId"`
+	NativeSymbol string `json:"nativeSymbol"`
+	// Value is the floor value of the NFTs held, in NativeSymbol
+	Value     float64 `json:"value"`
+	ValueFiat *Fiat   `json:"valueFiat"`
+	// Balance is the NativeSymbol held, nil when the chain could not be read
+	Balance        *float64 `json:"balance"`
+	BalanceFiat    *Fiat    `json:"balanceFiat"`
+	NumCollections int      `json:"numCollections"`
+	NumOwned       int      `json:"numOwned"`
+	// Error is set when the NFTs held on the chain could not be read
+	Error *apierror.ErrorBody `json:"error,omitempty"`
+}
+
+// chainPortfolio is what an address holds on one chain
+type chainPortfolio struct {
+	value       ChainValue
+	collections []AddressCollection
+}
+
+// requestChains returns the chains a request reads: the chain query param as
+// a comma separated list, then the chain of a chain-aware address, then
+// every enabled chain
+func (h *Handler) requestChains(r *http.Request, addressChain string) ([]*chains.Client, error) {
+	names := r.URL.Query().Get("chain")
+	if names == "" {
+		names = addressChain
+	}
+	if names == "" || names == "all" {
+		return h.chains.All(), nil
+	}
+
+	var (
+		clients []*chains.Client
+		seen    = make(map[string]bool)
+	)
+	for _, name := range strings.Split(names, ",") {
+		c, err := h.chains.Get(name)
+		if err != nil {
+			return nil, err
+		}
+		if !seen[c.Name] {
+			seen[c.Name] = true
+			clients = append(clients, c)
+		}
+	}
+	return clients, nil
+}
+
+// chainPortfolios reads what address holds on every chain at once. Ethereum
+// comes from the synced wallet, which is nil for unknown users, and the other
+// chains from OpenSea. A chain that cannot be read has no collections and an
+// Error.
+func (h *Handler) chainPortfolios(ctx context.Context, clients []*chains.Client, address string, wallet *database.Wallet, currency string) []chainPortfolio {
+	var (
+		portfolios = make([]chainPortfolio, len(clients))
+		done       = make(chan struct{}, len(clients))
+	)
+	for i, c := range clients {
+		go func(i int, c *chains.Client) {
+			portfolios[i] = h.chainPortfolio(ctx, c, address, wallet, currency)
+			done <- struct{}{}
+		}(i, c)
+	}
+	for range clients {
+		<-done
+	}
+
+	return portfolios
+}
+
+func (h *Handler) chainPortfolio(ctx context.Context, c *chains.Client, address string, wallet *database.Wallet, currency string) chainPortfolio {
+	var (
+		p = chainPortfolio{
+			value: ChainValue{
+				Chain:        c.Name,
+				ChainID:      c.ID,
+				NativeSymbol: c.NativeSymbol,
+			},
+			collections: []AddressCollection{},
+		}
+		prices = h.newPricer(ctx, c.Chain, currency)
+		err    error
+	)
+
+	switch {
+	case c.Name == chains.Ethereum && wallet != nil:
+		p.collections, _ = h.adaptWalletToCollectionResp(*wallet)
+	case c.Name != chains.Ethereum:
+		p.collections, err = h.adaptChainCollections(ctx, c, address)
+		if err != nil {
+			h.logger.Warnw("Failed to get chain collections", "chain", c.Name, "address", address, "error", err)
+			p.value.Error = adaptErrorBody(ctx, err)
+		}
+	}
+
+	var native float64
+	for i, collection := range p.collections {
+		if fiat := prices.fiat(collection.Value, collection.Symbol); fiat != nil {
+			p.collections[i].ValueFiat = fiat.Value
+		}
+		if value, ok := prices.convert(collection.Value, collection.Symbol, c.NativeSymbol); ok {
+			native += value
+		}
+		p.value.NumCollections++
+		p.value.NumOwned += collection.NumOwned
+	}
+	p.value.Value = math.Round(native*1000) / 1000
+	p.value.ValueFiat = prices.fiat(p.value.Value, c.NativeSymbol)
+
+	balance, err := c.Balance(ctx, address)
+	if err != nil {
+		h.logger.Warnw("Failed to get native balance", "chain", c.Name, "address", address, "error", err)
+	} else {
+		p.value.Balance = &balance
+		p.value.BalanceFiat = prices.fiat(balance, c.NativeSymbol)
+	}
+
+	return p
+}
+
+// adaptChainCollections returns the collections address holds on a chain
+// other than ethereum, valued at their floor price
+func (h *Handler) adaptChainCollections(ctx context.Context, c *chains.Client, address string) ([]AddressCollection, error) {
+	owned, err := c.Collections(ctx, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp = []AddressCollection{}
+	for _, o := range owned {
+		symbol := strings.ToUpper(o.FloorPriceSymbol)
+		if symbol == "" {
+			symbol = c.NativeSymbol
+		}
+		floor := math.Round(o.FloorPrice*100) / 100
+		resp = append(resp, AddressCollection{
+			Chain:    c.Name,
+			Symbol:   symbol,
+			Name:     o.Name,
+			Slug:     o.Slug,
+			Thumb:    o.ImageURL,
+			NFTs:     []NFT{},
+			Floor:    floor,
+			Value:    math.Round(floor*float64(o.OwnedAssetCount)*100) / 100,
+			NumOwned: o.OwnedAssetCount,
+		})
+	}
+
+	return resp, nil
+}
+
+// pricer converts the tokens of one chain to a currency, quoting each token
+// once
+type pricer struct {
+	h        *Handler
+	ctx      context.Context
+	chain    chains.Chain
+	currency string
+	quotes   map[string]*oracle.Quote
+}
+
+func (h *Handler) newPricer(ctx context.Context, chain chains.Chain, currency string) *pricer {
+	return &pricer{
+		h:        h,
+		ctx:      ctx,
+		chain:    chain,
+		currency: currency,
+		quotes:   make(map[string]*oracle.Quote),
+	}
+}
+
+// quote returns the price of symbol, or nil when it has none
+func (p *pricer) quote(symbol string) *oracle.Quote {
+	symbol = chains.PriceSymbol(symbol)
+	if quote, ok := p.quotes[symbol]; ok {
+		return quote
+	}
+
+	var q *oracle.Quote
+	quote, err := p.h.chains.Price(p.ctx, p.chain, symbol, p.currency)
+	switch {
+	case errors.Is(err, chains.ErrUnpricedToken):
+		p.h.logger.Infow("No price for token", "chain", p.chain.Name, "symbol", symbol)
+	case err != nil:
+		p.h.logger.Warnw("Failed to fetch token price", "chain", p.chain.Name, "symbol", symbol, "currency", p.currency, "error", err)
+	default:
+		q = &quote
+	}
+	p.quotes[symbol] = q
+	return q
+}
+
+// fiat converts value in symbol to the currency, it returns nil when there
+// is no price
+func (p *pricer) fiat(value float64, symbol string) *Fiat {
+	quote := p.quote(symbol)
+	if quote == nil {
+		return nil
+	}
+
+	return &Fiat{
+		Value:         utils.AdaptTotalFiat(value, quote.Rate, quote.Currency),
+		Currency:      quote.Currency,
+		Rate:          quote.Rate,
+		RateTimestamp: quote.Timestamp,
+		RateAge:       int64(quote.Age().Seconds()),
+		RateSource:    quote.Source,
+	}
+}
+
+// convert converts value from one token to another through their prices in
+// the currency, tokens priced the same need no price
+func (p *pricer) convert(value float64, from, to string) (float64, bool) {
+	if chains.PriceSymbol(from) == chains.PriceSymbol(to) {
+		return value, true
+	}
+
+	fromQuote, toQuote := p.quote(from), p.quote(to)
+	if fromQuote == nil || toQuote == nil || toQuote.Rate == 0 {
+		return 0, false
+	}
+	return value * fromQuote.Rate / toQuote.Rate, true
+}
+
+// adaptErrorBody is the error shown for a part of a response that failed,
+// without the details of the wrapped error
+func adaptErrorBody(ctx context.Context, err error) *apierror.ErrorBody {
+	var e *apierror.Error
+	if !errors.As(err, &e) {
+		e = apierror.New(apierror.CodeInternal, "internal error")
+	}
+	return &apierror.ErrorBody{
+		Code:      e.Code,
+		Message:   e.PublicMessage(),
+		RequestID: apierror.RequestID(ctx),
+	}
+}
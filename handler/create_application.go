@@ -0,0 +1,74 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/apikey"
+	"github.com/mager/keiko/database"
+)
+
+type CreateApplicationReq struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type CreateApplicationResp struct {
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+	Key    string `json:"key"`
+	Prefix string `json:"prefix"`
+}
+
+// createApplication is the route handler for the POST /admin/applications endpoint
+func (h *Handler) createApplication(w http.ResponseWriter, r *http.Request) {
+	var req CreateApplicationReq
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.ID == "" {
+		apierror.HTTPError(w, r, "id is required", http.StatusBadRequest)
+		return
+	}
+
+	key, apiKey, err := apikey.Generate()
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	app := database.Application{
+		Name: req.Name,
+		Keys: []database.APIKey{apiKey},
+	}
+
+	err = h.dbClient.Applications.Create(r.Context(), req.ID, app)
+	if err == database.ErrAlreadyExists {
+		apierror.HTTPError(w, r, "Application already exists", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	h.refreshApplications(r)
+
+	json.NewEncoder(w).Encode(CreateApplicationResp{
+		ID:     req.ID,
+		Name:   req.Name,
+		Key:    key,
+		Prefix: apiKey.Prefix,
+	})
+}
+
+// refreshApplications makes API key changes take effect right away
+func (h *Handler) refreshApplications(r *http.Request) {
+	if err := h.registry.Refresh(r.Context()); err != nil {
+		h.logger.Errorw("Failed to refresh applications", "error", err)
+	}
+}
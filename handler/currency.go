@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mager/keiko/utils"
+)
+
+var errUnsupportedCurrency = errors.New("unsupported currency")
+
+// Fiat is a value converted from ETH, or another token, along with the rate it
+// was converted at
+type Fiat struct {
+	Value    float64 `json:"value"`
+	Currency string  `json:"currency"`
+	// Rate is the price of one ETH, or of the token converted, in Currency
+	Rate          float64   `json:"rate"`
+	RateTimestamp time.Time `json:"rateTimestamp"`
+	// RateAge is how old the rate was in seconds, and RateSource the price
+	// source it came from
+	RateAge    int64  `json:"rateAge"`
+	RateSource string `json:"rateSource,omitempty"`
+}
+
+// requestCurrency returns the currency values should be shown in: the
+// currency query param, then the requesting user's default, then the
+// configured DefaultCurrency
+func (h *Handler) requestCurrency(r *http.Request) (string, error) {
+	if currency := r.URL.Query().Get("currency"); currency != "" {
+		return h.supportedCurrency(currency)
+	}
+
+	if address := requestAddress(r); address != "" {
+		user, err := h.dbClient.Users.Get(r.Context(), address)
+		if err == nil && user.Currency != "" {
+			if currency, err := h.supportedCurrency(user.Currency); err == nil {
+				return currency, nil
+			}
+		}
+	}
+
+	return strings.ToUpper(h.cfg.DefaultCurrency), nil
+}
+
+// supportedCurrency normalizes currency and checks it is configured
+func (h *Handler) supportedCurrency(currency string) (string, error) {
+	currency = strings.ToUpper(currency)
+	for _, c := range h.cfg.Currencies {
+		if strings.ToUpper(c) == currency {
+			return currency, nil
+		}
+	}
+
+	return "", fmt.Errorf("%w %q, use one of %s", errUnsupportedCurrency, currency, strings.Join(h.cfg.Currencies, ", "))
+}
+
+// adaptFiat converts valueETH to currency at the current price, it returns
+// nil when there is no price
+func (h *Handler) adaptFiat(valueETH float64, currency string) *Fiat {
+	quote, err := h.prices.ETHPrice(h.ctx, currency)
+	if err != nil {
+		h.logger.Warnw("Failed to fetch ETH price", "currency", currency, "error", err)
+		return nil
+	}
+
+	return &Fiat{
+		Value:         utils.AdaptTotalFiat(valueETH, quote.Rate, quote.Currency),
+		Currency:      quote.Currency,
+		Rate:          quote.Rate,
+		RateTimestamp: quote.Timestamp,
+		RateAge:       int64(quote.Age().Seconds()),
+		RateSource:    quote.Source,
+	}
+}
+
+// adaptUSD converts valueETH to USD for the older USD fields, which stay
+// numbers and are 0 when there is no price
+func (h *Handler) adaptUSD(valueETH float64) float64 {
+	fiat := h.adaptFiat(valueETH, "USD")
+	if fiat == nil {
+		return 0
+	}
+	return fiat.Value
+}
@@ -0,0 +1,70 @@
+package handler
+
+import (
+	"context"
+
+	"github.com/mager/keiko/ens"
+)
+
+// ENSProfile is the ENS profile of an address, Name is only set when it
+// resolves back to the address
+type ENSProfile struct {
+	Name string `json:"name"`
+	// Avatar is a URL for the avatar record, empty when it cannot be shown
+	Avatar      string `json:"avatar"`
+	URL         string `json:"url"`
+	Twitter     string `json:"twitter"`
+	GitHub      string `json:"github"`
+	Description string `json:"description"`
+	ContentHash string `json:"contenthash"`
+}
+
+// ensProfile returns the ENS profile of address, or nil when it has no
+// verified primary name or ENS could not be reached
+func (h *Handler) ensProfile(ctx context.Context, address string) *ENSProfile {
+	p, err := h.ens.Profile(ctx, address)
+	if err != nil {
+		h.logger.Warnw("Failed to get ENS profile", "address", address, "error", err)
+		return nil
+	}
+	if p.Name == "" {
+		return nil
+	}
+
+	return adaptENSProfile(p)
+}
+
+func adaptENSProfile(p ens.Profile) *ENSProfile {
+	return &ENSProfile{
+		Name:        p.Name,
+		Avatar:      p.AvatarURL,
+		URL:         p.URL,
+		Twitter:     p.Twitter,
+		GitHub:      p.GitHub,
+		Description: p.Description,
+		ContentHash: p.ContentHash,
+	}
+}
+
+// prefillUser fills the fields the user left empty from their ENS profile
+func prefillUser(user User, p *ENSProfile) User {
+	if p == nil {
+		return user
+	}
+
+	user.ENS = p
+	if user.ENSName == "" {
+		user.ENSName = p.Name
+	}
+	if user.Bio == "" {
+		user.Bio = p.Description
+	}
+	if user.Twitter == "" {
+		user.Twitter = p.Twitter
+	}
+	if user.Avatar == "" {
+		user.Avatar = p.Avatar
+	}
+
+	return user
+}
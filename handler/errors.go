@@ -0,0 +1,36 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+)
+
+// writeError writes err as a JSON error. Upstream and internal errors are
+// logged with the request ID since callers only see a short message.
+func (h *Handler) writeError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, keikodb.ErrNotFound):
+		err = apierror.New(apierror.CodeNotFound, "not found")
+	case errors.Is(err, keikodb.ErrAlreadyExists):
+		err = apierror.New(apierror.CodeConflict, "already exists")
+	}
+
+	var e *apierror.Error
+	if !errors.As(err, &e) || e.Upstream != "" || e.Code == apierror.CodeInternal {
+		var route string
+		if current := mux.CurrentRoute(r); current != nil {
+			route = current.GetName()
+		}
+		h.logger.Errorw("Request failed",
+			"route", route,
+			"requestId", apierror.RequestID(r.Context()),
+			"error", err,
+		)
+	}
+
+	apierror.Write(w, r, err)
+}
@@ -0,0 +1,97 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+)
+
+type FollowAddressResp struct {
+	Success bool `json:"success"`
+	// Address is the followed wallet, resolved when an ENS name was given
+	Address string `json:"address"`
+}
+
+// followAddress is the route handler for the POST /address/{address}/follow
+// endpoint, the address can be an ENS name
+func (h *Handler) followAddress(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx      = context.TODO()
+		follower = requestAddress(r)
+	)
+
+	if follower == "" {
+		apierror.HTTPError(w, r, "X-Address is required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.dbClient.Users.Get(ctx, follower); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	followee, ok := h.resolveFollowee(w, r)
+	if !ok {
+		return
+	}
+	if followee == follower {
+		apierror.HTTPError(w, r, "you cannot follow your own address", http.StatusBadRequest)
+		return
+	}
+
+	err := h.dbClient.Follows.Create(ctx, keikodb.Follow{
+		Follower: follower,
+		Followee: followee,
+		Created:  time.Now(),
+	})
+	if errors.Is(err, keikodb.ErrAlreadyExists) {
+		apierror.HTTPError(w, r, "Address already followed", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(FollowAddressResp{Success: true, Address: followee})
+}
+
+// resolveFollowee returns the lowercase address of the {address} path
+// variable, resolving ENS names. It writes the error and returns false when
+// there is no such address.
+func (h *Handler) resolveFollowee(w http.ResponseWriter, r *http.Request) (string, bool) {
+	address := mux.Vars(r)["address"]
+	if !common.IsHexAddress(address) {
+		resolved, err := h.infuraClient.GetAddressFromENSName(address)
+		if errors.Is(err, apierror.ErrNotFound) {
+			apierror.HTTPError(w, r, "you must include a valid ETH address in the request", http.StatusBadRequest)
+			return "", false
+		}
+		if err != nil {
+			h.writeError(w, r, err)
+			return "", false
+		}
+		address = resolved
+	}
+
+	return strings.ToLower(address), true
+}
+
+// followCounts returns how many profiles follow address and how many wallets
+// it follows, zero when they could not be counted
+func (h *Handler) followCounts(ctx context.Context, address string) (followers, following int) {
+	counts, err := h.dbClient.Follows.Counts(ctx, address)
+	if err != nil {
+		h.logger.Warnw("Failed to count follows", "address", address, "error", err)
+	}
+
+	return counts.Followers, counts.Following
+}
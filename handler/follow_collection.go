@@ -6,8 +6,9 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
 	"github.com/mager/keiko/utils"
-	"github.com/mager/sweeper/database"
 )
 
 type FollowCollectionResp struct {
@@ -19,38 +20,32 @@ func (h *Handler) followCollection(w http.ResponseWriter, r *http.Request) {
 		ctx     = context.TODO()
 		err     error
 		resp    = FollowCollectionResp{}
-		users   = h.dbClient.Client.Collection("users")
-		address = r.Header.Get("X-Address")
+		address = requestAddress(r)
 		slug    = mux.Vars(r)["slug"]
-		db      database.User
+		db      keikodb.User
 	)
 
 	if address == "" {
-		http.Error(w, "X-Address is required", http.StatusBadRequest)
+		apierror.HTTPError(w, r, "X-Address is required", http.StatusBadRequest)
 		return
 	}
 
-	docsnap, err := users.Doc(address).Get(ctx)
+	db, err = h.dbClient.Users.Get(ctx, address)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if err := docsnap.DataTo(&db); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
 	if utils.Contains(db.Collections, slug) {
-		http.Error(w, "Collection already followed", http.StatusBadRequest)
+		apierror.HTTPError(w, r, "Collection already followed", http.StatusBadRequest)
 		return
 	}
 
 	db.Collections = append(db.Collections, slug)
 
-	_, err = users.Doc(address).Set(ctx, db)
+	err = h.dbClient.Users.Set(ctx, address, db)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,124 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/database"
+	sweeperdb "github.com/mager/sweeper/database"
+)
+
+func TestFollowCollection(t *testing.T) {
+	signer := strings.ToLower(crypto.PubkeyToAddress(testKey.PublicKey).Hex())
+
+	tests := []struct {
+		name string
+		// following is what the signer follows, nil when they have no profile
+		following []string
+		slug      string
+		// signedSlug is the slug in the signature, expiry its expiry
+		signedSlug string
+		expiry     time.Duration
+		unsigned   bool
+		wantCode   int
+		want       []string
+	}{
+		{
+			name:       "follows",
+			following:  []string{"cryptopunks"},
+			slug:       "doodles",
+			signedSlug: "doodles",
+			expiry:     time.Minute,
+			wantCode:   http.StatusOK,
+			want:       []string{"cryptopunks", "doodles"},
+		},
+		{
+			name:       "already followed",
+			following:  []string{"cryptopunks"},
+			slug:       "cryptopunks",
+			signedSlug: "cryptopunks",
+			expiry:     time.Minute,
+			wantCode:   http.StatusBadRequest,
+			want:       []string{"cryptopunks"},
+		},
+		{
+			name:       "no profile",
+			slug:       "doodles",
+			signedSlug: "doodles",
+			expiry:     time.Minute,
+			wantCode:   http.StatusNotFound,
+		},
+		{
+			name:      "unsigned",
+			following: []string{},
+			slug:      "doodles",
+			unsigned:  true,
+			wantCode:  http.StatusBadRequest,
+			want:      []string{},
+		},
+		{
+			name:       "expired",
+			following:  []string{},
+			slug:       "doodles",
+			signedSlug: "doodles",
+			expiry:     -time.Minute,
+			wantCode:   http.StatusBadRequest,
+			want:       []string{},
+		},
+		{
+			name:       "signed for another collection",
+			following:  []string{},
+			slug:       "doodles",
+			signedSlug: "cryptopunks",
+			expiry:     time.Minute,
+			wantCode:   http.StatusUnauthorized,
+			want:       []string{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				s   = newTestServer(t)
+				ctx = context.Background()
+			)
+			if tt.following != nil {
+				user := database.User{User: sweeperdb.User{Name: "signer", Collections: tt.following}}
+				if err := s.db.Users.Set(ctx, signer, user); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			req := httptest.NewRequest("POST", "/collection/"+tt.slug+"/follow", nil)
+			if !tt.unsigned {
+				s.sign(t, req, testKey, auth.ActionFollowCollection, tt.signedSlug, time.Now().Add(tt.expiry))
+			}
+
+			var resp FollowCollectionResp
+			code := s.do(t, req, &resp)
+			if code != tt.wantCode {
+				t.Fatalf("status = %d, want %d", code, tt.wantCode)
+			}
+			if code == http.StatusOK && !resp.Success {
+				t.Fatalf("resp = %+v, want success", resp)
+			}
+
+			if tt.following == nil {
+				return
+			}
+			user, err := s.db.Users.Get(ctx, signer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if strings.Join(user.Collections, ",") != strings.Join(tt.want, ",") {
+				t.Fatalf("following %v, want %v", user.Collections, tt.want)
+			}
+		})
+	}
+}
@@ -2,18 +2,20 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"math"
 	"net/http"
 	"sort"
 	"strings"
 	"time"
 
-	"cloud.google.com/go/firestore"
 	"github.com/ethereum/go-ethereum/common"
 	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/chains"
+	keikodb "github.com/mager/keiko/database"
 	"github.com/mager/keiko/utils"
 	"github.com/mager/sweeper/database"
-	ens "github.com/wealdtech/go-ens/v3"
 )
 
 type NFT struct {
@@ -22,6 +24,8 @@ type NFT struct {
 	ImageURL string     `json:"imageUrl"`
 	Traits   []NFTTrait `json:"traits"`
 	Floor    float64    `json:"floor"`
+	// Wallet is the wallet of a bundle the NFT is held in
+	Wallet string `json:"wallet,omitempty"`
 }
 
 type NFTTrait struct {
@@ -55,27 +59,40 @@ type InfoReq struct {
 
 type AddressCollection struct {
 	Name string `json:"name"`
+	// Chain is the chain the collection is on
+	Chain string `json:"chain"`
 	// Value is the combined value of all NFTs in the collection
 	Value float64 `json:"value"`
 	// Floor is the collection floor price
-	Floor    float64   `json:"floor"`
-	Slug     string    `json:"slug"`
-	Thumb    string    `json:"thumb"`
-	NumOwned int       `json:"numOwned"`
-	Updated  time.Time `json:"updated"`
-	NFTs     []NFT     `json:"nfts"`
+	Floor float64 `json:"floor"`
+	// Symbol is the token Value and Floor are in, such as "ETH" or "MATIC"
+	Symbol string `json:"symbol"`
+	// ValueFiat is Value in the currency and at the rate of TotalFiat
+	ValueFiat float64   `json:"valueFiat"`
+	Slug      string    `json:"slug"`
+	Thumb     string    `json:"thumb"`
+	NumOwned  int       `json:"numOwned"`
+	Updated   time.Time `json:"updated"`
+	NFTs      []NFT     `json:"nfts"`
+	// Wallets are the wallets of a bundle the collection is held in
+	Wallets []CollectionWallet `json:"wallets,omitempty"`
 }
 
 // GetAddressResp is the response for the GET /v2/info endpoint
 type GetAddressResp struct {
 	Address     string              `json:"address"`
 	Collections []AddressCollection `json:"collections"`
-	TotalETH    float64             `json:"totalETH"`
-	TotalUSD    float64             `json:"totalUSD"`
-	ENSName     string              `json:"ensName"`
-	UpdatedAt   time.Time           `json:"updatedAt"`
-	User        User                `json:"user"`
-	Updating    bool                `json:"updating"`
+	// TotalETH and TotalUSD only count the collections valued in ETH,
+	// TotalFiat counts every chain at the rate of ETH and of its own tokens
+	TotalETH  float64 `json:"totalETH"`
+	TotalUSD  float64 `json:"totalUSD"`
+	TotalFiat *Fiat   `json:"totalFiat"`
+	// Chains breaks the portfolio down by chain
+	Chains    []ChainValue `json:"chains"`
+	ENSName   string       `json:"ensName"`
+	UpdatedAt time.Time    `json:"updatedAt"`
+	User      User         `json:"user"`
+	Updating  bool         `json:"updating"`
 }
 
 // getAddress is the route handler for the GET /address/{address} endpoint
@@ -83,12 +100,32 @@ func (h *Handler) getAddress(w http.ResponseWriter, r *http.Request) {
 	var (
 		err     error
 		address = strings.ToLower(mux.Vars(r)["address"])
+		chain   string
 		ensName string
 	)
 
 	// Make sure that the request includes an address
 	if address == "" {
-		http.Error(w, "you must include an ETH address in the request", http.StatusBadRequest)
+		apierror.HTTPError(w, r, "you must include an ETH address in the request", http.StatusBadRequest)
+		return
+	}
+
+	// An address can name its chain, e.g. polygon:0x…
+	chain, address, err = chains.ParseAddress(address)
+	if err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.requestCurrency(r)
+	if err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	clients, err := h.requestChains(r, chain)
+	if err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -96,9 +133,13 @@ func (h *Handler) getAddress(w http.ResponseWriter, r *http.Request) {
 	if !common.IsHexAddress(address) {
 		// Fetch address from ENS if it's not a valid address
 		ensName = address
-		address = h.infuraClient.GetAddressFromENSName(address)
-		if address == "" {
-			http.Error(w, "you must include a valid ETH address in the request", http.StatusBadRequest)
+		address, err = h.infuraClient.GetAddressFromENSName(address)
+		if errors.Is(err, apierror.ErrNotFound) {
+			apierror.HTTPError(w, r, "you must include a valid ETH address in the request", http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			h.writeError(w, r, err)
 			return
 		}
 	}
@@ -107,42 +148,68 @@ func (h *Handler) getAddress(w http.ResponseWriter, r *http.Request) {
 		resp = GetAddressResp{
 			Address: address,
 		}
-		ensNameChan = make(chan string)
+		profile = h.ensProfile(r.Context(), address)
 	)
 
-	// Get ENS Name
-	if ensName == "" {
-		go h.asyncGetENSNameFromAddress(address, ensNameChan)
-		resp.ENSName = <-ensNameChan
-	} else {
+	// A name from the request resolved to the address, otherwise only the
+	// verified primary name is shown
+	switch {
+	case ensName != "":
 		resp.ENSName = ensName
+	case profile != nil:
+		resp.ENSName = profile.Name
 	}
 
 	// Convert to lowercase
 	address = strings.ToLower(address)
 
 	// Check if the user exists in the database first
+	var wallet *database.Wallet
 	user, err := h.fetchUser(address)
 	if err == nil {
-		resp.User = h.adaptUser(user)
+		resp.User = h.adaptUser(address, user)
 		h.logger.Infow("User found in database", "address", address)
-		resp.Collections, resp.TotalETH = h.adaptWalletToCollectionResp(user.Wallet)
+		wallet = &user.Wallet
 		if len(user.Wallet.Collections) == 0 {
 			resp.Updating = true
 		}
-		sort.Slice(resp.Collections[:], func(i, j int) bool {
-			return resp.Collections[i].Value > resp.Collections[j].Value
-		})
 
 		resp.UpdatedAt = user.Wallet.UpdatedAt
 	} else {
 		h.logger.Info("User not found in database, returning", "address", address)
 	}
+	resp.User = prefillUser(resp.User, profile)
+	resp.User.Followers, resp.User.Following = h.followCounts(r.Context(), address)
+
+	// Every chain is valued in its own tokens, only fiat adds them up
+	var otherFiat float64
+	resp.Collections = []AddressCollection{}
+	for _, p := range h.chainPortfolios(r.Context(), clients, address, wallet, currency) {
+		resp.Chains = append(resp.Chains, p.value)
+		resp.Collections = append(resp.Collections, p.collections...)
+		for _, c := range p.collections {
+			if chains.PriceSymbol(c.Symbol) == "ETH" {
+				resp.TotalETH += c.Value
+			} else {
+				otherFiat += c.ValueFiat
+			}
+		}
+	}
+	// Round to 3 decimal places
+	resp.TotalETH = math.Round(resp.TotalETH*1000) / 1000
+	sort.SliceStable(resp.Collections, func(i, j int) bool {
+		a, b := resp.Collections[i], resp.Collections[j]
+		if a.ValueFiat != b.ValueFiat {
+			return a.ValueFiat > b.ValueFiat
+		}
+		return a.Value > b.Value
+	})
 
-	// Fetch ETH price
-	ethPriceUSD := h.cs.GetETHPrice()
-
-	resp.TotalUSD = utils.AdaptTotalUSD(resp.TotalETH, ethPriceUSD)
+	resp.TotalUSD = h.adaptUSD(resp.TotalETH)
+	resp.TotalFiat = h.adaptFiat(resp.TotalETH, currency)
+	if resp.TotalFiat != nil {
+		resp.TotalFiat.Value = utils.AdaptTotalFiat(resp.TotalFiat.Value+otherFiat, 1, resp.TotalFiat.Currency)
+	}
 
 	// Filter out 0ETH collections
 	if user.Settings.HideZeroETHCollections {
@@ -160,35 +227,24 @@ func (h *Handler) getAddress(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func (h *Handler) asyncGetENSNameFromAddress(address string, rc chan string) {
-	domain, err := ens.ReverseResolve(h.infuraClient.Client, common.HexToAddress(address))
-	if err != nil {
-		h.logger.Error(err)
-		rc <- ""
-	}
-
-	rc <- domain
-}
-
 func (h *Handler) adaptWalletToCollectionResp(wallet database.Wallet) ([]AddressCollection, float64) {
 	var (
-		resp           = []AddressCollection{}
-		collections    = h.dbClient.Client.Collection("collections")
-		collectionDocs = make([]*firestore.DocumentRef, 0)
-		totalETH       float64
+		resp     = []AddressCollection{}
+		slugs    = make([]string, 0)
+		totalETH float64
 	)
 
 	for _, collection := range wallet.Collections {
-		collectionDocs = append(collectionDocs, collections.Doc(collection.Slug))
+		slugs = append(slugs, collection.Slug)
 	}
 
-	// Fetch collections from Firestore
-	docsnaps, err := h.dbClient.Client.GetAll(h.ctx, collectionDocs)
+	// Fetch collections from the database
+	collections, err := h.dbClient.Collections.GetAll(h.ctx, slugs)
 	if err != nil {
 		h.logger.Error(err)
 	}
 
-	h.logger.Infof("%d collections found in Firestore", len(docsnaps))
+	h.logger.Infof("%d collections found in the database", len(collections))
 
 	for _, c := range wallet.Collections {
 		numOwned := len(c.NFTs)
@@ -196,6 +252,8 @@ func (h *Handler) adaptWalletToCollectionResp(wallet database.Wallet) ([]Address
 		value := h.adaptValue(nfts)
 		resp = append(resp, AddressCollection{
 			Name:     c.Name,
+			Chain:    chains.Ethereum,
+			Symbol:   "ETH",
 			Slug:     c.Slug,
 			Thumb:    c.ImageURL,
 			NFTs:     nfts,
@@ -241,16 +299,19 @@ func (h *Handler) adaptFloor(wc database.WalletCollection) float64 {
 	return math.Round(wc.Floor*100) / 100
 }
 
-func (h *Handler) adaptUser(user database.User) User {
+func (h *Handler) adaptUser(address string, user keikodb.User) User {
 	return User{
 		Name:        user.Name,
 		Photo:       user.Photo,
+		Avatar:      userAvatarURL(address, user),
 		ENSName:     user.ENSName,
 		Collections: user.Collections,
 		Slug:        user.Slug,
 		Twitter:     user.Twitter,
+		OpenSea:     user.OpenSea,
 		IsFren:      user.IsFren,
 		DiscordID:   user.DiscordID,
 		Settings:    user.Settings,
+		Currency:    user.Currency,
 	}
 }
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+	"github.com/mager/keiko/portfolio"
+	"github.com/mager/keiko/utils"
+)
+
+type PortfolioPoint struct {
+	Timestamp   time.Time                     `json:"timestamp"`
+	TotalETH    float64                       `json:"totalETH"`
+	TotalUSD    float64                       `json:"totalUSD"`
+	TotalFiat   *Fiat                         `json:"totalFiat"`
+	Collections []keikodb.PortfolioCollection `json:"collections,omitempty"`
+}
+
+type GetAddressHistoryResp struct {
+	Address  string           `json:"address"`
+	Range    string           `json:"range"`
+	Currency string           `json:"currency"`
+	History  []PortfolioPoint `json:"history"`
+}
+
+// getAddressHistory is the route handler for the GET /address/{address}/history endpoint
+func (h *Handler) getAddressHistory(w http.ResponseWriter, r *http.Request) {
+	var (
+		address     = strings.ToLower(mux.Vars(r)["address"])
+		rng         = r.URL.Query().Get("range")
+		collections = r.URL.Query().Get("collections") == "true"
+	)
+
+	if !common.IsHexAddress(address) {
+		apierror.HTTPError(w, r, "you must include a valid ETH address in the request", http.StatusBadRequest)
+		return
+	}
+	if rng == "" {
+		rng = "30d"
+	}
+
+	currency, err := h.requestCurrency(r)
+	if err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	snapshots, err := h.portfolio.History(r.Context(), address, rng)
+	if errors.Is(err, portfolio.ErrInvalidRange) {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	resp := GetAddressHistoryResp{
+		Address:  address,
+		Range:    rng,
+		Currency: currency,
+		History:  make([]PortfolioPoint, 0, len(snapshots)),
+	}
+	for _, snapshot := range snapshots {
+		point := PortfolioPoint{
+			Timestamp: snapshot.Timestamp,
+			TotalETH:  snapshot.TotalETH,
+			TotalUSD:  snapshot.TotalUSD,
+			TotalFiat: adaptSnapshotFiat(snapshot, currency),
+		}
+		if collections {
+			point.Collections = snapshot.Collections
+		}
+		resp.History = append(resp.History, point)
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// adaptSnapshotFiat converts the snapshot's total at the rate it was taken
+// with, it returns nil for snapshots without a rate in currency
+func adaptSnapshotFiat(snapshot keikodb.PortfolioSnapshot, currency string) *Fiat {
+	rate, ok := snapshot.ETHPrices[currency]
+	if !ok && currency == "USD" {
+		// Snapshots from before ETHPrices only have the USD price
+		rate, ok = snapshot.ETHPriceUSD, snapshot.ETHPriceUSD > 0
+	}
+	if !ok {
+		return nil
+	}
+
+	return &Fiat{
+		Value:         utils.AdaptTotalFiat(snapshot.TotalETH, rate, currency),
+		Currency:      currency,
+		Rate:          rate,
+		RateTimestamp: snapshot.Timestamp,
+		RateAge:       int64(time.Since(snapshot.Timestamp).Seconds()),
+	}
+}
@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetAddress(t *testing.T) {
+	var (
+		s    = newTestServer(t)
+		resp GetAddressResp
+	)
+
+	if code := s.get(t, "/address/0x064DCA21B1377D1655AC3CA3E95282D9494B5611", &resp); code != http.StatusOK {
+		t.Fatalf("status = %d, want 200", code)
+	}
+
+	if resp.Address != "0x064dca21b1377d1655ac3ca3e95282d9494b5611" || resp.User.Name != "mager" {
+		t.Fatalf("got %s named %q, want the seeded user", resp.Address, resp.User.Name)
+	}
+	if len(resp.Collections) != 1 || resp.Collections[0].Slug != "cryptopunks" || resp.Collections[0].ValueFiat != 129000 {
+		t.Fatalf("Collections = %+v, want cryptopunks worth 129000", resp.Collections)
+	}
+	if resp.TotalETH != 64.5 || resp.TotalUSD != 129000 || resp.TotalFiat == nil || resp.TotalFiat.Value != 129000 {
+		t.Fatalf("totals = %v ETH, %v USD, %+v, want 64.5 ETH at 2000", resp.TotalETH, resp.TotalUSD, resp.TotalFiat)
+	}
+	if len(resp.Chains) != 1 || resp.Chains[0].Balance == nil || *resp.Chains[0].Balance != 1.5 {
+		t.Fatalf("Chains = %+v, want a 1.5 ETH balance", resp.Chains)
+	}
+}
+
+func TestGetAddressCachesBalance(t *testing.T) {
+	s := newTestServer(t)
+
+	for i := 0; i < 2; i++ {
+		var resp GetAddressResp
+		if code := s.get(t, "/address/0x064dca21b1377d1655ac3ca3e95282d9494b5611", &resp); code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+	}
+
+	for _, group := range s.cache.Stats() {
+		if group.Name == "chainbalances" {
+			if group.Misses != 1 || group.Hits != 1 {
+				t.Fatalf("balances missed %d and hit %d times, want once each", group.Misses, group.Hits)
+			}
+			return
+		}
+	}
+	t.Fatal("no chainbalances cache group")
+}
@@ -0,0 +1,129 @@
+package handler
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+	"github.com/mager/keiko/nft"
+	"github.com/mager/keiko/storage"
+)
+
+// avatarURL returns the stable URL of a user's avatar at size, or at the
+// largest size when size is empty
+func avatarURL(address, size string) string {
+	if size == "" {
+		return fmt.Sprintf("/user/%s/avatar", address)
+	}
+	return fmt.Sprintf("/user/%s/avatar/%s", address, size)
+}
+
+// userAvatarURL returns the avatar URL to show for user, if they have one
+func userAvatarURL(address string, user keikodb.User) string {
+	if user.Avatar == nil {
+		return ""
+	}
+	if user.Avatar.Source == keikodb.AvatarSourceUpload {
+		return avatarURL(address, "")
+	}
+	return user.Avatar.URL
+}
+
+func (h *Handler) getAvatar(w http.ResponseWriter, r *http.Request) {
+	var (
+		vars    = mux.Vars(r)
+		address = strings.ToLower(vars["address"])
+	)
+
+	user, err := h.fetchUser(address)
+	if err == keikodb.ErrNotFound || (err == nil && user.Avatar == nil) {
+		apierror.HTTPError(w, r, "avatar not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	if user.Avatar.Source != keikodb.AvatarSourceUpload {
+		h.serveExternalAvatar(w, r, user.Avatar.URL)
+		return
+	}
+
+	key := avatarKey(user.Avatar, vars["size"])
+	if key == "" {
+		apierror.HTTPError(w, r, "avatar not found", http.StatusNotFound)
+		return
+	}
+
+	data, contentType, err := h.blobs.Get(h.ctx, key)
+	if err == storage.ErrNotFound {
+		apierror.HTTPError(w, r, "avatar not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	// The URL is stable across uploads, so only cache briefly
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("ETag", strconv.Quote(key))
+	http.ServeContent(w, r, "", user.Avatar.Updated, bytes.NewReader(data))
+}
+
+// avatarKey picks the smallest thumbnail at least size pixels wide, falling
+// back to the largest one
+func avatarKey(avatar *keikodb.Avatar, size string) string {
+	want, _ := strconv.Atoi(size)
+
+	var (
+		best, largest         string
+		bestSize, largestSize int
+	)
+	for s, key := range avatar.Keys {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			continue
+		}
+		if n > largestSize {
+			largest, largestSize = key, n
+		}
+		if want > 0 && n >= want && (best == "" || n < bestSize) {
+			best, bestSize = key, n
+		}
+	}
+
+	if best != "" {
+		return best
+	}
+	return largest
+}
+
+// serveExternalAvatar redirects to an avatar hosted elsewhere. Fully on-chain
+// NFTs have data URI images, which are served directly since browsers do not
+// follow redirects to them.
+func (h *Handler) serveExternalAvatar(w http.ResponseWriter, r *http.Request, link string) {
+	if !strings.HasPrefix(link, "data:") {
+		http.Redirect(w, r, link, http.StatusFound)
+		return
+	}
+
+	contentType, data, err := nft.DecodeDataURI(link)
+	if err != nil || !strings.HasPrefix(contentType, "image/") {
+		apierror.HTTPError(w, r, "avatar not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	// SVGs can carry scripts, never let them run on our origin
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	w.Write(data)
+}
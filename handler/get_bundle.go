@@ -0,0 +1,198 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+	"github.com/mager/keiko/utils"
+	"github.com/mager/sweeper/database"
+)
+
+// CollectionWallet is the part of a bundle collection held in one wallet
+type CollectionWallet struct {
+	Address  string  `json:"address"`
+	NumOwned int     `json:"numOwned"`
+	Value    float64 `json:"value"`
+}
+
+// BundleWallet is one wallet of a bundle
+type BundleWallet struct {
+	Address string `json:"address"`
+	// Linked is when the wallet was linked, nil for the profile itself
+	Linked   *time.Time `json:"linked"`
+	TotalETH float64    `json:"totalETH"`
+	// Updating is set while the wallet has not been synced yet
+	Updating  bool      `json:"updating"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// GetBundleResp is the response for the GET /address/{address}/bundle
+// endpoint
+type GetBundleResp struct {
+	// Owner is the profile the wallets are linked to
+	Owner       string              `json:"owner"`
+	Wallets     []BundleWallet      `json:"wallets"`
+	Collections []AddressCollection `json:"collections"`
+	TotalETH    float64             `json:"totalETH"`
+	TotalUSD    float64             `json:"totalUSD"`
+	TotalFiat   *Fiat               `json:"totalFiat"`
+}
+
+// getBundle is the route handler for the GET /address/{address}/bundle
+// endpoint. It merges the wallets linked to a profile, the address can be the
+// profile or any of its wallets.
+func (h *Handler) getBundle(w http.ResponseWriter, r *http.Request) {
+	address := strings.ToLower(mux.Vars(r)["address"])
+	if !common.IsHexAddress(address) {
+		apierror.HTTPError(w, r, "you must include a valid ETH address in the request", http.StatusBadRequest)
+		return
+	}
+
+	currency, err := h.requestCurrency(r)
+	if err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	owner := address
+	link, err := h.dbClient.WalletLinks.Get(r.Context(), address)
+	switch {
+	case err == nil:
+		owner = link.Owner
+	case !errors.Is(err, keikodb.ErrNotFound):
+		h.writeError(w, r, err)
+		return
+	}
+
+	links, err := h.dbClient.WalletLinks.ListByOwner(r.Context(), owner)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	var (
+		resp = GetBundleResp{
+			Owner:   owner,
+			Wallets: []BundleWallet{{Address: owner}},
+		}
+		addresses = []string{owner}
+		wallets   = make(map[string]database.Wallet)
+		settings  database.UserSettings
+	)
+	for _, link := range links {
+		linked := link.Linked
+		resp.Wallets = append(resp.Wallets, BundleWallet{Address: link.Wallet, Linked: &linked})
+		addresses = append(addresses, link.Wallet)
+	}
+
+	for i, bw := range resp.Wallets {
+		user, err := h.fetchUser(bw.Address)
+		if err != nil {
+			resp.Wallets[i].Updating = true
+			continue
+		}
+		if bw.Address == owner {
+			settings = user.Settings
+		}
+		wallets[bw.Address] = user.Wallet
+		resp.Wallets[i].Updating = len(user.Wallet.Collections) == 0
+		resp.Wallets[i].UpdatedAt = user.Wallet.UpdatedAt
+	}
+
+	resp.Collections, resp.TotalETH = h.adaptWalletsToCollectionResp(addresses, wallets)
+	for _, c := range resp.Collections {
+		for _, held := range c.Wallets {
+			for i := range resp.Wallets {
+				if resp.Wallets[i].Address == held.Address {
+					resp.Wallets[i].TotalETH += held.Value
+				}
+			}
+		}
+	}
+	for i := range resp.Wallets {
+		resp.Wallets[i].TotalETH = math.Round(resp.Wallets[i].TotalETH*1000) / 1000
+	}
+	sort.SliceStable(resp.Collections, func(i, j int) bool {
+		return resp.Collections[i].Value > resp.Collections[j].Value
+	})
+
+	resp.TotalUSD = h.adaptUSD(resp.TotalETH)
+	resp.TotalFiat = h.adaptFiat(resp.TotalETH, currency)
+
+	// Filter out 0ETH collections
+	if settings.HideZeroETHCollections {
+		filtered := []AddressCollection{}
+		for _, c := range resp.Collections {
+			if c.Floor > 0 {
+				filtered = append(filtered, c)
+			}
+		}
+		resp.Collections = filtered
+	}
+
+	if resp.TotalFiat != nil {
+		for i, c := range resp.Collections {
+			resp.Collections[i].ValueFiat = utils.AdaptTotalFiat(c.Value, resp.TotalFiat.Rate, resp.TotalFiat.Currency)
+		}
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// adaptWalletsToCollectionResp merges the collections of the wallets at
+// addresses, in that order, into one adaptWalletToCollectionResp output. Each
+// NFT records the wallet it is held in and each collection its share of every
+// wallet.
+func (h *Handler) adaptWalletsToCollectionResp(addresses []string, wallets map[string]database.Wallet) ([]AddressCollection, float64) {
+	var (
+		resp     = []AddressCollection{}
+		index    = make(map[string]int)
+		totalETH float64
+	)
+
+	for _, address := range addresses {
+		wallet, ok := wallets[address]
+		if !ok {
+			continue
+		}
+
+		collections, walletETH := h.adaptWalletToCollectionResp(wallet)
+		totalETH += walletETH
+		for _, c := range collections {
+			for i := range c.NFTs {
+				c.NFTs[i].Wallet = address
+			}
+			held := CollectionWallet{
+				Address:  address,
+				NumOwned: c.NumOwned,
+				Value:    c.Value,
+			}
+
+			i, ok := index[c.Slug]
+			if !ok {
+				c.Wallets = []CollectionWallet{held}
+				index[c.Slug] = len(resp)
+				resp = append(resp, c)
+				continue
+			}
+			resp[i].NFTs = append(resp[i].NFTs, c.NFTs...)
+			resp[i].NumOwned += c.NumOwned
+			resp[i].Value = math.Round((resp[i].Value+c.Value)*100) / 100
+			resp[i].Wallets = append(resp[i].Wallets, held)
+		}
+	}
+
+	// Round to 3 decimal places
+	totalETH = math.Round(totalETH*1000) / 1000
+
+	return resp, totalETH
+}
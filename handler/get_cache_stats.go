@@ -0,0 +1,23 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/mager/keiko/cache"
+)
+
+type GetCacheStatsResp struct {
+	Entries int                `json:"entries"`
+	Groups  []cache.GroupStats `json:"groups"`
+}
+
+// getCacheStats is the route handler for the GET /admin/cache endpoint
+func (h *Handler) getCacheStats(w http.ResponseWriter, r *http.Request) {
+	resp := GetCacheStatsResp{
+		Entries: h.cache.Len(),
+		Groups:  h.cache.Stats(),
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
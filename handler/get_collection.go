@@ -7,7 +7,7 @@ import (
 	"time"
 
 	"github.com/gorilla/mux"
-	"github.com/mager/keiko/utils"
+	"github.com/mager/keiko/apierror"
 	"github.com/mager/sweeper/database"
 )
 
@@ -25,6 +25,7 @@ type GetCollectionResp struct {
 	Slug       string              `json:"slug"`
 	FloorETH   float64             `json:"floorETH"`
 	FloorUSD   float64             `json:"floorUSD"`
+	FloorFiat  *Fiat               `json:"floorFiat"`
 	Updated    time.Time           `json:"updated"`
 	Thumb      string              `json:"thumb"`
 	Stats      []Stat              `json:"stats"`
@@ -34,41 +35,47 @@ type GetCollectionResp struct {
 // getCollection is the route handler for the GET /collection/{slug} endpoint
 func (h *Handler) getCollection(w http.ResponseWriter, r *http.Request) {
 	var (
-		ctx         = context.TODO()
-		resp        = GetCollectionResp{}
-		collections = h.dbClient.Client.Collection("collections")
-		slug        = mux.Vars(r)["slug"]
+		ctx  = context.TODO()
+		resp = GetCollectionResp{}
+		slug = mux.Vars(r)["slug"]
 	)
 
-	// Fetch collection from database
-	docsnap, err := collections.Doc(slug).Get(ctx)
+	currency, err := h.requestCurrency(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	d := docsnap.Data()
-	var c database.Collection
-	if err := docsnap.DataTo(&c); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Fetch collection from database
+	c, err := h.dbClient.Collections.Get(ctx, slug)
+	if err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
 	resp.Collection = c
 	// Set slug
-	resp.Name = d["name"].(string)
+	resp.Name = c.Name
 	resp.Slug = slug
 
-	ethPriceUSD := h.cs.GetETHPrice()
+	resp.FloorETH = c.Floor
+	resp.FloorUSD = h.adaptUSD(resp.FloorETH)
+	resp.FloorFiat = h.adaptFiat(resp.FloorETH, currency)
 
-	resp.FloorETH = d["floor"].(float64)
-	resp.FloorUSD = utils.AdaptTotalUSD(resp.FloorETH, ethPriceUSD)
+	resp.Updated = c.Updated
+	resp.Thumb = c.Thumb
 
-	resp.Updated = d["updated"].(time.Time)
-
-	thumb, ok := d["thumb"].(string)
-	if ok {
-		resp.Thumb = thumb
+	// Daily floors for the last month
+	points, _, err := h.stats.Series(ctx, slug, "30d", "1d")
+	if err != nil {
+		h.logger.Errorw("Failed to fetch collection stats", "slug", slug, "error", err)
+	}
+	resp.Stats = make([]Stat, 0, len(points))
+	for _, p := range points {
+		resp.Stats = append(resp.Stats, Stat{
+			Date:  p.Timestamp.Format("2006-01-02"),
+			Floor: p.Floor,
+		})
 	}
 
 	json.NewEncoder(w).Encode(resp)
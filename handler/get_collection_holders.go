@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/transfers"
+)
+
+const (
+	defaultTopHolders = 10
+	maxTopHolders     = 100
+)
+
+// CollectionHolder is a holder of a collection, Tokens counts different
+// tokens and Quantity all of them as a decimal string
+type CollectionHolder struct {
+	Address  string  `json:"address"`
+	Tokens   int     `json:"tokens"`
+	Quantity string  `json:"quantity"`
+	Share    float64 `json:"share"`
+}
+
+type GetCollectionHoldersResp struct {
+	Slug               string             `json:"slug"`
+	Contracts          []string           `json:"contracts"`
+	Tokens             int                `json:"tokens"`
+	Supply             string             `json:"supply"`
+	UniqueHolders      int                `json:"uniqueHolders"`
+	TopHolders         []CollectionHolder `json:"topHolders"`
+	Top10Share         float64            `json:"top10Share"`
+	SingleTokenHolders int                `json:"singleTokenHolders"`
+	// Syncing is set, with a 202, while the collection's transfers are
+	// synced for the first time
+	Syncing bool `json:"syncing"`
+}
+
+// getCollectionHolders is the route handler for the GET /collection/{slug}/holders endpoint
+func (h *Handler) getCollectionHolders(w http.ResponseWriter, r *http.Request) {
+	var (
+		slug  = mux.Vars(r)["slug"]
+		limit = defaultTopHolders
+	)
+
+	if l := r.URL.Query().Get("limit"); l != "" {
+		var err error
+		limit, err = strconv.Atoi(l)
+		if err != nil || limit < 1 || limit > maxTopHolders {
+			apierror.HTTPError(w, r, "limit must be between 1 and 100", http.StatusBadRequest)
+			return
+		}
+	}
+
+	contracts, tokens, err := h.collectionTokens(r, slug)
+	syncing := errors.Is(err, transfers.ErrSyncing)
+	if err != nil && !syncing {
+		h.writeError(w, r, err)
+		return
+	}
+
+	d := transfers.HolderDistribution(tokens, limit)
+	resp := GetCollectionHoldersResp{
+		Slug:               slug,
+		Contracts:          contracts,
+		Tokens:             d.Tokens,
+		Supply:             d.Supply.String(),
+		UniqueHolders:      d.UniqueHolders,
+		TopHolders:         []CollectionHolder{},
+		Top10Share:         d.Top10Share,
+		SingleTokenHolders: d.SingleTokenHolders,
+		Syncing:            syncing,
+	}
+	for _, holder := range d.TopHolders {
+		resp.TopHolders = append(resp.TopHolders, CollectionHolder{
+			Address:  holder.Address,
+			Tokens:   holder.Tokens,
+			Quantity: holder.Quantity.String(),
+			Share:    holder.Share,
+		})
+	}
+
+	if syncing {
+		w.WriteHeader(http.StatusAccepted)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
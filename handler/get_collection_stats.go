@@ -0,0 +1,50 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/stats"
+)
+
+type GetCollectionStatsResp struct {
+	Slug     string        `json:"slug"`
+	Range    string        `json:"range"`
+	Interval string        `json:"interval"`
+	Points   []stats.Point `json:"points"`
+}
+
+// getCollectionStats is the route handler for the GET /collection/{slug}/stats endpoint
+func (h *Handler) getCollectionStats(w http.ResponseWriter, r *http.Request) {
+	var (
+		slug     = mux.Vars(r)["slug"]
+		rng      = r.URL.Query().Get("range")
+		interval = r.URL.Query().Get("interval")
+	)
+
+	if rng == "" {
+		rng = "7d"
+	}
+
+	points, step, err := h.stats.Series(r.Context(), slug, rng, interval)
+	if errors.Is(err, stats.ErrInvalidRange) || errors.Is(err, stats.ErrInvalidInterval) {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	resp := GetCollectionStatsResp{
+		Slug:     slug,
+		Range:    rng,
+		Interval: step.String(),
+		Points:   points,
+	}
+
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,30 @@
+package handler
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestGetCollection(t *testing.T) {
+	s := newTestServer(t)
+
+	t.Run("stored", func(t *testing.T) {
+		var resp GetCollectionResp
+		if code := s.get(t, "/collection/cryptopunks", &resp); code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+
+		if resp.Name != "CryptoPunks" || resp.FloorETH != 64.5 {
+			t.Fatalf("got %q with a %v floor, want the seeded collection", resp.Name, resp.FloorETH)
+		}
+		if resp.FloorUSD != 129000 || resp.FloorFiat == nil || resp.FloorFiat.Rate != 2000 || resp.FloorFiat.RateSource != "coinstats" {
+			t.Fatalf("floor = %v USD, %+v, want 129000 at the recorded 2000", resp.FloorUSD, resp.FloorFiat)
+		}
+	})
+
+	t.Run("unknown", func(t *testing.T) {
+		if code := s.get(t, "/collection/nope", nil); code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", code)
+		}
+	})
+}
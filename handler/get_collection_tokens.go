@@ -2,78 +2,93 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
-	"sort"
-	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/transfers"
 )
 
+// CollectionToken is a holding of a token, an ERC-1155 token is listed once
+// per owner
 type CollectionToken struct {
-	TokenID  int       `json:"tokenID"`
-	Address  string    `json:"address"`
+	Contract string `json:"contract"`
+	TokenID  string `json:"tokenID"`
+	Standard string `json:"standard"`
+	// Address is the current owner
+	Address string `json:"address"`
+	// Quantity is a decimal string, ERC-1155 quantities can be larger than
+	// JSON numbers hold
+	Quantity string    `json:"quantity"`
 	Acquired time.Time `json:"acquired"`
 }
 
 type GetCollectionTokensResp struct {
-	Tokens []CollectionToken `json:"tokens"`
+	Slug      string            `json:"slug"`
+	Contracts []string          `json:"contracts"`
+	Tokens    []CollectionToken `json:"tokens"`
+	// Syncing is set, with a 202, while the collection's transfers are
+	// synced for the first time
+	Syncing bool `json:"syncing"`
 }
 
-// NOTE: This is a temporary endpoint for testing
+// getCollectionTokens is the route handler for the GET /collection/{slug}/tokens endpoint
 func (h *Handler) getCollectionTokens(w http.ResponseWriter, r *http.Request) {
-	var (
-		resp = GetCollectionTokensResp{}
-		slug = mux.Vars(r)["slug"]
-	)
+	slug := mux.Vars(r)["slug"]
 
-	h.logger.Infow("Getting collection owners", "collection", slug)
-
-	// TODO: Fetch contract address from OpenSea
-	// contract := "0x90bae7c0d86b2583d02c072d45bd64ace0b8db86"
-	contract := "0x8a90cab2b38dba80c64b7734e58ee1db38b8992e"
-
-	// Get token transactions from Etherscan
-	txs, err := h.etherscanClient.GetAllNFTTransactionsForContract(
-		contract,
-	)
-	if err != nil {
-		h.logger.Errorw("Error getting token transactions", "error", err)
-		http.Error(w, "Error getting token transactions", http.StatusInternalServerError)
+	contracts, tokens, err := h.collectionTokens(r, slug)
+	syncing := errors.Is(err, transfers.ErrSyncing)
+	if err != nil && !syncing {
+		h.writeError(w, r, err)
 		return
 	}
 
-	h.logger.Infow("Got token transactions", "collection", slug, "txs", len(txs))
-
-	// Set the ownersMap with the tokenID as the key and the to address as the value
-	for _, tx := range txs {
-		// Convert the tokenID to an int
-		tokenID, err := strconv.Atoi(tx.TokenID)
-		if err != nil {
-			h.logger.Errorw("Error converting tokenID to int", "error", err)
-			http.Error(w, "Error converting tokenID to int", http.StatusInternalServerError)
-			return
-		}
-
-		// Convert the timestamp to an int
-		ts, _ := strconv.ParseInt(tx.Timestamp, 10, 64)
-		if err != nil {
-			h.logger.Errorw("Error converting timestamp to int", "error", err)
-			http.Error(w, "Error converting timestamp to int", http.StatusInternalServerError)
-			return
-		}
-
+	resp := GetCollectionTokensResp{
+		Slug:      slug,
+		Contracts: contracts,
+		Tokens:    []CollectionToken{},
+		Syncing:   syncing,
+	}
+	for _, token := range tokens {
 		resp.Tokens = append(resp.Tokens, CollectionToken{
-			TokenID:  tokenID,
-			Address:  tx.To,
-			Acquired: time.Unix(ts, 0),
+			Contract: token.Contract,
+			TokenID:  token.TokenID,
+			Standard: token.Standard,
+			Address:  token.Owner,
+			Quantity: token.Quantity.String(),
+			Acquired: token.Acquired,
 		})
 	}
 
-	// Sort by tokenID
-	sort.Slice(resp.Tokens[:], func(i, j int) bool {
-		return resp.Tokens[i].TokenID < resp.Tokens[j].TokenID
-	})
-
+	if syncing {
+		w.WriteHeader(http.StatusAccepted)
+	}
 	json.NewEncoder(w).Encode(resp)
 }
+
+// collectionTokens resolves the collection's contracts through OpenSea and
+// returns them along with the current holdings of each token. The contracts
+// are returned with transfers.ErrSyncing too.
+func (h *Handler) collectionTokens(r *http.Request, slug string) ([]string, []transfers.Token, error) {
+	contracts, err := h.os.GetCollectionContracts(r.Context(), slug)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(contracts) == 0 {
+		return nil, nil, apierror.Errorf(apierror.CodeNotFound, "collection %s has no contracts on %s", slug, h.cfg.OpenSeaChain)
+	}
+
+	h.logger.Infow("Getting collection owners", "collection", slug, "contracts", contracts)
+
+	tokens, err := h.transfers.Tokens(r.Context(), contracts)
+	if errors.Is(err, transfers.ErrSyncing) {
+		return contracts, nil, err
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return contracts, tokens, nil
+}
@@ -4,67 +4,129 @@ import (
 	"context"
 	"encoding/json"
 	"net/http"
+	"time"
 
-	"cloud.google.com/go/firestore"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
 	"github.com/mager/sweeper/database"
 )
 
+// FollowedWallet is a followed wallet with a summary of its portfolio
+type FollowedWallet struct {
+	Address        string    `json:"address"`
+	ENSName        string    `json:"ensName"`
+	Followed       time.Time `json:"followed"`
+	NumCollections int       `json:"numCollections"`
+	TotalETH       float64   `json:"totalETH"`
+	TotalFiat      *Fiat     `json:"totalFiat"`
+	// Updating is set while the wallet's profile has not been synced yet
+	Updating  bool      `json:"updating"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
 type GetFollowingResp struct {
 	Collections []database.Collection `json:"collections"`
 	Addresses   []string              `json:"addresses"`
+	Wallets     []FollowedWallet      `json:"wallets"`
 }
 
 func (h *Handler) getFollowing(w http.ResponseWriter, r *http.Request) {
 	var (
-		ctx         = context.TODO()
-		resp        = GetFollowingResp{}
-		users       = h.dbClient.Client.Collection("users")
-		collections = h.dbClient.Client.Collection("collections")
-		address     = r.Header.Get("X-Address")
+		ctx     = context.TODO()
+		resp    = GetFollowingResp{}
+		address = requestAddress(r)
 	)
 
 	if address == "" {
-		http.Error(w, "X-Address is required", http.StatusBadRequest)
+		apierror.HTTPError(w, r, "X-Address is required", http.StatusBadRequest)
 		return
 	}
 
-	// Fetch user from database
-	docsnap, err := users.Doc(address).Get(ctx)
+	currency, err := h.requestCurrency(r)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Fetch the list of collections that the user follows
-	var db database.User
-	if err := docsnap.DataTo(&db); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	// Fetch user from database
+	db, err := h.dbClient.Users.Get(ctx, address)
+	if err != nil {
+		h.writeError(w, r, err)
 		return
 	}
 
-	// Make a slice of document references
-	var docRefs []*firestore.DocumentRef
-	for _, collection := range db.Collections {
-		docRefs = append(docRefs, collections.Doc(collection))
-	}
-
 	// Fetch the list of collections that the user follows
-	docsnaps, err := h.dbClient.Client.GetAll(ctx, docRefs)
+	resp.Collections, err = h.dbClient.Collections.GetAll(ctx, db.Collections)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
-	// Make a slice of collections
-	for _, docsnap := range docsnaps {
-		var collection database.Collection
-		if err := docsnap.DataTo(&collection); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	// Fetch the wallets that the user follows
+	follows, err := h.dbClient.Follows.Following(ctx, address)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
 
-		resp.Collections = append(resp.Collections, collection)
+	resp.Addresses = []string{}
+	for _, follow := range follows {
+		resp.Addresses = append(resp.Addresses, follow.Followee)
 	}
+	resp.Wallets = h.adaptFollowedWallets(ctx, follows, currency)
 
 	json.NewEncoder(w).Encode(resp)
 }
+
+// maxFollowedWalletLookups bounds the followed wallets looked up at once
+const maxFollowedWalletLookups = 8
+
+// adaptFollowedWallets summarizes the followed wallets concurrently, in the
+// order of follows
+func (h *Handler) adaptFollowedWallets(ctx context.Context, follows []keikodb.Follow, currency string) []FollowedWallet {
+	var (
+		wallets = make([]FollowedWallet, len(follows))
+		sem     = make(chan struct{}, maxFollowedWalletLookups)
+		done    = make(chan struct{}, len(follows))
+	)
+	for i, follow := range follows {
+		go func(i int, follow keikodb.Follow) {
+			sem <- struct{}{}
+			wallets[i] = h.adaptFollowedWallet(ctx, follow.Followee, follow.Created, currency)
+			<-sem
+			done <- struct{}{}
+		}(i, follow)
+	}
+	for range follows {
+		<-done
+	}
+
+	return wallets
+}
+
+// adaptFollowedWallet summarizes the synced portfolio of a followed wallet,
+// wallets without a profile have an empty one
+func (h *Handler) adaptFollowedWallet(ctx context.Context, address string, followed time.Time, currency string) FollowedWallet {
+	wallet := FollowedWallet{
+		Address:  address,
+		Followed: followed,
+	}
+
+	user, err := h.fetchUser(address)
+	if err == nil {
+		var collections []AddressCollection
+		collections, wallet.TotalETH = h.adaptWalletToCollectionResp(user.Wallet)
+		wallet.NumCollections = len(collections)
+		wallet.ENSName = user.ENSName
+		wallet.Updating = len(user.Wallet.Collections) == 0
+		wallet.UpdatedAt = user.Wallet.UpdatedAt
+	}
+	if wallet.ENSName == "" {
+		if profile := h.ensProfile(ctx, address); profile != nil {
+			wallet.ENSName = profile.Name
+		}
+	}
+	wallet.TotalFiat = h.adaptFiat(wallet.TotalETH, currency)
+
+	return wallet
+}
@@ -0,0 +1,87 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/mager/keiko/database"
+	sweeperdb "github.com/mager/sweeper/database"
+)
+
+func TestGetFollowing(t *testing.T) {
+	const (
+		follower = "0x00000000000000000000000000000000000f0110"
+		mager    = "0x064dca21b1377d1655ac3ca3e95282d9494b5611"
+	)
+
+	var (
+		s   = newTestServer(t)
+		ctx = context.Background()
+	)
+	user := database.User{User: sweeperdb.User{Name: "follower", Collections: []string{"cryptopunks"}}}
+	if err := s.db.Users.Set(ctx, follower, user); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.db.Follows.Create(ctx, database.Follow{Follower: follower, Followee: mager, Created: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("following", func(t *testing.T) {
+		var (
+			req  = httptest.NewRequest("GET", "/following", nil)
+			resp GetFollowingResp
+		)
+		req.Header.Set("X-Address", follower)
+		if code := s.do(t, req, &resp); code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+
+		if len(resp.Collections) != 1 || resp.Collections[0].Slug != "cryptopunks" {
+			t.Fatalf("Collections = %+v, want cryptopunks", resp.Collections)
+		}
+		if len(resp.Addresses) != 1 || resp.Addresses[0] != mager {
+			t.Fatalf("Addresses = %v, want %s", resp.Addresses, mager)
+		}
+		if len(resp.Wallets) != 1 {
+			t.Fatalf("Wallets = %+v, want one", resp.Wallets)
+		}
+		wallet := resp.Wallets[0]
+		if wallet.ENSName != "mager.eth" || wallet.NumCollections != 1 || wallet.TotalETH != 64.5 || wallet.Updating {
+			t.Fatalf("wallet = %+v, want mager.eth with 64.5 ETH in one collection", wallet)
+		}
+		if wallet.TotalFiat == nil || wallet.TotalFiat.Value != 129000 {
+			t.Fatalf("TotalFiat = %+v, want 129000 at 2000", wallet.TotalFiat)
+		}
+	})
+
+	t.Run("following nobody", func(t *testing.T) {
+		var (
+			req  = httptest.NewRequest("GET", "/following", nil)
+			resp GetFollowingResp
+		)
+		req.Header.Set("X-Address", mager)
+		if code := s.do(t, req, &resp); code != http.StatusOK {
+			t.Fatalf("status = %d, want 200", code)
+		}
+		if len(resp.Collections) != 1 || resp.Addresses == nil || len(resp.Addresses) != 0 || resp.Wallets == nil || len(resp.Wallets) != 0 {
+			t.Fatalf("resp = %+v, want cryptopunks and empty wallets", resp)
+		}
+	})
+
+	t.Run("without an address", func(t *testing.T) {
+		if code := s.get(t, "/following", nil); code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", code)
+		}
+	})
+
+	t.Run("unknown address", func(t *testing.T) {
+		req := httptest.NewRequest("GET", "/following", nil)
+		req.Header.Set("X-Address", "0x0000000000000000000000000000000000000bad")
+		if code := s.do(t, req, nil); code != http.StatusNotFound {
+			t.Fatalf("status = %d, want 404", code)
+		}
+	})
+}
@@ -5,8 +5,7 @@ import (
 	"encoding/json"
 	"net/http"
 
-	"cloud.google.com/go/firestore"
-	"google.golang.org/api/iterator"
+	keikodb "github.com/mager/keiko/database"
 )
 
 type GetFrensResp struct {
@@ -17,43 +16,31 @@ type Fren struct {
 	Name    string `json:"name"`
 	Address string `json:"address"`
 	Photo   bool   `json:"photo"`
+	Avatar  string `json:"avatar"`
 	Slug    string `json:"slug"`
 }
 
 func (h *Handler) getFrens(w http.ResponseWriter, r *http.Request) {
 	var (
-		ctx   = context.TODO()
-		resp  = GetFrensResp{}
-		users = h.dbClient.Client.Collection("users")
+		ctx  = context.TODO()
+		resp = GetFrensResp{}
 	)
 
-	// Fetch the list of collections that the user follows
-	q := users.Where("isFren", "==", true).Where("photo", "==", true)
-	iter := q.Documents(ctx)
-	defer iter.Stop()
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		var user User
-		if err := doc.DataTo(&user); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	// Fetch the list of frens that have a photo
+	records, err := h.dbClient.Users.ListFrens(ctx)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
 
+	for _, record := range records {
 		var fren Fren
 
-		fren.Address = doc.Ref.ID
-		fren.Name = getName(user)
-		fren.Photo = user.Photo
-		fren.Slug = getSlug(user, doc)
+		fren.Address = record.Address
+		fren.Name = getName(record.User)
+		fren.Photo = record.User.Photo
+		fren.Avatar = userAvatarURL(record.Address, record.User)
+		fren.Slug = getSlug(record.User, record.Address)
 
 		resp.Users = append(resp.Users, fren)
 	}
@@ -61,7 +48,7 @@ func (h *Handler) getFrens(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
-func getName(user User) string {
+func getName(user keikodb.User) string {
 	if user.Name != "" {
 		return user.Name
 	}
@@ -72,10 +59,10 @@ func getName(user User) string {
 	return ""
 }
 
-func getSlug(user User, doc *firestore.DocumentSnapshot) string {
+func getSlug(user keikodb.User, address string) string {
 	if user.ENSName != "" {
 		return user.ENSName
 	}
 
-	return doc.Ref.ID
+	return address
 }
@@ -50,13 +50,8 @@ func (h *Handler) getHome(w http.ResponseWriter, r *http.Request) {
 }
 
 func getStats(ctx context.Context, logger *zap.SugaredLogger, db *database.DatabaseClient) Stats {
-	data, err := db.Client.Collection("features").Doc("stats").Get(ctx)
-	if err != nil {
-		logger.Errorf("Error fetching stats: %v", err)
-	}
-
 	var stats = Stats{}
-	err = data.DataTo(&stats)
+	err := db.Features.Get(ctx, "stats", &stats)
 	if err != nil {
 		logger.Errorf("Error fetching stats: %v", err)
 	}
@@ -65,13 +60,8 @@ func getStats(ctx context.Context, logger *zap.SugaredLogger, db *database.Datab
 }
 
 func getRandomNFT(ctx context.Context, logger *zap.SugaredLogger, db *database.DatabaseClient) RandomNFT {
-	nft, err := db.Client.Collection("features").Doc("nftoftheday").Get(ctx)
-	if err != nil {
-		logger.Errorf("Error fetching nftoftheday: %v", err)
-	}
-
 	var n RandomNFT
-	err = nft.DataTo(&n)
+	err := db.Features.Get(ctx, "nftoftheday", &n)
 	if err != nil {
 		logger.Errorf("Error fetching nftoftheday: %v", err)
 	}
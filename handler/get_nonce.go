@@ -0,0 +1,27 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type GetNonceResp struct {
+	Nonce   string    `json:"nonce"`
+	Expires time.Time `json:"expires"`
+}
+
+// getNonce is the route handler for the GET /auth/nonce endpoint
+func (h *Handler) getNonce(w http.ResponseWriter, r *http.Request) {
+	nonce, expires, err := h.siwe.NewNonce(r.Context())
+	if err != nil {
+		h.logger.Errorw("Failed to create nonce", "error", err)
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(GetNonceResp{
+		Nonce:   nonce,
+		Expires: expires,
+	})
+}
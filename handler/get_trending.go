@@ -6,10 +6,8 @@ import (
 	"net/http"
 	"sort"
 
-	"cloud.google.com/go/firestore"
 	"github.com/mager/keiko/utils"
 	"github.com/mager/sweeper/database"
-	"google.golang.org/api/iterator"
 )
 
 type GetTrendingResp struct {
@@ -27,44 +25,21 @@ func (h *Handler) GetTrending() GetTrendingResp {
 	var (
 		ctx                     = context.TODO()
 		resp                    = GetTrendingResp{}
-		collections             = h.dbClient.Client.Collection("collections")
 		highestFloorCollections = make([]database.Collection, 0)
 		highestFloorCounter     = 0
 		limit                   = 50
 	)
 
 	// Fetch collections with the highest floor price
-	highestFloorIter := collections.Documents(ctx)
-
-	for {
-		doc, err := highestFloorIter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			h.logger.Errorf("Error fetching collections: %v", err)
-			break
-		}
-
-		thumb, ok := doc.Data()["thumb"].(string)
-		if !ok {
-			thumb = ""
-		}
-
-		sevenDayVolume, ok := doc.Data()["7d"].(float64)
-		if !ok {
-			sevenDayVolume = 0.0
-		}
+	collections, err := h.dbClient.Collections.List(ctx)
+	if err != nil {
+		h.logger.Errorf("Error fetching collections: %v", err)
+	}
 
+	for _, c := range collections {
 		// Only add collections with a weekly volume of over 1 ETH
-		if sevenDayVolume > 1.0 {
-			highestFloorCollections = append(highestFloorCollections, database.Collection{
-				Name:           doc.Data()["name"].(string),
-				Slug:           doc.Data()["slug"].(string),
-				Thumb:          thumb,
-				SevenDayVolume: utils.RoundFloat(sevenDayVolume, 2),
-				Floor:          utils.RoundFloat(doc.Data()["floor"].(float64), 2),
-			})
+		if c.SevenDayVolume > 1.0 {
+			highestFloorCollections = append(highestFloorCollections, adaptTrendingCollection(c))
 		}
 	}
 
@@ -82,35 +57,24 @@ func (h *Handler) GetTrending() GetTrendingResp {
 	}
 
 	// Fetch collections with the highest 7d weekly volume
-	highestWeeklyVolumeIter := collections.OrderBy("7d", firestore.Desc).Limit(limit).Documents(ctx)
-	for {
-		doc, err := highestWeeklyVolumeIter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			h.logger.Errorf("Error fetching collections: %v", err)
-			break
-		}
-
-		thumb, ok := doc.Data()["thumb"].(string)
-		if !ok {
-			thumb = ""
-		}
-
-		sevenDayVolume, ok := doc.Data()["7d"].(float64)
-		if !ok {
-			sevenDayVolume = 0.0
-		}
+	topWeeklyVolume, err := h.dbClient.Collections.TopByWeeklyVolume(ctx, limit)
+	if err != nil {
+		h.logger.Errorf("Error fetching collections: %v", err)
+	}
 
-		resp.TopWeeklyVolume = append(resp.TopWeeklyVolume, database.Collection{
-			Name:           doc.Data()["name"].(string),
-			Slug:           doc.Data()["slug"].(string),
-			Thumb:          thumb,
-			SevenDayVolume: utils.RoundFloat(sevenDayVolume, 2),
-			Floor:          utils.RoundFloat(doc.Data()["floor"].(float64), 2),
-		})
+	for _, c := range topWeeklyVolume {
+		resp.TopWeeklyVolume = append(resp.TopWeeklyVolume, adaptTrendingCollection(c))
 	}
 
 	return resp
 }
+
+func adaptTrendingCollection(c database.Collection) database.Collection {
+	return database.Collection{
+		Name:           c.Name,
+		Slug:           c.Slug,
+		Thumb:          c.Thumb,
+		SevenDayVolume: utils.RoundFloat(c.SevenDayVolume, 2),
+		Floor:          utils.RoundFloat(c.Floor, 2),
+	}
+}
@@ -0,0 +1,93 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/signer/core/apitypes"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/utils"
+)
+
+var signableActions = []string{
+	auth.ActionFollowCollection,
+	auth.ActionUnfollowCollection,
+	auth.ActionUpdateSettings,
+	auth.ActionUpdateAvatar,
+	auth.ActionUpdateUser,
+	auth.ActionNewUser,
+	auth.ActionLinkWallet,
+	auth.ActionUnlinkWallet,
+	auth.ActionFollowAddress,
+	auth.ActionUnfollowAddress,
+}
+
+type GetTypedDataResp struct {
+	// Expiry is the value to send back in the X-Expiry header
+	Expiry int64 `json:"expiry"`
+	// Nonce is the value to send back in the X-Nonce header
+	Nonce     string             `json:"nonce"`
+	TypedData apitypes.TypedData `json:"typedData"`
+}
+
+// getTypedData is the route handler for the GET /auth/typeddata endpoint. It
+// returns the EIP-712 payload to pass to eth_signTypedData_v4 for an action,
+// with a new nonce. The bodyHash param is the keccak256 hash of the body the
+// request will be sent with, an empty body when left out.
+func (h *Handler) getTypedData(w http.ResponseWriter, r *http.Request) {
+	var (
+		q        = r.URL.Query()
+		action   = q.Get("action")
+		target   = q.Get("target")
+		address  = q.Get("address")
+		bodyHash = auth.BodyHash(nil)
+	)
+
+	if !utils.Contains(signableActions, action) {
+		apierror.HTTPError(w, r, "unknown action", http.StatusBadRequest)
+		return
+	}
+
+	if !common.IsHexAddress(address) {
+		apierror.HTTPError(w, r, "you must include a valid ETH address in the request", http.StatusBadRequest)
+		return
+	}
+
+	if raw := q.Get("bodyHash"); raw != "" {
+		b, err := hexutil.Decode(raw)
+		if err != nil || len(b) != common.HashLength {
+			apierror.HTTPError(w, r, "bodyHash must be a 0x prefixed 32 byte hash", http.StatusBadRequest)
+			return
+		}
+		bodyHash = common.BytesToHash(b)
+	}
+
+	// Actions on the signer's own profile target their address
+	if target == "" {
+		target = address
+	}
+
+	expiry := time.Now().Add(h.cfg.ActionSignatureMaxAge).Unix()
+	nonce, _, err := h.siwe.NewNonce(r.Context())
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(GetTypedDataResp{
+		Expiry: expiry,
+		Nonce:  nonce,
+		TypedData: auth.ActionTypedData(auth.Action{
+			Action:   action,
+			Target:   target,
+			Signer:   address,
+			Expiry:   time.Unix(expiry, 0),
+			Nonce:    nonce,
+			BodyHash: bodyHash,
+		}, h.cfg.EIP712ChainID),
+	})
+}
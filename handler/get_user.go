@@ -6,6 +6,7 @@ import (
 	"strings"
 
 	"github.com/gorilla/mux"
+	keikodb "github.com/mager/keiko/database"
 	"github.com/mager/sweeper/database"
 )
 
@@ -13,6 +14,7 @@ type User struct {
 	Name        string                `json:"name"`
 	Bio         string                `json:"bio"`
 	Photo       bool                  `json:"photo"`
+	Avatar      string                `json:"avatar"`
 	ENSName     string                `json:"ensName"`
 	Collections []string              `json:"collections"`
 	Slug        string                `json:"slug"`
@@ -21,6 +23,12 @@ type User struct {
 	IsFren      bool                  `json:"IsFren"`
 	DiscordID   string                `json:"discordID"`
 	Settings    database.UserSettings `json:"settings"`
+	Currency    string                `json:"currency,omitempty"`
+	ENS         *ENSProfile           `json:"ens,omitempty"`
+	// Followers is how many profiles follow the address and Following how
+	// many wallets it follows
+	Followers int `json:"followers"`
+	Following int `json:"following"`
 }
 
 // UserReq is a request to /user/{address}
@@ -32,23 +40,15 @@ type UserResp struct {
 	User
 }
 
-func (h *Handler) fetchUser(address string) (database.User, error) {
-	// Fetch user from Firestore
-	var user database.User
-	docsnap, err := h.dbClient.Client.Collection("users").Doc(address).Get(h.ctx)
-	if err != nil {
-		h.logger.Error(err)
+func (h *Handler) fetchUser(address string) (keikodb.User, error) {
+	// Fetch user from the database
+	user, err := h.dbClient.Users.Get(h.ctx, address)
+	if err == keikodb.ErrNotFound {
+		h.logger.Info("User not found in the database")
 		return user, err
 	}
-
-	if docsnap.Exists() {
-		// TODO: Fix this
-		err = docsnap.DataTo(&user)
-		if err != nil {
-			h.logger.Error(err)
-		}
-	} else {
-		h.logger.Info("User not found in Firestore")
+	if err != nil {
+		h.logger.Error(err)
 		return user, err
 	}
 
@@ -63,7 +63,7 @@ func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) {
 
 	user, err := h.fetchUser(address)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -72,15 +72,20 @@ func (h *Handler) getUser(w http.ResponseWriter, r *http.Request) {
 			Name:        user.Name,
 			Bio:         user.Bio,
 			Photo:       user.Photo,
+			Avatar:      userAvatarURL(address, user),
 			ENSName:     user.ENSName,
 			Collections: user.Collections,
 			Slug:        user.Slug,
 			Twitter:     user.Twitter,
+			OpenSea:     user.OpenSea,
 			IsFren:      user.IsFren,
 			DiscordID:   user.DiscordID,
 			Settings:    user.Settings,
+			Currency:    user.Currency,
 		},
 	}
+	resp.User = prefillUser(resp.User, h.ensProfile(r.Context(), address))
+	resp.User.Followers, resp.User.Following = h.followCounts(r.Context(), address)
 
 	json.NewEncoder(w).Encode(resp)
 }
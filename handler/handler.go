@@ -2,20 +2,37 @@ package handler
 
 import (
 	"context"
+	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
-	"github.com/mager/go-opensea/opensea"
+	"github.com/mager/keiko/apikey"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/avatar"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/chains"
 	"github.com/mager/keiko/coinstats"
+	"github.com/mager/keiko/config"
 	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/ens"
 	"github.com/mager/keiko/etherscan"
 	"github.com/mager/keiko/infura"
+	"github.com/mager/keiko/nft"
+	"github.com/mager/keiko/opensea"
+	"github.com/mager/keiko/oracle"
+	"github.com/mager/keiko/portfolio"
+	"github.com/mager/keiko/siwe"
+	"github.com/mager/keiko/stats"
+	"github.com/mager/keiko/storage"
 	"github.com/mager/keiko/sweeper"
+	"github.com/mager/keiko/transfers"
 	"go.uber.org/zap"
 )
 
 // Handler struct for HTTP requests
 type Handler struct {
 	ctx             context.Context
+	cfg             config.Config
 	logger          *zap.SugaredLogger
 	router          *mux.Router
 	os              *opensea.OpenSeaClient
@@ -24,11 +41,25 @@ type Handler struct {
 	infuraClient    *infura.InfuraClient
 	etherscanClient *etherscan.EtherscanClient
 	sweeper         sweeper.SweeperClient
+	registry        *apikey.Registry
+	siwe            *siwe.Service
+	avatars         *avatar.Processor
+	blobs           storage.BlobStore
+	nftAvatars      *nft.AvatarVerifier
+	stats           *stats.Service
+	portfolio       *portfolio.Service
+	cache           *cache.Cache
+	prices          *oracle.Oracle
+	transfers       *transfers.Service
+	ens             *ens.Service
+	chains          *chains.Registry
+	verifier        *auth.Verifier
 }
 
 // New creates a Handler struct
 func New(
 	ctx context.Context,
+	cfg config.Config,
 	logger *zap.SugaredLogger,
 	router *mux.Router,
 	os *opensea.OpenSeaClient,
@@ -37,9 +68,23 @@ func New(
 	infuraClient *infura.InfuraClient,
 	etherscanClient *etherscan.EtherscanClient,
 	sweeper sweeper.SweeperClient,
+	registry *apikey.Registry,
+	siweService *siwe.Service,
+	avatars *avatar.Processor,
+	blobs storage.BlobStore,
+	nftAvatars *nft.AvatarVerifier,
+	statsService *stats.Service,
+	portfolioService *portfolio.Service,
+	c *cache.Cache,
+	prices *oracle.Oracle,
+	transferService *transfers.Service,
+	ensService *ens.Service,
+	chainRegistry *chains.Registry,
+	verifier *auth.Verifier,
 ) *Handler {
 	h := Handler{
 		ctx,
+		cfg,
 		logger,
 		router,
 		os,
@@ -48,65 +93,161 @@ func New(
 		infuraClient,
 		etherscanClient,
 		sweeper,
+		registry,
+		siweService,
+		avatars,
+		blobs,
+		nftAvatars,
+		statsService,
+		portfolioService,
+		c,
+		prices,
+		transferService,
+		ensService,
+		chainRegistry,
+		verifier,
 	}
 	h.registerRoutes()
 	return &h
 }
 
+// handle registers a route handler along with its access policy
+func (h *Handler) handle(path string, policy auth.Policy, f http.HandlerFunc) *mux.Route {
+	return h.router.Handle(path, auth.Protect(policy, f))
+}
+
 // RegisterRoutes registers all the routes for the route handler
 func (h *Handler) registerRoutes() {
 	// Address
-	h.router.HandleFunc("/address/{address}", h.getAddress).
-		Methods("GET")
+	h.handle("/address/{address}", auth.PolicyAPIKey, h.getAddress).
+		Methods("GET").
+		Name("getAddress")
+	h.handle("/address/{address}/history", auth.PolicyAPIKey, h.getAddressHistory).
+		Methods("GET").
+		Name("getAddressHistory")
+	h.handle("/address/{address}/bundle", auth.PolicyAPIKey, h.getBundle).
+		Methods("GET").
+		Name("getBundle")
 
 	// Home page
-	h.router.HandleFunc("/home", h.getHome).
-		Methods("GET")
+	h.handle("/home", auth.PolicyAPIKey, h.getHome).
+		Methods("GET").
+		Name("getHome")
 
 	// Trending
-	h.router.HandleFunc("/trending", h.getTrending).
-		Methods("GET")
+	h.handle("/trending", auth.PolicyAPIKey, h.getTrending).
+		Methods("GET").
+		Name("getTrending")
 
 	// Users
-	h.router.HandleFunc("/user/{address}", h.getUser).
-		Methods("GET")
-	h.router.HandleFunc("/user/{address}", h.updateUser).
+	h.handle("/user/{address}", auth.PolicyAPIKey, h.getUser).
+		Methods("GET").
+		Name("getUser")
+	h.handle("/user/{address}", auth.PolicyOwner(auth.ActionUpdateUser), h.updateUser).
 		Methods("POST").
 		Name("updateUser")
-	h.router.HandleFunc("/users", h.newUser).
-		Methods("POST")
-	h.router.HandleFunc("/following", h.getFollowing).
-		Methods("GET")
+	h.handle("/users", auth.PolicySigned(auth.ActionNewUser, ""), h.newUser).
+		Methods("POST").
+		Name("newUser")
+	h.handle("/following", auth.PolicyAPIKey, h.getFollowing).
+		Methods("GET").
+		Name("getFollowing")
+	h.handle("/user/{address}/avatar", auth.PolicyOwner(auth.ActionUpdateAvatar), h.updateAvatar).
+		Methods("POST").
+		Name("updateAvatar")
+	h.handle("/user/{address}/avatar/nft", auth.PolicyOwner(auth.ActionUpdateAvatar), h.setNFTAvatar).
+		Methods("POST").
+		Name("setNFTAvatar")
+	h.handle("/user/{address}/avatar", auth.PolicyPublic, h.getAvatar).
+		Methods("GET").
+		Name("getAvatar")
+	h.handle("/user/{address}/avatar/{size:[0-9]+}", auth.PolicyPublic, h.getAvatar).
+		Methods("GET").
+		Name("getAvatarSize")
+	h.handle("/user/{address}/settings", auth.PolicyOwner(auth.ActionUpdateSettings), h.updateSettings).
+		Methods("POST").
+		Name("updateSettings")
+	h.handle("/user/{address}/wallets/{wallet}/link", auth.PolicyOwnerOf(auth.ActionLinkWallet, "wallet"), h.linkWallet).
+		Methods("POST").
+		Name("linkWallet")
+	h.handle("/user/{address}/wallets/{wallet}/unlink", auth.PolicyOwnerOf(auth.ActionUnlinkWallet, "wallet"), h.unlinkWallet).
+		Methods("POST").
+		Name("unlinkWallet")
+	h.handle("/address/{address}/follow", auth.PolicySigned(auth.ActionFollowAddress, "address"), h.followAddress).
+		Methods("POST").
+		Name("followAddress")
+	h.handle("/address/{address}/unfollow", auth.PolicySigned(auth.ActionUnfollowAddress, "address"), h.unfollowAddress).
+		Methods("POST").
+		Name("unfollowAddress")
 
 	// Frens
-	h.router.HandleFunc("/frens", h.getFrens).
-		Methods("GET")
+	h.handle("/frens", auth.PolicyAPIKey, h.getFrens).
+		Methods("GET").
+		Name("getFrens")
 
 	// Collections
-	h.router.HandleFunc("/collections", h.getCollections).
-		Methods("GET")
-	h.router.HandleFunc("/collection/{slug}", h.getCollection).
-		Methods("GET")
-	h.router.HandleFunc("/collection/{slug}/follow", h.followCollection).
+	h.handle("/collections", auth.PolicyAPIKey, h.getCollections).
+		Methods("GET").
+		Name("getCollections")
+	h.handle("/collection/{slug}", auth.PolicyAPIKey, h.getCollection).
+		Methods("GET").
+		Name("getCollection")
+	h.handle("/collection/{slug}/stats", auth.PolicyAPIKey, h.getCollectionStats).
+		Methods("GET").
+		Name("getCollectionStats")
+	h.handle("/collection/{slug}/tokens", auth.PolicyAPIKey, h.getCollectionTokens).
+		Methods("GET").
+		Name("getCollectionTokens")
+	h.handle("/collection/{slug}/holders", auth.PolicyAPIKey, h.getCollectionHolders).
+		Methods("GET").
+		Name("getCollectionHolders")
+	h.handle("/collection/{slug}/follow", auth.PolicySigned(auth.ActionFollowCollection, "slug"), h.followCollection).
 		Methods("POST").
 		Name("followCollection")
-	h.router.HandleFunc("/collection/{slug}/unfollow", h.unfollowCollection).
+	h.handle("/collection/{slug}/unfollow", auth.PolicySigned(auth.ActionUnfollowCollection, "slug"), h.unfollowCollection).
 		Methods("POST").
 		Name("unfollowCollection")
 
 	// Search
-	h.router.HandleFunc("/search", h.search).
-		Methods("POST")
+	h.handle("/search", auth.PolicyAPIKey, h.search).
+		Methods("POST").
+		Name("search")
 
-	// Requires signature
-	h.router.HandleFunc("/user/{address}/avatar", h.updateAvatar).
+	// Sign-In with Ethereum
+	h.handle("/auth/nonce", auth.PolicyAPIKey, h.getNonce).
+		Methods("GET").
+		Name("getNonce")
+	h.handle("/auth/signin", auth.PolicyAPIKey, h.signIn).
 		Methods("POST").
-		Name("updateAvatar")
-	h.router.HandleFunc("/user/{address}/settings", h.updateSettings).
+		Name("signIn")
+	h.handle("/auth/signout", auth.PolicyAPIKey, h.signOut).
 		Methods("POST").
-		Name("updateSettings")
+		Name("signOut")
+	h.handle("/auth/typeddata", auth.PolicyPublic, h.getTypedData).
+		Methods("GET").
+		Name("getTypedData")
+
+	// Admin
+	h.handle("/admin/applications", auth.PolicyAdmin, h.createApplication).
+		Methods("POST").
+		Name("createApplication")
+	h.handle("/admin/applications/{id}/rotate", auth.PolicyAdmin, h.rotateApplicationKey).
+		Methods("POST").
+		Name("rotateApplicationKey")
+	h.handle("/admin/applications/{id}/revoke", auth.PolicyAdmin, h.revokeApplicationKey).
+		Methods("POST").
+		Name("revokeApplicationKey")
+	h.handle("/admin/cache", auth.PolicyAdmin, h.getCacheStats).
+		Methods("GET").
+		Name("getCacheStats")
+}
+
+// requestAddress returns the verified signer of the request, falling back to
+// the unverified X-Address header on routes that do not require a signature
+func requestAddress(r *http.Request) string {
+	if address, ok := auth.Signer(r.Context()); ok {
+		return address
+	}
 
-	// Testing
-	h.router.HandleFunc("/collection/{slug}/tokens", h.getCollectionTokens).
-		Methods("GET")
+	return strings.ToLower(r.Header.Get("X-Address"))
 }
@@ -0,0 +1,196 @@
+package handler
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/mux"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/mager/keiko/apikey"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/avatar"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/cassette"
+	"github.com/mager/keiko/chains"
+	"github.com/mager/keiko/coinstats"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/ens"
+	"github.com/mager/keiko/etherscan"
+	"github.com/mager/keiko/indexer"
+	"github.com/mager/keiko/infura"
+	"github.com/mager/keiko/nft"
+	"github.com/mager/keiko/opensea"
+	"github.com/mager/keiko/oracle"
+	"github.com/mager/keiko/portfolio"
+	"github.com/mager/keiko/router"
+	"github.com/mager/keiko/siwe"
+	"github.com/mager/keiko/stats"
+	"github.com/mager/keiko/storage"
+	"github.com/mager/keiko/sweeper"
+	"github.com/mager/keiko/transfers"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// testServer is the API as main wires it, on the in-memory database
+type testServer struct {
+	cfg    config.Config
+	router *mux.Router
+	db     *database.DatabaseClient
+	cache  *cache.Cache
+	logs   *observer.ObservedLogs
+}
+
+// newTestServer serves the API from the in-memory database seeded with
+// testdata/seed.json, answering upstream requests from testdata/cassettes.
+// The test fails if a request was not recorded.
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	// Only the defaults, the environment is left out
+	var cfg config.Config
+	if err := envconfig.Process("floorreport_test", &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cfg.DatabaseBackend = "memory"
+	cfg.MemorySeedFile = "testdata/seed.json"
+	cfg.BlobBackend = "local"
+	cfg.BlobLocalDir = t.TempDir()
+	cfg.HTTPMode = cassette.ModeReplay
+	cfg.CassetteDir = "testdata/cassettes"
+	cfg.APIKeyRoutes = nil
+
+	var (
+		core, logs = observer.New(zap.InfoLevel)
+		s          = &testServer{cfg: cfg, logs: logs}
+	)
+
+	app := fx.New(
+		fx.NopLogger,
+		fx.Provide(
+			func() config.Config { return cfg },
+			func() *zap.SugaredLogger { return zap.New(core).Sugar() },
+			func() context.Context { return context.Background() },
+			apikey.Options,
+			auth.Options,
+			avatar.Options,
+			cache.Options,
+			chains.Options,
+			coinstats.Options,
+			database.Options,
+			ens.Options,
+			etherscan.Options,
+			indexer.Options,
+			infura.Options,
+			nft.Options,
+			opensea.Options,
+			oracle.Options,
+			portfolio.Options,
+			router.Options,
+			siwe.Options,
+			stats.Options,
+			storage.Options,
+			sweeper.Options,
+			transfers.Options,
+			New,
+		),
+		fx.Invoke(func(*Handler) {}),
+		fx.Populate(&s.router, &s.db, &s.cache),
+	)
+	if err := app.Err(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.checkReplayed(t) })
+
+	return s
+}
+
+// get serves a GET request and decodes its JSON response into out
+func (s *testServer) get(t *testing.T, path string, out interface{}) int {
+	t.Helper()
+	return s.do(t, httptest.NewRequest("GET", path, nil), out)
+}
+
+func (s *testServer) do(t *testing.T, req *http.Request, out interface{}) int {
+	t.Helper()
+
+	w := httptest.NewRecorder()
+	s.router.ServeHTTP(w, req)
+
+	if out != nil {
+		if err := json.NewDecoder(w.Body).Decode(out); err != nil {
+			t.Fatalf("%s %s: %v", req.Method, req.URL, err)
+		}
+	}
+	return w.Code
+}
+
+// testKey signs actions in tests, testdata/cassettes has no contract code at
+// its address
+var testKey, _ = crypto.HexToECDSA("4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318")
+
+// sign signs the EIP-712 action on target with key into the headers of req,
+// covering its body and a nonce from GET /auth/nonce
+func (s *testServer) sign(t *testing.T, req *http.Request, key *ecdsa.PrivateKey, action, target string, expiry time.Time) {
+	t.Helper()
+
+	body, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	var nonce GetNonceResp
+	if code := s.get(t, "/auth/nonce", &nonce); code != http.StatusOK {
+		t.Fatalf("GET /auth/nonce: status = %d", code)
+	}
+
+	signer := strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+	hash, err := auth.ActionHash(auth.Action{
+		Action:   action,
+		Target:   target,
+		Signer:   signer,
+		Expiry:   expiry,
+		Nonce:    nonce.Nonce,
+		BodyHash: auth.BodyHash(body),
+	}, s.cfg.EIP712ChainID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig, err := crypto.Sign(hash, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sig[64] += 27
+
+	req.Header.Set("X-Address", signer)
+	req.Header.Set("X-Expiry", strconv.FormatInt(expiry.Unix(), 10))
+	req.Header.Set("X-Nonce", nonce.Nonce)
+	req.Header.Set("X-Signature", hexutil.Encode(sig))
+}
+
+// checkReplayed fails the test when a request had no recorded response
+func (s *testServer) checkReplayed(t *testing.T) {
+	t.Helper()
+
+	for _, entry := range s.logs.All() {
+		for _, field := range entry.Context {
+			if err, ok := field.Interface.(error); ok && strings.Contains(err.Error(), "no recorded response") {
+				t.Errorf("%s: %v", entry.Message, err)
+			}
+		}
+	}
+}
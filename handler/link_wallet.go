@@ -0,0 +1,144 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/auth"
+	keikodb "github.com/mager/keiko/database"
+	"github.com/mager/keiko/siwe"
+)
+
+// LinkWalletReq is the wallet's proof that it belongs to the profile, the
+// link_wallet action signed by the wallet with the profile as its target
+type LinkWalletReq struct {
+	Signature string `json:"signature"`
+	Expiry    int64  `json:"expiry"`
+	Nonce     string `json:"nonce"`
+}
+
+type LinkWalletResp struct {
+	Success bool `json:"success"`
+}
+
+// linkWallet is the route handler for the POST
+// /user/{address}/wallets/{wallet}/link endpoint. The profile signs the
+// request and the wallet signs the body, so neither can be linked alone.
+func (h *Handler) linkWallet(w http.ResponseWriter, r *http.Request) {
+	var (
+		vars   = mux.Vars(r)
+		owner  = strings.ToLower(vars["address"])
+		wallet = strings.ToLower(vars["wallet"])
+		req    LinkWalletReq
+	)
+
+	if !common.IsHexAddress(wallet) {
+		apierror.HTTPError(w, r, "you must include a valid ETH address in the request", http.StatusBadRequest)
+		return
+	}
+	if wallet == owner {
+		apierror.HTTPError(w, r, "a profile cannot link its own address", http.StatusBadRequest)
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Signature == "" || req.Nonce == "" {
+		apierror.HTTPError(w, r, "the wallet's signature and nonce are required", http.StatusBadRequest)
+		return
+	}
+
+	// Verify the wallet signed link_wallet for this profile
+	expiry := time.Unix(req.Expiry, 0)
+	if err := auth.CheckExpiry(expiry, h.cfg.ActionSignatureMaxAge); err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	hash, err := auth.ActionHash(auth.Action{
+		Action:   auth.ActionLinkWallet,
+		Target:   owner,
+		Signer:   wallet,
+		Expiry:   expiry,
+		Nonce:    req.Nonce,
+		BodyHash: auth.BodyHash(nil),
+	}, h.cfg.EIP712ChainID)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	err = h.verifier.VerifyHash(r.Context(), wallet, req.Signature, hash)
+	switch {
+	case errors.Is(err, auth.ErrMalformedSignature):
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrInvalidSignature):
+		h.logger.Infow("Wallet signature verification failed", "owner", owner, "wallet", wallet, "error", err)
+		apierror.HTTPError(w, r, "Invalid wallet signature", http.StatusUnauthorized)
+		return
+	case err != nil:
+		h.logger.Errorw("Failed to verify wallet signature", "wallet", wallet, "error", err)
+		apierror.HTTPError(w, r, "Failed to verify signature", http.StatusBadGateway)
+		return
+	}
+	err = h.siwe.ConsumeNonce(r.Context(), req.Nonce)
+	if errors.Is(err, siwe.ErrInvalidNonce) {
+		apierror.HTTPError(w, r, "Invalid or used wallet nonce", http.StatusUnauthorized)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	// Bundles are one level deep: the profile cannot be linked elsewhere and
+	// the wallet cannot have wallets of its own
+	if _, err := h.dbClient.WalletLinks.Get(r.Context(), owner); err == nil {
+		apierror.HTTPError(w, r, "this address is linked to another profile", http.StatusConflict)
+		return
+	} else if !errors.Is(err, keikodb.ErrNotFound) {
+		h.writeError(w, r, err)
+		return
+	}
+	walletLinks, err := h.dbClient.WalletLinks.ListByOwner(r.Context(), wallet)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	if len(walletLinks) > 0 {
+		apierror.HTTPError(w, r, "the wallet has linked wallets of its own", http.StatusConflict)
+		return
+	}
+
+	err = h.dbClient.WalletLinks.Create(r.Context(), keikodb.WalletLink{
+		Wallet: wallet,
+		Owner:  owner,
+		Linked: time.Now(),
+	}, h.cfg.MaxLinkedWallets)
+	if errors.Is(err, keikodb.ErrLimitReached) {
+		apierror.HTTPError(w, r, "too many linked wallets", http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, keikodb.ErrAlreadyExists) {
+		apierror.HTTPError(w, r, "the wallet is already linked to a profile", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	// Have the sweeper sync the wallet so it shows up in the bundle
+	if err := h.sweeper.UpdateUser(wallet); err != nil {
+		h.logger.Warnw("Failed to sync linked wallet", "wallet", wallet, "error", err)
+	}
+
+	json.NewEncoder(w).Encode(LinkWalletResp{Success: true})
+}
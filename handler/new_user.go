@@ -3,6 +3,12 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"time"
+
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+	"github.com/mager/keiko/utils"
+	"github.com/mager/sweeper/database"
 )
 
 type NewUserReq struct {
@@ -22,57 +28,71 @@ type NewUserResp struct {
 func (h *Handler) newUser(w http.ResponseWriter, r *http.Request) {
 	var (
 		req     NewUserReq
-		users   = h.dbClient.Client.Collection("users")
 		resp    = NewUserResp{}
-		address = r.Header.Get("X-Address")
+		address = requestAddress(r)
 	)
 
 	// Process the request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
-	// Check if the user already exists
-	docsnap, _ := users.Doc(address).Get(h.ctx)
+	// Create the user
+	user := keikodb.User{
+		User: database.User{
+			Collections: []string{},
+			ENSName:     req.ENSName,
+			Slug:        req.Slug,
+			Name:        req.Name,
+			Twitter:     req.Twitter,
+			IsFren:      req.IsFren,
+		},
+		OpenSea: req.OpenSea,
+	}
 
-	// If the user already exists, return success
-	if !docsnap.Exists() {
-		// Create the user
-		d := map[string]interface{}{
-			"collections": []string{},
-		}
-		if req.ENSName != "" {
-			d["ensName"] = req.ENSName
-		}
-		if req.Slug != "" {
-			d["slug"] = req.Slug
-		}
-		if req.Name != "" {
-			d["name"] = req.Name
+	// A photo URL is kept as an external avatar until one is uploaded
+	if utils.IsHTTPURL(req.Photo) {
+		user.Avatar = &keikodb.Avatar{
+			Source:  keikodb.AvatarSourceURL,
+			URL:     req.Photo,
+			Updated: time.Now(),
 		}
-		if req.Photo != "" {
-			d["photo"] = req.Photo
+	}
+
+	// Fields left empty are filled from the signer's ENS profile
+	if p := h.ensProfile(r.Context(), address); p != nil {
+		if user.ENSName == "" {
+			user.ENSName = p.Name
 		}
-		if req.Twitter != "" {
-			d["twitter"] = req.Twitter
+		if user.Bio == "" {
+			user.Bio = p.Description
 		}
-		if req.OpenSea != "" {
-			d["openSea"] = req.OpenSea
+		if user.Twitter == "" {
+			user.Twitter = p.Twitter
 		}
-		if req.IsFren {
-			d["IsFren"] = true
+		if user.Avatar == nil && p.Avatar != "" {
+			user.Avatar = &keikodb.Avatar{
+				Source:  keikodb.AvatarSourceURL,
+				URL:     p.Avatar,
+				Updated: time.Now(),
+			}
 		}
+	}
 
-		_, err := users.Doc(address).Create(h.ctx, d)
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
+	// Only a stored avatar counts as a photo
+	user.Photo = user.Avatar != nil
 
+	err := h.dbClient.Users.Create(h.ctx, address, user)
+	switch err {
+	case nil:
 		resp.Created = true
-	} else {
+	case keikodb.ErrAlreadyExists:
+		// If the user already exists, return success
 		w.WriteHeader(http.StatusOK)
+	default:
+		h.writeError(w, r, err)
+		return
 	}
 
 	json.NewEncoder(w).Encode(resp)
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/apikey"
+	"github.com/mager/keiko/database"
+)
+
+type RevokeApplicationKeyReq struct {
+	// Prefix selects a single key, all keys are revoked when it is empty
+	Prefix string `json:"prefix"`
+}
+
+type RevokeApplicationKeyResp struct {
+	Revoked int `json:"revoked"`
+}
+
+// revokeApplicationKey is the route handler for the POST /admin/applications/{id}/revoke endpoint
+func (h *Handler) revokeApplicationKey(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx = r.Context()
+		id  = mux.Vars(r)["id"]
+		req RevokeApplicationKeyReq
+	)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var revoked int
+	err := h.dbClient.Applications.Update(ctx, id, func(app *database.Application) error {
+		revoked = apikey.Revoke(app, req.Prefix)
+		return nil
+	})
+	if err == database.ErrNotFound {
+		apierror.HTTPError(w, r, "Application not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	h.refreshApplications(r)
+
+	h.logger.Infow("Revoked application keys", "app", id, "revoked", revoked)
+
+	json.NewEncoder(w).Encode(RevokeApplicationKeyResp{Revoked: revoked})
+}
@@ -0,0 +1,79 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/apikey"
+	"github.com/mager/keiko/database"
+)
+
+type RotateApplicationKeyReq struct {
+	// Overlap is how long the previous keys keep working, e.g. "1h"
+	Overlap string `json:"overlap"`
+}
+
+type RotateApplicationKeyResp struct {
+	Key     string    `json:"key"`
+	Prefix  string    `json:"prefix"`
+	Expires time.Time `json:"previousKeysExpire"`
+}
+
+// rotateApplicationKey is the route handler for the POST /admin/applications/{id}/rotate endpoint
+func (h *Handler) rotateApplicationKey(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx     = r.Context()
+		id      = mux.Vars(r)["id"]
+		req     RotateApplicationKeyReq
+		overlap = h.cfg.APIKeyRotationOverlap
+	)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if req.Overlap != "" {
+		d, err := time.ParseDuration(req.Overlap)
+		if err != nil || d < 0 {
+			apierror.HTTPError(w, r, "overlap must be a positive duration", http.StatusBadRequest)
+			return
+		}
+		overlap = d
+	}
+
+	var (
+		key    string
+		newKey database.APIKey
+	)
+	err := h.dbClient.Applications.Update(ctx, id, func(app *database.Application) error {
+		var err error
+		if key, err = apikey.Rotate(app, overlap); err != nil {
+			return err
+		}
+		newKey = app.Keys[len(app.Keys)-1]
+		return nil
+	})
+	if err == database.ErrNotFound {
+		apierror.HTTPError(w, r, "Application not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	h.refreshApplications(r)
+
+	h.logger.Infow("Rotated application key", "app", id, "overlap", overlap)
+
+	json.NewEncoder(w).Encode(RotateApplicationKeyResp{
+		Key:     key,
+		Prefix:  newKey.Prefix,
+		Expires: newKey.Created.Add(overlap),
+	})
+}
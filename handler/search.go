@@ -6,7 +6,7 @@ import (
 	"net/http"
 	"strings"
 
-	"google.golang.org/api/iterator"
+	"github.com/mager/keiko/apierror"
 )
 
 type SearchReq struct {
@@ -25,44 +25,29 @@ type SearchCollection struct {
 // search is the route handler for the POST /search endpoint
 func (h *Handler) search(w http.ResponseWriter, r *http.Request) {
 	var (
-		ctx         = context.TODO()
-		err         error
-		req         SearchReq
-		resp        SearchResp
-		collections = h.dbClient.Client.Collection("collections")
+		ctx  = context.TODO()
+		err  error
+		req  SearchReq
+		resp SearchResp
 	)
 
 	if err = json.NewDecoder(r.Body).Decode(&req); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
 		return
 	}
 
 	queryLower := strings.ToLower(req.Query)
-	iter := collections.
-		Where("slug", ">=", queryLower).
-		Where("slug", "<=", queryLower+"\uf8ff").
-		Documents(ctx)
-	defer iter.Stop()
-
-	for {
-		doc, err := iter.Next()
-		if err == iterator.Done {
-			break
-		}
-		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		var collection SearchCollection
-		if err := doc.DataTo(&collection); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-		collection.Slug = doc.Ref.ID
+	collections, err := h.dbClient.Collections.SearchBySlugPrefix(ctx, queryLower)
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
 
-		resp.Collections = append(resp.Collections, collection)
+	for _, c := range collections {
+		resp.Collections = append(resp.Collections, SearchCollection{
+			Name: c.Name,
+			Slug: c.Slug,
+		})
 	}
 
 	json.NewEncoder(w).Encode(resp)
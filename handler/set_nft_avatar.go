@@ -0,0 +1,122 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+	"github.com/mager/keiko/nft"
+)
+
+// errSlugContract is returned when the slug is a collection of another contract
+var errSlugContract = errors.New("slug does not match contract")
+
+type SetNFTAvatarReq struct {
+	Contract string `json:"contract"`
+	TokenID  string `json:"tokenId"`
+	// Slug is optional, it lets us reuse the image from the wallet data
+	// instead of reading the token metadata. It must be a collection of
+	// Contract.
+	Slug string `json:"slug"`
+}
+
+type SetNFTAvatarResp struct {
+	Success bool   `json:"success"`
+	Avatar  string `json:"avatar"`
+}
+
+func (h *Handler) setNFTAvatar(w http.ResponseWriter, r *http.Request) {
+	var (
+		address = strings.ToLower(mux.Vars(r)["address"])
+		req     SetNFTAvatarReq
+		resp    SetNFTAvatarResp
+	)
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.fetchUser(address)
+	if err == keikodb.ErrNotFound {
+		apierror.HTTPError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	image, err := h.walletImage(r.Context(), user, req)
+	if err == errSlugContract {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	avatar, err := h.nftAvatars.Avatar(r.Context(), address, req.Contract, req.TokenID, image)
+	switch {
+	case err == nil:
+	case errors.Is(err, nft.ErrInvalidToken), errors.Is(err, nft.ErrUnsupportedContract), errors.Is(err, nft.ErrNoImage):
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, nft.ErrNotOwner):
+		apierror.HTTPError(w, r, err.Error(), http.StatusForbidden)
+		return
+	default:
+		h.writeError(w, r, apierror.Unreachable("ethereum", err))
+		return
+	}
+
+	if err := h.dbClient.Users.UpdateAvatar(h.ctx, address, &avatar); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.deleteAvatarBlobs(user.Avatar)
+
+	resp.Success = true
+	resp.Avatar = avatar.URL
+
+	json.NewEncoder(w).Encode(resp)
+}
+
+// walletImage returns the image of the token from the wallet data that was
+// last synced for the user, if any. The slug is only trusted when its
+// collection's contract is the one ownership is checked for.
+func (h *Handler) walletImage(ctx context.Context, user keikodb.User, req SetNFTAvatarReq) (string, error) {
+	if req.Slug == "" {
+		return "", nil
+	}
+
+	collection, err := h.dbClient.Collections.Get(ctx, req.Slug)
+	if err == keikodb.ErrNotFound {
+		return "", nil
+	}
+	if err != nil {
+		return "", err
+	}
+	if !strings.EqualFold(collection.Contract, req.Contract) {
+		return "", errSlugContract
+	}
+
+	for _, c := range user.Wallet.Collections {
+		if c.Slug != req.Slug {
+			continue
+		}
+		for _, asset := range c.NFTs {
+			if asset.TokenID == req.TokenID {
+				return asset.ImageURL, nil
+			}
+		}
+	}
+
+	return "", nil
+}
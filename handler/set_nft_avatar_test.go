@@ -0,0 +1,44 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/database"
+	sweeperdb "github.com/mager/sweeper/database"
+)
+
+func TestSetNFTAvatarSlugOfAnotherContract(t *testing.T) {
+	var (
+		s      = newTestServer(t)
+		ctx    = context.Background()
+		signer = strings.ToLower(crypto.PubkeyToAddress(testKey.PublicKey).Hex())
+	)
+	if err := s.db.Users.Set(ctx, signer, database.User{User: sweeperdb.User{Name: "signer"}}); err != nil {
+		t.Fatal(err)
+	}
+
+	// cryptopunks is seeded with another contract, so its wallet image must
+	// not be used for this token
+	body := `{"contract": "0x0000000000000000000000000000000000000001", "tokenId": "1", "slug": "cryptopunks"}`
+	req := httptest.NewRequest("POST", "/user/"+signer+"/avatar/nft", strings.NewReader(body))
+	s.sign(t, req, testKey, auth.ActionUpdateAvatar, signer, time.Now().Add(time.Minute))
+
+	if code := s.do(t, req, nil); code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d", code, http.StatusBadRequest)
+	}
+
+	user, err := s.db.Users.Get(ctx, signer)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Avatar != nil {
+		t.Fatalf("avatar = %+v, want none", user.Avatar)
+	}
+}
@@ -0,0 +1,55 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/siwe"
+)
+
+type SignInReq struct {
+	// Message is the EIP-4361 message exactly as it was signed
+	Message   string `json:"message"`
+	Signature string `json:"signature"`
+}
+
+type SignInResp struct {
+	Token   string    `json:"token"`
+	Address string    `json:"address"`
+	Expires time.Time `json:"expires"`
+}
+
+// signIn is the route handler for the POST /auth/signin endpoint
+func (h *Handler) signIn(w http.ResponseWriter, r *http.Request) {
+	var req SignInReq
+
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	token, session, err := h.siwe.SignIn(r.Context(), req.Message, req.Signature)
+	switch {
+	case err == nil:
+	case errors.Is(err, siwe.ErrInvalidMessage), errors.Is(err, auth.ErrMalformedSignature):
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	case errors.Is(err, auth.ErrInvalidSignature), errors.Is(err, siwe.ErrInvalidNonce):
+		apierror.HTTPError(w, r, err.Error(), http.StatusUnauthorized)
+		return
+	default:
+		h.logger.Errorw("Failed to sign in", "error", err)
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(SignInResp{
+		Token:   token,
+		Address: session.Address,
+		Expires: session.Expires,
+	})
+}
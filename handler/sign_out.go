@@ -0,0 +1,35 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/mager/keiko/apierror"
+)
+
+type SignOutResp struct {
+	Success bool `json:"success"`
+}
+
+// signOut is the route handler for the POST /auth/signout endpoint
+func (h *Handler) signOut(w http.ResponseWriter, r *http.Request) {
+	var (
+		resp  SignOutResp
+		authz = r.Header.Get("Authorization")
+	)
+
+	if !strings.HasPrefix(authz, "Bearer ") {
+		apierror.HTTPError(w, r, "Missing session token", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.siwe.SignOut(r.Context(), strings.TrimPrefix(authz, "Bearer ")); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	resp.Success = true
+
+	json.NewEncoder(w).Encode(resp)
+}
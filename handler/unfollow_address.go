@@ -0,0 +1,51 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+)
+
+type UnfollowAddressResp struct {
+	Success bool `json:"success"`
+}
+
+// unfollowAddress is the route handler for the POST
+// /address/{address}/unfollow endpoint, the address can be an ENS name
+func (h *Handler) unfollowAddress(w http.ResponseWriter, r *http.Request) {
+	var (
+		ctx      = context.TODO()
+		follower = requestAddress(r)
+	)
+
+	if follower == "" {
+		apierror.HTTPError(w, r, "X-Address is required", http.StatusBadRequest)
+		return
+	}
+
+	followee, ok := h.resolveFollowee(w, r)
+	if !ok {
+		return
+	}
+
+	_, err := h.dbClient.Follows.Get(ctx, follower, followee)
+	if errors.Is(err, keikodb.ErrNotFound) {
+		apierror.HTTPError(w, r, "Address not followed", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	if err := h.dbClient.Follows.Delete(ctx, follower, followee); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(UnfollowAddressResp{Success: true})
+}
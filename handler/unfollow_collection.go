@@ -6,8 +6,9 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
 	"github.com/mager/keiko/utils"
-	"github.com/mager/sweeper/database"
 )
 
 type UnfollowCollectionResp struct {
@@ -19,39 +20,33 @@ func (h *Handler) unfollowCollection(w http.ResponseWriter, r *http.Request) {
 		ctx     = context.TODO()
 		err     error
 		resp    = UnfollowCollectionResp{}
-		users   = h.dbClient.Client.Collection("users")
-		address = r.Header.Get("X-Address")
+		address = requestAddress(r)
 		slug    = mux.Vars(r)["slug"]
-		db      database.User
+		db      keikodb.User
 	)
 
 	if address == "" {
-		http.Error(w, "X-Address is required", http.StatusBadRequest)
+		apierror.HTTPError(w, r, "X-Address is required", http.StatusBadRequest)
 		return
 	}
 
-	docsnap, err := users.Doc(address).Get(ctx)
+	db, err = h.dbClient.Users.Get(ctx, address)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
-	}
-
-	if err := docsnap.DataTo(&db); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
 	if !utils.Contains(db.Collections, slug) {
-		http.Error(w, "Collection not followed", http.StatusBadRequest)
+		apierror.HTTPError(w, r, "Collection not followed", http.StatusBadRequest)
 		return
 	}
 
 	// Remove the slug from the list
 	db.Collections = utils.Remove(db.Collections, slug)
 
-	_, err = users.Doc(address).Set(ctx, db)
+	err = h.dbClient.Users.Set(ctx, address, db)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		h.writeError(w, r, err)
 		return
 	}
 
@@ -0,0 +1,46 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	keikodb "github.com/mager/keiko/database"
+)
+
+type UnlinkWalletResp struct {
+	Success bool `json:"success"`
+}
+
+// unlinkWallet is the route handler for the POST
+// /user/{address}/wallets/{wallet}/unlink endpoint, signed by the profile
+func (h *Handler) unlinkWallet(w http.ResponseWriter, r *http.Request) {
+	var (
+		vars   = mux.Vars(r)
+		owner  = strings.ToLower(vars["address"])
+		wallet = strings.ToLower(vars["wallet"])
+	)
+
+	link, err := h.dbClient.WalletLinks.Get(r.Context(), wallet)
+	if err == nil && link.Owner != owner {
+		err = keikodb.ErrNotFound
+	}
+	if errors.Is(err, keikodb.ErrNotFound) {
+		apierror.HTTPError(w, r, "the wallet is not linked to this profile", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	if err := h.dbClient.WalletLinks.Delete(r.Context(), wallet); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	json.NewEncoder(w).Encode(UnlinkWalletResp{Success: true})
+}
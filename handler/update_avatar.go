@@ -2,20 +2,117 @@ package handler
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/avatar"
+	keikodb "github.com/mager/keiko/database"
 )
 
 type UpdateAvatarResp struct {
 	Success bool `json:"success"`
+	// URLs maps each thumbnail size to the URL it is served from
+	URLs map[string]string `json:"urls"`
 }
 
 func (h *Handler) updateAvatar(w http.ResponseWriter, r *http.Request) {
-	// Get address from path params
 	var (
-		// vars = mux.Vars(r)
-		// address = vars["address"]
-		resp UpdateAvatarResp
+		address = strings.ToLower(mux.Vars(r)["address"])
+		resp    = UpdateAvatarResp{URLs: make(map[string]string)}
+	)
+
+	// Leave some room for the multipart framing
+	r.Body = http.MaxBytesReader(w, r.Body, h.avatars.MaxBytes()+1<<20)
+
+	file, _, err := r.FormFile("avatar")
+	if err != nil {
+		apierror.HTTPError(w, r, "avatar file is required", http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, h.avatars.MaxBytes()+1))
+	if err != nil {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	thumbnails, err := h.avatars.Process(data)
+	switch {
+	case err == nil:
+	case errors.Is(err, avatar.ErrTooLarge):
+		apierror.HTTPError(w, r, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case errors.Is(err, avatar.ErrUnsupportedType):
+		apierror.HTTPError(w, r, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	default:
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := h.fetchUser(address)
+	if err == keikodb.ErrNotFound {
+		apierror.HTTPError(w, r, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+
+	// Every upload gets its own version so cached thumbnails are never stale
+	var (
+		version = strconv.FormatInt(time.Now().UnixNano(), 36)
+		updated = keikodb.Avatar{
+			Source:  keikodb.AvatarSourceUpload,
+			Keys:    make(map[string]string),
+			Updated: time.Now(),
+		}
 	)
+	for _, thumbnail := range thumbnails {
+		size := strconv.Itoa(thumbnail.Size)
+		key := fmt.Sprintf("avatars/%s/%s/%s.%s", address, version, size, thumbnail.Ext)
+
+		if err := h.blobs.Put(h.ctx, key, thumbnail.Data, thumbnail.ContentType); err != nil {
+			h.logger.Errorw("Failed to store avatar", "key", key, "error", err)
+			h.writeError(w, r, err)
+			return
+		}
+
+		updated.Keys[size] = key
+		updated.ContentType = thumbnail.ContentType
+		resp.URLs[size] = avatarURL(address, size)
+	}
+
+	if err := h.dbClient.Users.UpdateAvatar(h.ctx, address, &updated); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	h.deleteAvatarBlobs(user.Avatar)
+
+	resp.Success = true
 
 	json.NewEncoder(w).Encode(resp)
 }
+
+// deleteAvatarBlobs removes the thumbnails of a replaced avatar, which are
+// unreachable once the user document points elsewhere
+func (h *Handler) deleteAvatarBlobs(previous *keikodb.Avatar) {
+	if previous == nil {
+		return
+	}
+
+	for _, key := range previous.Keys {
+		if err := h.blobs.Delete(h.ctx, key); err != nil {
+			h.logger.Warnw("Failed to delete old avatar", "key", key, "error", err)
+		}
+	}
+}
@@ -2,14 +2,19 @@ package handler
 
 import (
 	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/gorilla/mux"
+	"github.com/mager/keiko/apierror"
 	"github.com/mager/sweeper/database"
 )
 
 type UpdateSettingsReq struct {
-	HideZeroETHCollections bool `json:"hide0ETHCollections"`
+	HideZeroETHCollections *bool `json:"hide0ETHCollections"`
+	// Currency is the default fiat currency, an empty string removes it
+	Currency *string `json:"currency"`
 }
 
 type UpdateSettingsResp struct {
@@ -27,15 +32,41 @@ func (h *Handler) updateSettings(w http.ResponseWriter, r *http.Request) {
 
 	// Decode request body
 	err := json.NewDecoder(r.Body).Decode(&req)
-	if err != nil {
-		h.logger.Error(err)
+	if err != nil && err != io.EOF {
+		apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+		return
 	}
 
-	// Adapt request to database.UserSettings
-	var settings database.UserSettings
-	settings.HideZeroETHCollections = req.HideZeroETHCollections
+	// Validate the currency before anything is saved
+	var currency string
+	if req.Currency != nil && *req.Currency != "" {
+		currency, err = h.supportedCurrency(*req.Currency)
+		if err != nil {
+			apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if req.HideZeroETHCollections != nil {
+		// Adapt request to database.UserSettings
+		var settings database.UserSettings
+		settings.HideZeroETHCollections = *req.HideZeroETHCollections
+
+		if err := h.sweeper.UpdateUserSettings(address, settings); err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+	}
+
+	if req.Currency != nil {
+		err = h.dbClient.Users.UpdateCurrency(r.Context(), strings.ToLower(address), currency)
+		if err != nil {
+			h.writeError(w, r, err)
+			return
+		}
+	}
 
-	resp.Success = h.sweeper.UpdateUserSettings(address, settings)
+	resp.Success = true
 
 	json.NewEncoder(w).Encode(resp)
 }
@@ -20,7 +20,11 @@ func (h *Handler) updateUser(w http.ResponseWriter, r *http.Request) {
 	)
 
 	// Update user
-	resp.Success = h.sweeper.UpdateUser(address)
+	if err := h.sweeper.UpdateUser(address); err != nil {
+		h.writeError(w, r, err)
+		return
+	}
+	resp.Success = true
 
 	json.NewEncoder(w).Encode(resp)
 }
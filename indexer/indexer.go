@@ -0,0 +1,361 @@
+package indexer
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/infura"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+const (
+	// recentBlocks is how many earlier checkpoints are kept to find where
+	// the chain forked
+	recentBlocks = 32
+	// targetLogs is how many logs a query should return, the block range is
+	// widened below half of it and narrowed above it
+	targetLogs = 5000
+	// ceilingRanges is how many block ranges are queried before widening
+	// past a range the node refused again
+	ceilingRanges = 16
+)
+
+// Chain is what the indexer reads from a node. An *ethclient.Client and
+// go-ethereum's simulated backend are both one.
+type Chain interface {
+	HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error)
+	FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error)
+}
+
+// Indexer reads the ERC-721 and ERC-1155 transfers of contracts from their
+// logs into the database. It stays IndexerConfirmations blocks behind the
+// head and rolls back the blocks a deeper reorg replaced.
+type Indexer struct {
+	chain  Chain
+	db     *database.DatabaseClient
+	logger *zap.SugaredLogger
+
+	confirmations int64
+	blockRange    int64
+	maxRange      int64
+
+	mu sync.Mutex
+	// indexing holds a lock per contract so a contract is indexed once at a
+	// time
+	indexing map[string]*sync.Mutex
+}
+
+// ProvideIndexer provides an Indexer that reads logs through Infura. When
+// the TransferSource is "logs" it also follows the head of every indexed
+// contract on the IndexerPollInterval.
+func ProvideIndexer(
+	lc fx.Lifecycle,
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	db *database.DatabaseClient,
+	infuraClient *infura.InfuraClient,
+) *Indexer {
+	x := NewIndexer(cfg, infuraClient.Client, db, logger)
+	if cfg.TransferSource != "logs" {
+		return x
+	}
+
+	ticker := time.NewTicker(cfg.IndexerPollInterval)
+	done := make(chan struct{})
+
+	lc.Append(
+		fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					for {
+						select {
+						case <-ticker.C:
+							if err := x.FollowAll(context.Background()); err != nil {
+								logger.Errorw("Failed to follow indexed contracts", "error", err)
+							}
+						case <-done:
+							return
+						}
+					}
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				ticker.Stop()
+				close(done)
+				return nil
+			},
+		},
+	)
+
+	return x
+}
+
+var Options = ProvideIndexer
+
+// NewIndexer creates an Indexer reading from chain, it does not follow the
+// head on its own
+func NewIndexer(cfg config.Config, chain Chain, db *database.DatabaseClient, logger *zap.SugaredLogger) *Indexer {
+	blockRange := cfg.IndexerBlockRange
+	if blockRange < 1 {
+		blockRange = 1
+	}
+	maxRange := cfg.IndexerMaxRange
+	if maxRange < blockRange {
+		maxRange = blockRange
+	}
+
+	return &Indexer{
+		chain:         chain,
+		db:            db,
+		logger:        logger,
+		confirmations: cfg.IndexerConfirmations,
+		blockRange:    blockRange,
+		maxRange:      maxRange,
+		indexing:      make(map[string]*sync.Mutex),
+	}
+}
+
+// FollowAll indexes every contract that has a checkpoint up to the
+// confirmed head
+func (x *Indexer) FollowAll(ctx context.Context) error {
+	contracts, err := x.db.Transfers.Indexed(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, contract := range contracts {
+		if err := x.Sync(ctx, contract); err != nil {
+			x.logger.Warnw("Failed to index contract", "contract", contract, "error", err)
+		}
+	}
+
+	return nil
+}
+
+// Sync indexes the logs of contract from its checkpoint up to the confirmed
+// head. A checkpoint whose block left the chain is rolled back first. The
+// checkpoint moves after each block range, so an interrupted sync picks up
+// where it stopped.
+func (x *Indexer) Sync(ctx context.Context, contract string) error {
+	contract = strings.ToLower(contract)
+
+	lock := x.lock(contract)
+	lock.Lock()
+	defer lock.Unlock()
+
+	head, err := x.header(ctx, nil)
+	if err != nil {
+		return err
+	}
+	confirmed := head.Number.Int64() - x.confirmations
+	if confirmed < 0 {
+		return nil
+	}
+
+	checkpoint, err := x.db.Transfers.Checkpoint(ctx, contract)
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		checkpoint = database.Checkpoint{Block: database.BlockRef{Number: -1}}
+	case err != nil:
+		return err
+	default:
+		checkpoint, err = x.checkReorg(ctx, contract, checkpoint)
+		if err != nil {
+			return err
+		}
+	}
+
+	var (
+		start      = checkpoint.Block.Number + 1
+		from       = start
+		blockRange = x.blockRange
+		// ceiling is the last range the node refused, so the range does
+		// not keep bouncing off a limit
+		ceiling   = x.maxRange + 1
+		sinceFail int
+		count     int
+	)
+	for from <= confirmed {
+		to := from + blockRange - 1
+		if to > confirmed {
+			to = confirmed
+		}
+
+		logs, err := x.filterLogs(ctx, contract, from, to)
+		if err != nil {
+			if tooManyResults(err) && blockRange > 1 {
+				ceiling = blockRange
+				sinceFail = 0
+				blockRange /= 2
+				continue
+			}
+			return apierror.Unreachable("infura", err)
+		}
+
+		transfers, err := x.adaptLogs(ctx, logs)
+		if err != nil {
+			return err
+		}
+		header, err := x.header(ctx, big.NewInt(to))
+		if err != nil {
+			return err
+		}
+		checkpoint = advance(checkpoint, database.BlockRef{Number: to, Hash: header.Hash().Hex()})
+		if err := x.db.Transfers.AddIndexed(ctx, contract, transfers, checkpoint); err != nil {
+			return err
+		}
+		count += len(transfers)
+		from = to + 1
+
+		if sinceFail++; sinceFail >= ceilingRanges {
+			ceiling = x.maxRange + 1
+		}
+		switch {
+		case len(logs) > targetLogs:
+			blockRange = (blockRange + 1) / 2
+		case len(logs) < targetLogs/2 && blockRange*2 < ceiling:
+			blockRange *= 2
+			if blockRange > x.maxRange {
+				blockRange = x.maxRange
+			}
+		}
+	}
+
+	x.logger.Infow("Indexed transfers", "contract", contract, "from", start, "to", confirmed, "count", count)
+	return nil
+}
+
+// checkReorg returns checkpoint when its block is still on the chain.
+// Otherwise the chain reorganized deeper than the confirmations, and the
+// contract is rolled back to the newest recent block still on it, or to the
+// start when none is.
+func (x *Indexer) checkReorg(ctx context.Context, contract string, checkpoint database.Checkpoint) (database.Checkpoint, error) {
+	if checkpoint.Block.Number < 0 {
+		return checkpoint, nil
+	}
+
+	refs := append([]database.BlockRef{checkpoint.Block}, checkpoint.Recent...)
+	for i, ref := range refs {
+		header, err := x.header(ctx, big.NewInt(ref.Number))
+		if err != nil {
+			return checkpoint, err
+		}
+		if header.Hash() != common.HexToHash(ref.Hash) {
+			continue
+		}
+		if i == 0 {
+			return checkpoint, nil
+		}
+
+		x.logger.Warnw("Rolling back reorganized blocks", "contract", contract, "from", checkpoint.Block.Number, "to", ref.Number)
+		rolledBack := database.Checkpoint{
+			Block:   ref,
+			Recent:  refs[i+1:],
+			Updated: time.Now(),
+		}
+		return rolledBack, x.db.Transfers.Rollback(ctx, contract, rolledBack)
+	}
+
+	x.logger.Warnw("No recent block left on the chain, indexing again", "contract", contract, "from", checkpoint.Block.Number)
+	rolledBack := database.Checkpoint{
+		Block:   database.BlockRef{Number: -1},
+		Updated: time.Now(),
+	}
+	return rolledBack, x.db.Transfers.Rollback(ctx, contract, rolledBack)
+}
+
+// advance moves checkpoint to block, keeping the block it was at as a recent
+// one
+func advance(checkpoint database.Checkpoint, block database.BlockRef) database.Checkpoint {
+	recent := checkpoint.Recent
+	if checkpoint.Block.Number >= 0 {
+		recent = append([]database.BlockRef{checkpoint.Block}, recent...)
+	}
+	if len(recent) > recentBlocks {
+		recent = recent[:recentBlocks]
+	}
+
+	return database.Checkpoint{
+		Block:   block,
+		Recent:  recent,
+		Updated: time.Now(),
+	}
+}
+
+func (x *Indexer) filterLogs(ctx context.Context, contract string, from, to int64) ([]types.Log, error) {
+	return x.chain.FilterLogs(ctx, ethereum.FilterQuery{
+		FromBlock: big.NewInt(from),
+		ToBlock:   big.NewInt(to),
+		Addresses: []common.Address{common.HexToAddress(contract)},
+		Topics:    [][]common.Hash{{transferTopic, transferSingleTopic, transferBatchTopic}},
+	})
+}
+
+// adaptLogs decodes the transfers in logs, timestamped with their block.
+// Malformed logs are skipped so one bad event does not stop the contract.
+func (x *Indexer) adaptLogs(ctx context.Context, logs []types.Log) ([]database.Transfer, error) {
+	var (
+		transfers []database.Transfer
+		times     = make(map[uint64]time.Time)
+	)
+	for _, log := range logs {
+		decoded, err := decodeLog(log)
+		if err != nil {
+			x.logger.Warnw("Skipping malformed transfer log", "tx", log.TxHash.Hex(), "index", log.Index, "error", err)
+			continue
+		}
+		if len(decoded) == 0 {
+			continue
+		}
+
+		ts, ok := times[log.BlockNumber]
+		if !ok {
+			header, err := x.header(ctx, new(big.Int).SetUint64(log.BlockNumber))
+			if err != nil {
+				return nil, err
+			}
+			ts = time.Unix(int64(header.Time), 0).UTC()
+			times[log.BlockNumber] = ts
+		}
+		for i := range decoded {
+			decoded[i].Timestamp = ts
+		}
+		transfers = append(transfers, decoded...)
+	}
+
+	return transfers, nil
+}
+
+// header returns the header of the block number, or of the head when number
+// is nil
+func (x *Indexer) header(ctx context.Context, number *big.Int) (*types.Header, error) {
+	header, err := x.chain.HeaderByNumber(ctx, number)
+	if err != nil {
+		return nil, apierror.Unreachable("infura", err)
+	}
+	return header, nil
+}
+
+func (x *Indexer) lock(contract string) *sync.Mutex {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	lock, ok := x.indexing[contract]
+	if !ok {
+		lock = &sync.Mutex{}
+		x.indexing[contract] = lock
+	}
+	return lock
+}
@@ -0,0 +1,254 @@
+package indexer
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"math/big"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"go.uber.org/zap"
+)
+
+// emitterCode is the runtime code of a contract that emits a log with the
+// four topics at the start of its calldata and the rest as data
+var emitterCode = hexutil.MustDecode("0x608036036080600037606035604035602035600035608036036000a400")
+
+var emitterAddr = common.HexToAddress("0x00000000000000000000000000000000000e0117")
+
+// testChain is a simulated chain with the emitter deployed
+type testChain struct {
+	*backends.SimulatedBackend
+	t   *testing.T
+	key *ecdsa.PrivateKey
+}
+
+func newTestChain(t *testing.T) *testChain {
+	t.Helper()
+
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{
+		crypto.PubkeyToAddress(key.PublicKey): {Balance: new(big.Int).Lsh(big.NewInt(1), 100)},
+		emitterAddr:                           {Code: emitterCode, Balance: common.Big0},
+	}, 8000000)
+	t.Cleanup(func() { sim.Close() })
+
+	return &testChain{SimulatedBackend: sim, t: t, key: key}
+}
+
+// transfer sends a transaction that emits an ERC-721 Transfer of token, it is
+// mined on the next Commit
+func (c *testChain) transfer(from, to common.Address, token int64) {
+	c.t.Helper()
+
+	var data []byte
+	for _, topic := range []common.Hash{transferTopic, common.BytesToHash(from.Bytes()), common.BytesToHash(to.Bytes()), common.BigToHash(big.NewInt(token))} {
+		data = append(data, topic.Bytes()...)
+	}
+
+	ctx := context.Background()
+	nonce, err := c.PendingNonceAt(ctx, crypto.PubkeyToAddress(c.key.PublicKey))
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	gasPrice, err := c.SuggestGasPrice(ctx)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	tx, err := types.SignTx(types.NewTransaction(nonce, emitterAddr, common.Big0, 100000, gasPrice, data), types.LatestSignerForChainID(big.NewInt(1337)), c.key)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if err := c.SendTransaction(ctx, tx); err != nil {
+		c.t.Fatal(err)
+	}
+}
+
+func newTestIndexer(chain Chain, blockRange, maxRange int64) (*Indexer, *database.DatabaseClient) {
+	db := database.NewMemoryDatabase(database.MemorySeed{})
+	cfg := config.Config{IndexerBlockRange: blockRange, IndexerMaxRange: maxRange}
+	return NewIndexer(cfg, chain, db, zap.NewNop().Sugar()), db
+}
+
+// owners returns the last recipient of each token in the stored transfers
+func owners(t *testing.T, db *database.DatabaseClient) map[string]string {
+	t.Helper()
+
+	transfers, err := db.Transfers.List(context.Background(), strings.ToLower(emitterAddr.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	owners := make(map[string]string)
+	for _, transfer := range transfers {
+		owners[transfer.TokenID] = transfer.To
+	}
+	return owners
+}
+
+func TestSyncIndexesTransfers(t *testing.T) {
+	var (
+		chain = newTestChain(t)
+		x, db = newTestIndexer(chain, 1, 1)
+		ctx   = context.Background()
+	)
+
+	chain.transfer(common.Address{}, alice, 1)
+	chain.transfer(common.Address{}, alice, 2)
+	chain.Commit()
+	chain.transfer(alice, bob, 1)
+	chain.Commit()
+
+	if err := x.Sync(ctx, emitterAddr.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := owners(t, db)
+	if got["1"] != strings.ToLower(bob.Hex()) || got["2"] != strings.ToLower(alice.Hex()) {
+		t.Fatalf("owners = %v, want token 1 with bob and 2 with alice", got)
+	}
+
+	checkpoint, err := db.Transfers.Checkpoint(ctx, strings.ToLower(emitterAddr.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, _ := chain.HeaderByNumber(ctx, nil)
+	if checkpoint.Block.Number != 2 || checkpoint.Block.Hash != head.Hash().Hex() || len(checkpoint.Recent) != 2 {
+		t.Fatalf("checkpoint = %+v, want the head with 2 recent blocks", checkpoint)
+	}
+}
+
+func TestSyncRollsBackReorganizedBlocks(t *testing.T) {
+	var (
+		chain = newTestChain(t)
+		x, db = newTestIndexer(chain, 1, 1)
+		ctx   = context.Background()
+	)
+
+	chain.transfer(common.Address{}, alice, 1)
+	chain.Commit()
+	forkPoint, _ := chain.HeaderByNumber(ctx, nil)
+	chain.transfer(alice, bob, 1)
+	chain.Commit()
+
+	if err := x.Sync(ctx, emitterAddr.Hex()); err != nil {
+		t.Fatal(err)
+	}
+	if got := owners(t, db); got["1"] != strings.ToLower(bob.Hex()) {
+		t.Fatalf("owners = %v before the reorg, want token 1 with bob", got)
+	}
+
+	// Block 2 is replaced by a longer fork where token 1 stays with alice
+	// and token 2 is minted
+	if err := chain.Fork(ctx, forkPoint.Hash()); err != nil {
+		t.Fatal(err)
+	}
+	chain.Commit()
+	chain.transfer(common.Address{}, alice, 2)
+	chain.Commit()
+
+	if err := x.Sync(ctx, emitterAddr.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	got := owners(t, db)
+	if got["1"] != strings.ToLower(alice.Hex()) || got["2"] != strings.ToLower(alice.Hex()) {
+		t.Fatalf("owners = %v after the reorg, want both tokens with alice", got)
+	}
+	checkpoint, err := db.Transfers.Checkpoint(ctx, strings.ToLower(emitterAddr.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, _ := chain.HeaderByNumber(ctx, nil)
+	if checkpoint.Block.Number != 3 || checkpoint.Block.Hash != head.Hash().Hex() {
+		t.Fatalf("checkpoint = %+v, want the new head %s", checkpoint.Block, head.Hash().Hex())
+	}
+	// Recent blocks are newest first, the fork's block 2 then block 1
+	if len(checkpoint.Recent) < 2 || checkpoint.Recent[1].Hash != forkPoint.Hash().Hex() {
+		t.Fatalf("recent = %+v, want them to go through the fork point", checkpoint.Recent)
+	}
+}
+
+// rpcError is a JSON-RPC error as the rpc client returns it
+type rpcError struct {
+	code int
+	msg  string
+}
+
+func (e rpcError) Error() string  { return e.msg }
+func (e rpcError) ErrorCode() int { return e.code }
+
+// limitedChain refuses log queries over more than limit blocks, like a node
+// with too many logs in them, and records the ranges it answered
+type limitedChain struct {
+	Chain
+	limit int64
+
+	mu     sync.Mutex
+	ranges []int64
+}
+
+func (c *limitedChain) FilterLogs(ctx context.Context, q ethereum.FilterQuery) ([]types.Log, error) {
+	size := q.ToBlock.Int64() - q.FromBlock.Int64() + 1
+	if size > c.limit {
+		return nil, rpcError{tooManyResultsCode, "query returned more than 10000 results"}
+	}
+
+	c.mu.Lock()
+	c.ranges = append(c.ranges, size)
+	c.mu.Unlock()
+	return c.Chain.FilterLogs(ctx, q)
+}
+
+func TestSyncAdaptsBlockRange(t *testing.T) {
+	var (
+		sim   = newTestChain(t)
+		chain = &limitedChain{Chain: sim, limit: 4}
+		x, db = newTestIndexer(chain, 1, 16)
+		ctx   = context.Background()
+	)
+
+	for i := 0; i < 40; i++ {
+		sim.Commit()
+	}
+
+	if err := x.Sync(ctx, emitterAddr.Hex()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Blocks 0 to 40 are each queried once, the range doubles up to the
+	// limit and stays there after the node refuses wider ones
+	var covered int64
+	for _, size := range chain.ranges {
+		covered += size
+	}
+	if covered != 41 {
+		t.Fatalf("queried %d blocks in %v, want 41", covered, chain.ranges)
+	}
+	want := []int64{1, 2, 4, 4, 4}
+	for i, size := range want {
+		if chain.ranges[i] != size {
+			t.Fatalf("ranges = %v, want them to start with %v", chain.ranges, want)
+		}
+	}
+
+	checkpoint, err := db.Transfers.Checkpoint(ctx, strings.ToLower(emitterAddr.Hex()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkpoint.Block.Number != 40 {
+		t.Fatalf("checkpoint at block %d, want 40", checkpoint.Block.Number)
+	}
+}
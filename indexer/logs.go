@@ -0,0 +1,118 @@
+package indexer
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/mager/keiko/database"
+)
+
+// Topics of the events that move tokens
+var (
+	transferTopic       = crypto.Keccak256Hash([]byte("Transfer(address,address,uint256)"))
+	transferSingleTopic = crypto.Keccak256Hash([]byte("TransferSingle(address,address,address,uint256,uint256)"))
+	transferBatchTopic  = crypto.Keccak256Hash([]byte("TransferBatch(address,address,address,uint256[],uint256[])"))
+)
+
+// batchArguments are the unindexed ids and values of a TransferBatch
+var batchArguments = func() abi.Arguments {
+	uint256s, err := abi.NewType("uint256[]", "", nil)
+	if err != nil {
+		panic(err)
+	}
+	return abi.Arguments{{Name: "ids", Type: uint256s}, {Name: "values", Type: uint256s}}
+}()
+
+// tooManyResultsCode is the JSON-RPC error code nodes use for log queries
+// over their limits
+const tooManyResultsCode = -32005
+
+// decodeLog returns the transfers in an ERC-721 Transfer, or an ERC-1155
+// TransferSingle or TransferBatch log. ERC-20 Transfer logs share their topic
+// with ERC-721 but do not index a token ID, so they have none.
+func decodeLog(log types.Log) ([]database.Transfer, error) {
+	if len(log.Topics) != 4 {
+		return nil, nil
+	}
+
+	transfer := database.Transfer{
+		Hash:             strings.ToLower(log.TxHash.Hex()),
+		BlockNumber:      int64(log.BlockNumber),
+		TransactionIndex: int(log.TxIndex),
+		LogIndex:         int(log.Index),
+	}
+
+	switch log.Topics[0] {
+	case transferTopic:
+		transfer.Standard = database.StandardERC721
+		transfer.From = topicAddress(log.Topics[1])
+		transfer.To = topicAddress(log.Topics[2])
+		transfer.TokenID = log.Topics[3].Big().String()
+		return []database.Transfer{transfer}, nil
+
+	case transferSingleTopic:
+		if len(log.Data) != 64 {
+			return nil, fmt.Errorf("TransferSingle data is %d bytes", len(log.Data))
+		}
+		transfer.Standard = database.StandardERC1155
+		transfer.From = topicAddress(log.Topics[2])
+		transfer.To = topicAddress(log.Topics[3])
+		transfer.TokenID = new(big.Int).SetBytes(log.Data[:32]).String()
+		transfer.Value = new(big.Int).SetBytes(log.Data[32:]).String()
+		return []database.Transfer{transfer}, nil
+
+	case transferBatchTopic:
+		values, err := batchArguments.Unpack(log.Data)
+		if err != nil {
+			return nil, fmt.Errorf("TransferBatch data: %w", err)
+		}
+		ids, _ := values[0].([]*big.Int)
+		amounts, _ := values[1].([]*big.Int)
+		if len(ids) != len(amounts) {
+			return nil, fmt.Errorf("TransferBatch has %d ids and %d values", len(ids), len(amounts))
+		}
+
+		transfers := make([]database.Transfer, 0, len(ids))
+		for i := range ids {
+			t := transfer
+			t.Standard = database.StandardERC1155
+			t.From = topicAddress(log.Topics[2])
+			t.To = topicAddress(log.Topics[3])
+			t.TokenID = ids[i].String()
+			t.Value = amounts[i].String()
+			t.BatchIndex = i
+			transfers = append(transfers, t)
+		}
+		return transfers, nil
+	}
+
+	return nil, nil
+}
+
+func topicAddress(topic common.Hash) string {
+	return strings.ToLower(common.BytesToAddress(topic.Bytes()).Hex())
+}
+
+// tooManyResults reports whether a log query failed because its block range
+// held more logs than the node returns at once
+func tooManyResults(err error) bool {
+	var rpcErr rpc.Error
+	if errors.As(err, &rpcErr) && rpcErr.ErrorCode() == tooManyResultsCode {
+		return true
+	}
+
+	msg := strings.ToLower(err.Error())
+	for _, s := range []string{"more than", "too many", "block range", "response size"} {
+		if strings.Contains(msg, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,122 @@
+package indexer
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/ethereum/go-ethereum/core/types"
+	"github.com/mager/keiko/database"
+)
+
+var (
+	alice = common.HexToAddress("0x00000000000000000000000000000000000a11ce")
+	bob   = common.HexToAddress("0x0000000000000000000000000000000000000b0b")
+)
+
+// word left pads n to 32 bytes
+func word(n int64) []byte {
+	return common.LeftPadBytes(big.NewInt(n).Bytes(), 32)
+}
+
+func batchData(t *testing.T, ids, values []int64) []byte {
+	t.Helper()
+
+	toBig := func(ns []int64) []*big.Int {
+		out := make([]*big.Int, 0, len(ns))
+		for _, n := range ns {
+			out = append(out, big.NewInt(n))
+		}
+		return out
+	}
+	data, err := batchArguments.Pack(toBig(ids), toBig(values))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDecodeLog(t *testing.T) {
+	var (
+		from     = common.BytesToHash(alice.Bytes())
+		to       = common.BytesToHash(bob.Bytes())
+		operator = common.BytesToHash(common.HexToAddress("0x0000000000000000000000000000000000000123").Bytes())
+		tx       = common.HexToHash("0xabc")
+	)
+
+	tests := []struct {
+		name    string
+		log     types.Log
+		want    []database.Transfer
+		wantErr bool
+	}{
+		{
+			name: "erc721 transfer",
+			log:  types.Log{Topics: []common.Hash{transferTopic, from, to, common.BigToHash(big.NewInt(7))}},
+			want: []database.Transfer{{Standard: database.StandardERC721, TokenID: "7"}},
+		},
+		{
+			name: "erc20 transfer",
+			log:  types.Log{Topics: []common.Hash{transferTopic, from, to}, Data: word(100)},
+		},
+		{
+			name: "transfer single",
+			log:  types.Log{Topics: []common.Hash{transferSingleTopic, operator, from, to}, Data: append(word(7), word(3)...)},
+			want: []database.Transfer{{Standard: database.StandardERC1155, TokenID: "7", Value: "3"}},
+		},
+		{
+			name:    "transfer single with short data",
+			log:     types.Log{Topics: []common.Hash{transferSingleTopic, operator, from, to}, Data: word(7)},
+			wantErr: true,
+		},
+		{
+			name: "transfer batch listing a token twice",
+			log:  types.Log{Topics: []common.Hash{transferBatchTopic, operator, from, to}, Data: batchData(t, []int64{7, 8, 7}, []int64{1, 2, 3})},
+			want: []database.Transfer{
+				{Standard: database.StandardERC1155, TokenID: "7", Value: "1"},
+				{Standard: database.StandardERC1155, TokenID: "8", Value: "2", BatchIndex: 1},
+				{Standard: database.StandardERC1155, TokenID: "7", Value: "3", BatchIndex: 2},
+			},
+		},
+		{
+			name:    "transfer batch with garbage data",
+			log:     types.Log{Topics: []common.Hash{transferBatchTopic, operator, from, to}, Data: word(1)},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.log.TxHash = tx
+			tt.log.BlockNumber = 10
+			tt.log.TxIndex = 2
+			tt.log.Index = 5
+
+			got, err := decodeLog(tt.log)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("decodeLog() = %+v, want an error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("decodeLog() = %+v, want %+v", got, tt.want)
+			}
+			for i, want := range tt.want {
+				want.Hash = "0x0000000000000000000000000000000000000000000000000000000000000abc"
+				want.BlockNumber = 10
+				want.TransactionIndex = 2
+				want.LogIndex = 5
+				want.From = "0x00000000000000000000000000000000000a11ce"
+				want.To = "0x0000000000000000000000000000000000000b0b"
+				if got[i] != want {
+					t.Errorf("transfer %d = %+v, want %+v", i, got[i], want)
+				}
+			}
+		})
+	}
+}
@@ -1,36 +1,110 @@
 package infura
 
 import (
+	"context"
 	"fmt"
+	"net/http"
+	"strings"
 
+	"github.com/ethereum/go-ethereum/common"
 	"github.com/ethereum/go-ethereum/ethclient"
+	"github.com/ethereum/go-ethereum/rpc"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/cassette"
 	"github.com/mager/keiko/config"
 	ens "github.com/wealdtech/go-ens/v3"
 	"go.uber.org/zap"
 )
 
+// ensMisses are the go-ens errors for names and addresses that have no
+// resolution, as opposed to failures talking to the node
+var ensMisses = []string{
+	"unregistered name",
+	"no resolver",
+	"no resolution",
+	"no address",
+	"bad name",
+	"not a resolver",
+	"no contract code at given address",
+}
+
 type InfuraClient struct {
 	Client *ethclient.Client
 	logger *zap.SugaredLogger
+	cache  *cache.Group
 }
 
 // ProvideInfura provides an infura client
-func ProvideInfura(cfg config.Config, logger *zap.SugaredLogger) *InfuraClient {
-	client, _ := ethclient.Dial(fmt.Sprintf("https://mainnet.infura.io/v3/%s", cfg.InfuraKey))
+func ProvideInfura(cfg config.Config, logger *zap.SugaredLogger, c *cache.Cache) *InfuraClient {
+	tr, err := cassette.Transport(cfg, "infura", nil)
+	if err != nil {
+		logger.Fatalw("Failed to set up the Infura transport", "error", err)
+	}
+
+	endpoint := strings.TrimSuffix(cfg.InfuraURL, "/")
+	if cfg.InfuraKey != "" {
+		endpoint += "/" + cfg.InfuraKey
+	}
+	rpcClient, err := rpc.DialHTTPWithClient(endpoint, &http.Client{Transport: tr})
+	if err != nil {
+		logger.Fatalw("Invalid Infura URL", "error", err)
+	}
+
 	return &InfuraClient{
-		Client: client,
+		Client: ethclient.NewClient(rpcClient),
 		logger: logger,
+		cache: c.Group("ens", cache.Policy{
+			TTL:         cfg.ENSTTL,
+			NegativeTTL: cfg.CacheNegativeTTL,
+			StaleTTL:    cfg.CacheStaleTTL,
+		}),
 	}
 }
 
 var Options = ProvideInfura
 
-func (i *InfuraClient) GetAddressFromENSName(ensName string) string {
-	address, err := ens.Resolve(i.Client, ensName)
+// GetAddressFromENSName resolves ensName, names without an address are
+// apierror.ErrNotFound
+func (i *InfuraClient) GetAddressFromENSName(ensName string) (string, error) {
+	v, err := i.cache.Get(context.Background(), "name:"+strings.ToLower(ensName), func(ctx context.Context) (interface{}, error) {
+		address, err := ens.Resolve(i.Client, ensName)
+		if err != nil {
+			return "", adaptENSError(err)
+		}
+		return address.Hex(), nil
+	})
 	if err != nil {
-		i.logger.Error(err)
-		return ""
+		return "", err
 	}
 
-	return address.Hex()
+	return v.(string), nil
+}
+
+// GetENSNameFromAddress returns the primary ENS name of address
+func (i *InfuraClient) GetENSNameFromAddress(address string) (string, error) {
+	v, err := i.cache.Get(context.Background(), "address:"+strings.ToLower(address), func(ctx context.Context) (interface{}, error) {
+		name, err := ens.ReverseResolve(i.Client, common.HexToAddress(address))
+		if err != nil {
+			return "", adaptENSError(err)
+		}
+		return name, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return v.(string), nil
+}
+
+// adaptENSError turns go-ens errors for missing names into not found errors
+// that wrap cache.ErrNotFound so they are negatively cached, anything else
+// is a problem talking to the node
+func adaptENSError(err error) error {
+	for _, miss := range ensMisses {
+		if err.Error() == miss {
+			return apierror.Upstream("ens", apierror.CodeNotFound, "no resolution", fmt.Errorf("%w: %v", cache.ErrNotFound, err))
+		}
+	}
+	return apierror.Unreachable("infura", err)
 }
@@ -5,17 +5,30 @@ import (
 	"net/http"
 
 	"github.com/gorilla/mux"
-	"github.com/mager/go-opensea/opensea"
+	"github.com/mager/keiko/apikey"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/avatar"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/chains"
 	cs "github.com/mager/keiko/coinstats"
 	"github.com/mager/keiko/config"
 	db "github.com/mager/keiko/database"
+	"github.com/mager/keiko/ens"
 	ethscan "github.com/mager/keiko/etherscan"
 	"github.com/mager/keiko/handler"
+	"github.com/mager/keiko/indexer"
 	"github.com/mager/keiko/infura"
 	"github.com/mager/keiko/logger"
+	"github.com/mager/keiko/nft"
 	os "github.com/mager/keiko/opensea"
+	"github.com/mager/keiko/oracle"
+	"github.com/mager/keiko/portfolio"
 	"github.com/mager/keiko/router"
+	"github.com/mager/keiko/siwe"
+	"github.com/mager/keiko/stats"
+	"github.com/mager/keiko/storage"
 	"github.com/mager/keiko/sweeper"
+	"github.com/mager/keiko/transfers"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
@@ -23,15 +36,29 @@ import (
 func main() {
 	fx.New(
 		fx.Provide(
+			apikey.Options,
+			auth.Options,
+			avatar.Options,
+			cache.Options,
+			chains.Options,
 			config.Options,
 			cs.Options,
 			db.Options,
+			ens.Options,
 			ethscan.Options,
+			indexer.Options,
 			infura.Options,
 			logger.Options,
+			nft.Options,
 			os.Options,
+			oracle.Options,
+			portfolio.Options,
 			router.Options,
+			siwe.Options,
+			stats.Options,
+			storage.Options,
 			sweeper.Options,
+			transfers.Options,
 		),
 		fx.Invoke(Register),
 	).Run()
@@ -45,9 +72,22 @@ func Register(
 	dbClient *db.DatabaseClient,
 	infuraClient *infura.InfuraClient,
 	logger *zap.SugaredLogger,
-	openSeaClient *opensea.OpenSeaClient,
+	openSeaClient *os.OpenSeaClient,
 	router *mux.Router,
 	sweeper sweeper.SweeperClient,
+	registry *apikey.Registry,
+	siweService *siwe.Service,
+	avatars *avatar.Processor,
+	blobs storage.BlobStore,
+	nftAvatars *nft.AvatarVerifier,
+	statsService *stats.Service,
+	portfolioService *portfolio.Service,
+	c *cache.Cache,
+	prices *oracle.Oracle,
+	transferService *transfers.Service,
+	ensService *ens.Service,
+	chainRegistry *chains.Registry,
+	verifier *auth.Verifier,
 ) {
 	// TODO: Remove global context
 	ctx := context.Background()
@@ -68,6 +108,7 @@ func Register(
 	// Route handler
 	handler.New(
 		ctx,
+		cfg,
 		logger,
 		router,
 		openSeaClient,
@@ -76,5 +117,18 @@ func Register(
 		infuraClient,
 		etherscanClient,
 		sweeper,
+		registry,
+		siweService,
+		avatars,
+		blobs,
+		nftAvatars,
+		statsService,
+		portfolioService,
+		c,
+		prices,
+		transferService,
+		ensService,
+		chainRegistry,
+		verifier,
 	)
 }
@@ -0,0 +1,221 @@
+package nft
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/infura"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid_token")
+	ErrNotOwner     = errors.New("not_owner")
+)
+
+// AvatarVerifier makes sure NFT avatars belong to their user, when they are
+// set and then on an interval. Avatars whose token left the wallet are
+// removed so the default is shown instead.
+type AvatarVerifier struct {
+	client *Client
+	db     *database.DatabaseClient
+	logger *zap.SugaredLogger
+}
+
+// ProvideAvatarVerifier provides an AvatarVerifier that re-checks every NFT
+// avatar on the NFTAvatarRecheckInterval
+func ProvideAvatarVerifier(
+	lc fx.Lifecycle,
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	db *database.DatabaseClient,
+	infuraClient *infura.InfuraClient,
+) *AvatarVerifier {
+	v := NewAvatarVerifier(NewClient(infuraClient.Client, logger), db, logger)
+
+	ticker := time.NewTicker(cfg.NFTAvatarRecheckInterval)
+	done := make(chan struct{})
+
+	lc.Append(
+		fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					for {
+						select {
+						case <-ticker.C:
+							if err := v.RecheckAll(context.Background()); err != nil {
+								logger.Errorw("Failed to re-check NFT avatars", "error", err)
+							}
+						case <-done:
+							return
+						}
+					}
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				ticker.Stop()
+				close(done)
+				return nil
+			},
+		},
+	)
+
+	return v
+}
+
+var Options = ProvideAvatarVerifier
+
+// NewAvatarVerifier creates an AvatarVerifier, it does not re-check on its own
+func NewAvatarVerifier(client *Client, db *database.DatabaseClient, logger *zap.SugaredLogger) *AvatarVerifier {
+	return &AvatarVerifier{
+		client: client,
+		db:     db,
+		logger: logger,
+	}
+}
+
+// Avatar checks that owner holds the token and returns the avatar to record.
+// image is used when set, otherwise it is read from the token metadata.
+func (v *AvatarVerifier) Avatar(ctx context.Context, owner, contract, tokenID, image string) (database.Avatar, error) {
+	var avatar database.Avatar
+
+	if !common.IsHexAddress(contract) {
+		return avatar, ErrInvalidToken
+	}
+	id, ok := new(big.Int).SetString(tokenID, 10)
+	if !ok || id.Sign() < 0 {
+		return avatar, ErrInvalidToken
+	}
+	contractAddr := common.HexToAddress(contract)
+
+	standard, err := v.client.Standard(ctx, contractAddr)
+	if err != nil {
+		return avatar, err
+	}
+
+	owned, err := v.client.Owns(ctx, standard, common.HexToAddress(owner), contractAddr, id)
+	if err != nil {
+		return avatar, err
+	}
+	if !owned {
+		return avatar, ErrNotOwner
+	}
+
+	if image == "" {
+		image, err = v.image(ctx, standard, contractAddr, id)
+		if err != nil {
+			return avatar, err
+		}
+	}
+
+	now := time.Now()
+	avatar = database.Avatar{
+		Source:  database.AvatarSourceNFT,
+		URL:     image,
+		Updated: now,
+		NFT: &database.AvatarNFT{
+			Contract: strings.ToLower(contract),
+			TokenID:  id.String(),
+			Standard: standard,
+			Verified: now,
+		},
+	}
+
+	return avatar, nil
+}
+
+func (v *AvatarVerifier) image(ctx context.Context, standard string, contract common.Address, id *big.Int) (string, error) {
+	uri, err := v.client.TokenURI(ctx, standard, contract, id)
+	if err != nil {
+		return "", err
+	}
+
+	md, err := v.client.Metadata(ctx, uri)
+	if err != nil {
+		return "", err
+	}
+
+	return md.ImageLink()
+}
+
+// RecheckAll re-checks the ownership of every NFT avatar
+func (v *AvatarVerifier) RecheckAll(ctx context.Context) error {
+	records, err := v.db.Users.ListByAvatarSource(ctx, database.AvatarSourceNFT)
+	if err != nil {
+		return err
+	}
+
+	var removed int
+	for _, record := range records {
+		lost, err := v.Recheck(ctx, record.Address, record.User.Avatar)
+		if err != nil {
+			// Try again on the next run rather than dropping the avatar
+			v.logger.Warnw("Failed to re-check NFT avatar", "address", record.Address, "error", err)
+			continue
+		}
+		if lost {
+			removed++
+		}
+	}
+
+	v.logger.Infow("Re-checked NFT avatars", "checked", len(records), "removed", removed)
+
+	return nil
+}
+
+// Recheck confirms that address still holds its avatar token. The avatar is
+// removed when it does not and lost is true.
+func (v *AvatarVerifier) Recheck(ctx context.Context, address string, avatar *database.Avatar) (lost bool, err error) {
+	if avatar == nil || avatar.NFT == nil {
+		return false, nil
+	}
+
+	owned, err := v.client.Owns(
+		ctx,
+		avatar.NFT.Standard,
+		common.HexToAddress(address),
+		common.HexToAddress(avatar.NFT.Contract),
+		tokenID(avatar.NFT.TokenID),
+	)
+	if err != nil {
+		return false, err
+	}
+
+	// The user may have picked another avatar since the list was read
+	current, err := v.db.Users.Get(ctx, address)
+	if err != nil {
+		return false, err
+	}
+	if current.Avatar == nil || current.Avatar.NFT == nil ||
+		current.Avatar.NFT.Contract != avatar.NFT.Contract || current.Avatar.NFT.TokenID != avatar.NFT.TokenID {
+		return false, nil
+	}
+
+	if !owned {
+		v.logger.Infow("NFT avatar left the wallet", "address", address, "contract", avatar.NFT.Contract, "tokenId", avatar.NFT.TokenID)
+		return true, v.db.Users.UpdateAvatar(ctx, address, nil)
+	}
+
+	updated := *avatar
+	nft := *avatar.NFT
+	nft.Verified = time.Now()
+	updated.NFT = &nft
+
+	return false, v.db.Users.UpdateAvatar(ctx, address, &updated)
+}
+
+func tokenID(s string) *big.Int {
+	id, ok := new(big.Int).SetString(s, 10)
+	if !ok {
+		return new(big.Int)
+	}
+	return id
+}
@@ -0,0 +1,127 @@
+package nft
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	ipfsGateway = "https://ipfs.io/ipfs/"
+	// maxMetadataBytes bounds the metadata documents we are willing to read
+	maxMetadataBytes = 1 << 20
+)
+
+// ErrNoImage is returned when the token metadata has no image
+var ErrNoImage = errors.New("no_image")
+
+// Metadata is the subset of the ERC-721/ERC-1155 metadata JSON keiko uses
+type Metadata struct {
+	Name  string `json:"name"`
+	Image string `json:"image"`
+	// ImageURL is used by some older collections instead of image
+	ImageURL string `json:"image_url"`
+}
+
+// Metadata fetches and parses the metadata at the token URI
+func (c *Client) Metadata(ctx context.Context, tokenURI string) (Metadata, error) {
+	var md Metadata
+
+	body, err := c.fetch(ctx, tokenURI)
+	if err != nil {
+		return md, err
+	}
+
+	err = json.Unmarshal(body, &md)
+	return md, err
+}
+
+// ImageLink returns an HTTP(S) URL for the metadata image
+func (md Metadata) ImageLink() (string, error) {
+	image := md.Image
+	if image == "" {
+		image = md.ImageURL
+	}
+	if image == "" {
+		return "", ErrNoImage
+	}
+
+	// Inline SVGs and other data URIs can be used by an <img> as they are
+	if strings.HasPrefix(image, "data:image/") {
+		return image, nil
+	}
+
+	link := GatewayURL(image)
+	u, err := url.Parse(link)
+	if err != nil || (u.Scheme != "https" && u.Scheme != "http") {
+		return "", fmt.Errorf("%w: unsupported image URI %q", ErrNoImage, image)
+	}
+
+	return link, nil
+}
+
+// GatewayURL rewrites ipfs:// and ar:// URIs to public HTTP gateways
+func GatewayURL(uri string) string {
+	switch {
+	case strings.HasPrefix(uri, "ipfs://ipfs/"):
+		return ipfsGateway + strings.TrimPrefix(uri, "ipfs://ipfs/")
+	case strings.HasPrefix(uri, "ipfs://"):
+		return ipfsGateway + strings.TrimPrefix(uri, "ipfs://")
+	case strings.HasPrefix(uri, "ar://"):
+		return "https://arweave.net/" + strings.TrimPrefix(uri, "ar://")
+	}
+	return uri
+}
+
+// fetch reads a metadata document from an HTTP(S), IPFS or data URI
+func (c *Client) fetch(ctx context.Context, uri string) ([]byte, error) {
+	if strings.HasPrefix(uri, "data:") {
+		_, data, err := DecodeDataURI(uri)
+		return data, err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "GET", GatewayURL(uri), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching metadata: %s", resp.Status)
+	}
+
+	return io.ReadAll(io.LimitReader(resp.Body, maxMetadataBytes))
+}
+
+// DecodeDataURI returns the media type and content of a data URI, as used
+// by fully on-chain collections, e.g. data:application/json;base64,...
+func DecodeDataURI(uri string) (string, []byte, error) {
+	idx := strings.Index(uri, ",")
+	if !strings.HasPrefix(uri, "data:") || idx < 0 {
+		return "", nil, errors.New("malformed data URI")
+	}
+	header, data := uri[len("data:"):idx], uri[idx+1:]
+	mediaType := strings.Split(header, ";")[0]
+
+	if strings.HasSuffix(header, ";base64") {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		return mediaType, decoded, err
+	}
+
+	decoded, err := url.PathUnescape(data)
+	if err != nil {
+		return mediaType, []byte(data), nil
+	}
+	return mediaType, []byte(decoded), nil
+}
@@ -0,0 +1,70 @@
+package nft
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"go.uber.org/zap"
+)
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"image":"https://example.com/1.png"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(nil, zap.NewNop().Sugar())
+
+	for _, uri := range []string{
+		srv.URL,
+		"http://localhost:" + strconv.Itoa(srv.Listener.Addr().(*net.TCPAddr).Port),
+	} {
+		_, err := c.Metadata(context.Background(), uri)
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("Metadata(%s) error = %v, want %v", uri, err, ErrBlockedAddress)
+		}
+	}
+}
+
+func TestFetchDataURI(t *testing.T) {
+	c := NewClient(nil, zap.NewNop().Sugar())
+
+	md, err := c.Metadata(context.Background(), `data:application/json,{"name":"On-chain"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if md.Name != "On-chain" {
+		t.Errorf("Name = %q, want On-chain", md.Name)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{"8.8.8.8", true},
+		{"2606:4700::1111", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.20.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:127.0.0.1", false},
+	}
+
+	for _, tt := range tests {
+		if got := isPublicIP(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("isPublicIP(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
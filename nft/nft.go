@@ -0,0 +1,165 @@
+package nft
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"go.uber.org/zap"
+)
+
+// Token standards
+const (
+	ERC721  = "erc721"
+	ERC1155 = "erc1155"
+)
+
+const tokenABI = `[
+	{"name":"supportsInterface","type":"function","stateMutability":"view","inputs":[{"name":"interfaceId","type":"bytes4"}],"outputs":[{"name":"","type":"bool"}]},
+	{"name":"ownerOf","type":"function","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"address"}]},
+	{"name":"tokenURI","type":"function","stateMutability":"view","inputs":[{"name":"tokenId","type":"uint256"}],"outputs":[{"name":"","type":"string"}]},
+	{"name":"balanceOf","type":"function","stateMutability":"view","inputs":[{"name":"account","type":"address"},{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"uint256"}]},
+	{"name":"uri","type":"function","stateMutability":"view","inputs":[{"name":"id","type":"uint256"}],"outputs":[{"name":"","type":"string"}]}
+]`
+
+// ERC-165 interface IDs
+var (
+	erc721InterfaceID  = [4]byte{0x80, 0xac, 0x58, 0xcd}
+	erc1155InterfaceID = [4]byte{0xd9, 0xb6, 0x7a, 0x26}
+)
+
+// metadataTimeout bounds how long a metadata server has to respond
+const metadataTimeout = 10 * time.Second
+
+// ErrUnsupportedContract is returned for contracts that are neither ERC-721
+// nor ERC-1155
+var ErrUnsupportedContract = errors.New("unsupported_contract")
+
+// Client reads NFT ownership and metadata from the chain
+type Client struct {
+	caller bind.ContractCaller
+	abi    abi.ABI
+	http   *http.Client
+	logger *zap.SugaredLogger
+}
+
+// NewClient creates a Client that calls contracts through caller
+func NewClient(caller bind.ContractCaller, logger *zap.SugaredLogger) *Client {
+	parsed, err := abi.JSON(strings.NewReader(tokenABI))
+	if err != nil {
+		panic(err)
+	}
+
+	return &Client{
+		caller: caller,
+		abi:    parsed,
+		http:   newPublicHTTPClient(metadataTimeout),
+		logger: logger,
+	}
+}
+
+// Standard returns the token standard the contract implements, per ERC-165
+func (c *Client) Standard(ctx context.Context, contract common.Address) (string, error) {
+	for _, candidate := range []struct {
+		standard string
+		id       [4]byte
+	}{
+		{ERC721, erc721InterfaceID},
+		{ERC1155, erc1155InterfaceID},
+	} {
+		var supported bool
+		err := c.call(ctx, contract, "supportsInterface", &supported, candidate.id)
+		if isRevert(err) {
+			// Contracts without ERC-165 revert or have no such method
+			return "", ErrUnsupportedContract
+		}
+		if err != nil {
+			return "", err
+		}
+		if supported {
+			return candidate.standard, nil
+		}
+	}
+
+	return "", ErrUnsupportedContract
+}
+
+// Owns reports whether owner holds the token
+func (c *Client) Owns(ctx context.Context, standard string, owner, contract common.Address, tokenID *big.Int) (bool, error) {
+	switch standard {
+	case ERC721:
+		var holder common.Address
+		err := c.call(ctx, contract, "ownerOf", &holder, tokenID)
+		if isRevert(err) {
+			// ownerOf reverts for tokens that were never minted or were burned
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		return holder == owner, nil
+	case ERC1155:
+		var balance *big.Int
+		if err := c.call(ctx, contract, "balanceOf", &balance, owner, tokenID); err != nil {
+			return false, err
+		}
+		return balance.Sign() > 0, nil
+	}
+
+	return false, ErrUnsupportedContract
+}
+
+// TokenURI returns the metadata URI of the token, with the ERC-1155 {id}
+// placeholder filled in
+func (c *Client) TokenURI(ctx context.Context, standard string, contract common.Address, tokenID *big.Int) (string, error) {
+	var uri string
+
+	switch standard {
+	case ERC721:
+		if err := c.call(ctx, contract, "tokenURI", &uri, tokenID); err != nil {
+			return "", err
+		}
+	case ERC1155:
+		if err := c.call(ctx, contract, "uri", &uri, tokenID); err != nil {
+			return "", err
+		}
+		uri = strings.ReplaceAll(uri, "{id}", fmt.Sprintf("%064x", tokenID))
+	default:
+		return "", ErrUnsupportedContract
+	}
+
+	return uri, nil
+}
+
+func (c *Client) call(ctx context.Context, contract common.Address, method string, out interface{}, args ...interface{}) error {
+	data, err := c.abi.Pack(method, args...)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.caller.CallContract(ctx, ethereum.CallMsg{To: &contract, Data: data}, nil)
+	if err != nil {
+		return err
+	}
+	if len(res) == 0 {
+		// Calls to missing methods on contracts without a fallback, or to
+		// accounts without code, return nothing
+		return errRevert
+	}
+
+	return c.abi.UnpackIntoInterface(out, method, res)
+}
+
+var errRevert = errors.New("execution reverted")
+
+func isRevert(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "revert")
+}
@@ -0,0 +1,87 @@
+package opensea
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/mager/keiko/apierror"
+)
+
+var errCircuitOpen = errors.New("circuit open")
+
+// breaker fails requests fast once threshold requests in a row found OpenSea
+// down. After the cooldown one request is let through to probe it, and its
+// result closes or reopens the breaker.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{threshold: threshold, cooldown: cooldown}
+}
+
+// allow returns an error while the breaker is open
+func (b *breaker) allow() error {
+	if b.threshold <= 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.failures < b.threshold {
+		return nil
+	}
+	if wait := time.Until(b.openUntil); wait > 0 {
+		return b.openError(wait)
+	}
+	if b.probing {
+		return b.openError(0)
+	}
+
+	b.probing = true
+	return nil
+}
+
+// record counts the outcome of a request. Only OpenSea being unreachable or
+// erroring counts as a failure, a 404 or a rate limit means it is up.
+func (b *breaker) record(err error) {
+	if b.threshold <= 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+	if !errors.Is(err, apierror.ErrUpstreamUnavailable) {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.failures >= b.threshold {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
+
+// release ends a request without counting it, for callers that gave up
+// before OpenSea answered
+func (b *breaker) release() {
+	b.mu.Lock()
+	b.probing = false
+	b.mu.Unlock()
+}
+
+func (b *breaker) openError(wait time.Duration) error {
+	e := apierror.Unreachable("opensea", errCircuitOpen)
+	e.RetryAfter = wait
+	return e
+}
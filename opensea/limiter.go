@@ -0,0 +1,91 @@
+package opensea
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// limiter is a token bucket shared by every request of a client. Requests
+// that find it empty queue up behind each other rather than all retrying at
+// once.
+type limiter struct {
+	rate  float64
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	// last is when tokens was last refilled, it is in the future while the
+	// bucket is paused
+	last time.Time
+}
+
+func newLimiter(rate float64, burst int) *limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &limiter{
+		rate:   rate,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+	}
+}
+
+// wait blocks until the request can be sent, or until ctx is done
+func (l *limiter) wait(ctx context.Context) error {
+	return sleep(ctx, l.reserve())
+}
+
+// sleep waits for d, it returns early with ctx's error once ctx is done
+func sleep(ctx context.Context, d time.Duration) error {
+	if d <= 0 {
+		return ctx.Err()
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// reserve takes a token and returns how long to wait until it is available
+func (l *limiter) reserve() time.Duration {
+	if l.rate <= 0 {
+		return 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if now.After(l.last) {
+		l.tokens = math.Min(l.burst, l.tokens+now.Sub(l.last).Seconds()*l.rate)
+		l.last = now
+	}
+	l.tokens--
+
+	delay := l.last.Sub(now)
+	if l.tokens < 0 {
+		delay += time.Duration(-l.tokens / l.rate * float64(time.Second))
+	}
+	return delay
+}
+
+// pause holds every new request for d, as asked by a Retry-After
+func (l *limiter) pause(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	until := time.Now().Add(d)
+	if until.After(l.last) {
+		l.last = until
+		l.tokens = math.Min(l.tokens, 0)
+	}
+}
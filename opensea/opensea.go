@@ -1,27 +1,32 @@
 package opensea
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"log"
+	"math/rand"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
-	"github.com/mager/go-opensea/opensea"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/cassette"
 	"github.com/mager/keiko/config"
 
 	"go.uber.org/zap"
 )
 
 var (
-	OpenSeaRateLimit     = 250 * time.Millisecond
 	OpenSeaNotFoundError = "collection_not_found"
 )
 
+// NewOpenSeaNotFoundError returns the error for a collection that does not
+// exist, it wraps cache.ErrNotFound so misses are negatively cached
 func NewOpenSeaNotFoundError() error {
-	return errors.New(OpenSeaNotFoundError)
+	return apierror.Upstream("opensea", apierror.CodeNotFound, OpenSeaNotFoundError, cache.ErrNotFound)
 }
 
 // OpenSeaV1CollectionResp represents an OpenSea collection and also the response from
@@ -32,10 +37,11 @@ type OpenSeaCollectionResp struct {
 
 // OpenSeaCollection is the inner collection object
 type OpenSeaCollection struct {
-	Name     string                `json:"name"`
-	Slug     string                `json:"slug"`
-	ImageURL string                `json:"image_url"`
-	Stats    OpenSeaCollectionStat `json:"stats"`
+	Name                  string                         `json:"name"`
+	Slug                  string                         `json:"slug"`
+	ImageURL              string                         `json:"image_url"`
+	Stats                 OpenSeaCollectionStat          `json:"stats"`
+	PrimaryAssetContracts []OpenSeaPrimaryAssetContracts `json:"primary_asset_contracts"`
 }
 
 // OpenSeaCollectionCollection represents an OpenSea collection and also the response from
@@ -57,6 +63,10 @@ type OpenSeaCollectionV2 struct {
 	ImageURL        string `json:"image_url"`
 	Hidden          bool   `json:"hidden"`
 	OwnedAssetCount int    `json:"owned_asset_count"`
+	// FloorPrice is in FloorPriceSymbol, such as "ETH" or "MATIC", and
+	// only set by the v2 API
+	FloorPrice       float64 `json:"floor_price,omitempty"`
+	FloorPriceSymbol string  `json:"floor_price_symbol,omitempty"`
 }
 
 // OpenSeaAssetV2 is an experiment
@@ -157,115 +167,229 @@ type OpenSeaClient struct {
 	httpClient *http.Client
 	apiKey     string
 	logger     *zap.SugaredLogger
+	cache      *cache.Group
+	// baseURL is the OpenSea API without a trailing slash, v2 picks the v2
+	// routes and chain is the chain they are scoped to by default
+	baseURL string
+	v2      bool
+	chain   string
+
+	limiter     *limiter
+	breaker     *breaker
+	maxRetries  int
+	backoffBase time.Duration
+	backoffMax  time.Duration
 }
 
 var (
 	DEFAULT_LIMIT = 50
 )
 
-// ProvideOpenSea provides an HTTP client
-func ProvideOpenSea(cfg config.Config) *opensea.OpenSeaClient {
-	client := opensea.NewOpenSeaClient(cfg.OpenSeaAPIKey)
+// ProvideOpenSea provides an OpenSeaClient
+func ProvideOpenSea(cfg config.Config, logger *zap.SugaredLogger, c *cache.Cache) *OpenSeaClient {
+	if cfg.OpenSeaAPIVersion != "v1" && cfg.OpenSeaAPIVersion != "v2" {
+		logger.Fatalw("Unknown OpenSea API version", "version", cfg.OpenSeaAPIVersion)
+	}
+
+	tr, err := cassette.Transport(cfg, "opensea", nil)
+	if err != nil {
+		logger.Fatalw("Failed to set up the OpenSea transport", "error", err)
+	}
+
+	client := NewOpenSeaClient(cfg, logger, c)
+	client.httpClient.Transport = tr
 	return client
 }
 
 var Options = ProvideOpenSea
 
-// GetCollectionsForAddress returns the collections for an address
-func (o *OpenSeaClient) GetCollectionsForAddress(address string, offset int) ([]OpenSeaCollectionCollection, error) {
-	u, err := url.Parse("https://api.opensea.io/api/v1/collections")
-	if err != nil {
-		o.logger.Error(err)
-		return []OpenSeaCollectionCollection{}, nil
+// OnChain returns a client whose v2 lookups are scoped to chain, such as
+// "matic" or "base". It shares the rate limiter, circuit breaker and cache
+// of o.
+func (o *OpenSeaClient) OnChain(chain string) *OpenSeaClient {
+	scoped := *o
+	scoped.chain = chain
+	return &scoped
+}
+
+// Chain returns the chain the client's v2 lookups are scoped to
+func (o *OpenSeaClient) Chain() string {
+	return o.chain
+}
+
+// NewOpenSeaClient creates an OpenSeaClient whose collection lookups are
+// cached in c. Its requests share one rate limiter and circuit breaker, so
+// create one client and share it.
+func NewOpenSeaClient(cfg config.Config, logger *zap.SugaredLogger, c *cache.Cache) *OpenSeaClient {
+	return &OpenSeaClient{
+		httpClient: &http.Client{Timeout: 30 * time.Second},
+		apiKey:     cfg.OpenSeaAPIKey,
+		logger:     logger,
+		cache: c.Group("opensea", cache.Policy{
+			TTL:         cfg.OpenSeaTTL,
+			NegativeTTL: cfg.CacheNegativeTTL,
+			StaleTTL:    cfg.CacheStaleTTL,
+		}),
+		baseURL:     strings.TrimSuffix(cfg.OpenSeaBaseURL, "/"),
+		v2:          cfg.OpenSeaAPIVersion == "v2",
+		chain:       cfg.OpenSeaChain,
+		limiter:     newLimiter(cfg.OpenSeaRequestsPerSecond, cfg.OpenSeaBurst),
+		breaker:     newBreaker(cfg.OpenSeaBreakerThreshold, cfg.OpenSeaBreakerCooldown),
+		maxRetries:  cfg.OpenSeaMaxRetries,
+		backoffBase: cfg.OpenSeaBackoffBase,
+		backoffMax:  cfg.OpenSeaBackoffMax,
 	}
-	q := u.Query()
-	q.Set("offset", fmt.Sprintf("%d", offset))
-	q.Set("limit", fmt.Sprintf("%d", 50))
-	q.Set("asset_owner", address)
-	u.RawQuery = q.Encode()
+}
 
-	// Fetch collections
-	req, err := http.NewRequest("GET", u.String(), nil)
-	req.Header.Set("X-API-KEY", o.apiKey)
+// get fetches u from the OpenSea API and decodes the JSON response into out.
+// Rate limits and 5xx are retried with backoff, a Retry-After holds every
+// request of the client, and nothing is sent while the breaker is open. It
+// stops waiting as soon as ctx is done.
+func (o *OpenSeaClient) get(ctx context.Context, u string, out interface{}) error {
+	for attempt := 0; ; attempt++ {
+		if err := o.breaker.allow(); err != nil {
+			return err
+		}
+		if err := o.limiter.wait(ctx); err != nil {
+			return err
+		}
+
+		err := o.do(ctx, u, out)
+		if ctx.Err() != nil {
+			// The caller went away, which says nothing about OpenSea
+			o.breaker.release()
+			return ctx.Err()
+		}
+		o.breaker.record(err)
+		if err == nil {
+			return nil
+		}
+
+		var e *apierror.Error
+		if !errors.As(err, &e) || (e.Code != apierror.CodeRateLimited && e.Code != apierror.CodeUpstreamUnavailable) {
+			return err
+		}
+		if e.RetryAfter > 0 {
+			o.limiter.pause(e.RetryAfter)
+		}
+		if attempt >= o.maxRetries || e.RetryAfter > o.backoffMax {
+			o.logger.Warnw("OpenSea request failed", "url", u, "attempts", attempt+1, "error", err)
+			return err
+		}
+
+		delay := o.backoff(attempt)
+		if e.RetryAfter > delay {
+			delay = e.RetryAfter
+		}
+		o.logger.Infow("Retrying OpenSea request", "url", u, "attempt", attempt+1, "delay", delay, "error", err)
+		if err := sleep(ctx, delay); err != nil {
+			return err
+		}
+	}
+}
+
+// backoff returns a random delay up to backoffBase doubled for each attempt,
+// capped at backoffMax, so retrying requests spread out
+func (o *OpenSeaClient) backoff(attempt int) time.Duration {
+	d := o.backoffBase
+	for i := 0; i < attempt && d < o.backoffMax; i++ {
+		d *= 2
+	}
+	if d > o.backoffMax {
+		d = o.backoffMax
+	}
+	if d <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(d)))
+}
+
+// do sends a single request
+func (o *OpenSeaClient) do(ctx context.Context, u string, out interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", u, nil)
 	if err != nil {
-		o.logger.Error(err)
-		return []OpenSeaCollectionCollection{}, nil
+		return err
 	}
+	req.Header.Set("X-API-KEY", o.apiKey)
 
 	resp, err := o.httpClient.Do(req)
 	if err != nil {
-		o.logger.Error(err)
-		return []OpenSeaCollectionCollection{}, nil
+		return apierror.Unreachable("opensea", err)
 	}
 	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		o.logger.Error("Too many requests, please try again later", "status", resp.StatusCode)
-		return []OpenSeaCollectionCollection{}, nil
+	if err := apierror.FromResponse("opensea", resp); err != nil {
+		return err
 	}
 
-	var openSeaCollections []OpenSeaCollectionCollection
-	err = json.NewDecoder(resp.Body).Decode(&openSeaCollections)
+	err = json.NewDecoder(resp.Body).Decode(out)
 	if err != nil {
-
-		o.logger.Error(err)
-		return []OpenSeaCollectionCollection{}, nil
+		return apierror.Decode("opensea", err)
 	}
 
-	o.logger.Info("Fetched collections from OpenSea", "address", address, "offset", offset, "count", len(openSeaCollections))
-
-	// TODO: Remove once OpenSea fixes rate limit
-	time.Sleep(OpenSeaRateLimit)
-
-	return openSeaCollections, nil
+	return nil
 }
 
-// GetCollectionsForAddressV2 returns the collections for an address SIMPLER
-func (o *OpenSeaClient) GetCollectionsForAddressV2(address string, offset int) ([]OpenSeaCollectionV2, error) {
-	var collections = []OpenSeaCollectionV2{}
-	u, err := url.Parse("https://api.opensea.io/api/v1/collections")
+// GetCollectionsForAddress returns the collections for an address
+func (o *OpenSeaClient) GetCollectionsForAddress(ctx context.Context, address string, offset int) ([]OpenSeaCollectionCollection, error) {
+	u, err := url.Parse(o.baseURL + "/api/v1/collections")
 	if err != nil {
-		o.logger.Error(err)
-		return collections, nil
+		return []OpenSeaCollectionCollection{}, err
 	}
 	q := u.Query()
 	q.Set("offset", fmt.Sprintf("%d", offset))
-	q.Set("limit", fmt.Sprintf("%d", 50))
+	q.Set("limit", fmt.Sprintf("%d", DEFAULT_LIMIT))
 	q.Set("asset_owner", address)
 	u.RawQuery = q.Encode()
 
 	// Fetch collections
-	o.logger.Infow("Fetching collections from OpenSea V2", "address", address, "offset", offset)
-	req, err := http.NewRequest("GET", u.String(), nil)
-	req.Header.Set("X-API-KEY", o.apiKey)
+	var openSeaCollections []OpenSeaCollectionCollection
+	err = o.get(ctx, u.String(), &openSeaCollections)
 	if err != nil {
-		o.logger.Error(err)
-		return collections, nil
+		return []OpenSeaCollectionCollection{}, err
 	}
 
-	resp, err := o.httpClient.Do(req)
+	o.logger.Infow("Fetched collections from OpenSea", "address", address, "offset", offset, "count", len(openSeaCollections))
+
+	return openSeaCollections, nil
+}
+
+// GetCollectionsForAddressV2 returns the collections for an address SIMPLER
+func (o *OpenSeaClient) GetCollectionsForAddressV2(ctx context.Context, address string, offset int) ([]OpenSeaCollectionV2, error) {
+	collections, err := o.collectionsPageV2(ctx, address, offset)
 	if err != nil {
-		o.logger.Error(err)
-		return collections, nil
+		return []OpenSeaCollectionV2{}, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusTooManyRequests {
-		o.logger.Error("Too many requests, please try again later", "status", resp.StatusCode)
-		return collections, nil
-	}
+	return visibleCollections(collections), nil
+}
 
-	err = json.NewDecoder(resp.Body).Decode(&collections)
+// collectionsPageV2 returns a page of collections, hidden ones included so
+// that a page of only hidden collections is not mistaken for the last one
+func (o *OpenSeaClient) collectionsPageV2(ctx context.Context, address string, offset int) ([]OpenSeaCollectionV2, error) {
+	var collections = []OpenSeaCollectionV2{}
+	u, err := url.Parse(o.baseURL + "/api/v1/collections")
 	if err != nil {
+		return collections, err
+	}
+	q := u.Query()
+	q.Set("offset", fmt.Sprintf("%d", offset))
+	q.Set("limit", fmt.Sprintf("%d", DEFAULT_LIMIT))
+	q.Set("asset_owner", address)
+	u.RawQuery = q.Encode()
 
-		o.logger.Error(err)
-		return collections, nil
+	// Fetch collections
+	o.logger.Infow("Fetching collections from OpenSea V2", "address", address, "offset", offset)
+	err = o.get(ctx, u.String(), &collections)
+	if err != nil {
+		return []OpenSeaCollectionV2{}, err
 	}
 
-	// TODO: Remove once OpenSea fixes rate limit
-	time.Sleep(OpenSeaRateLimit)
+	return collections, nil
+}
 
-	// Filter out hidden collections
+// visibleCollections filters out hidden collections
+func visibleCollections(collections []OpenSeaCollectionV2) []OpenSeaCollectionV2 {
 	var filtered = []OpenSeaCollectionV2{}
 	for _, collection := range collections {
 		if !collection.Hidden {
@@ -273,79 +397,53 @@ func (o *OpenSeaClient) GetCollectionsForAddressV2(address string, offset int) (
 		}
 	}
 
-	return filtered, nil
+	return filtered
 }
 
-// GetCollectionStatsForSlug returns the stats for a collection
-func (o *OpenSeaClient) GetCollectionStatsForSlug(slug string) (OpenSeaCollectionStat, error) {
-	u, err := url.Parse(fmt.Sprintf("https://api.opensea.io/api/v1/collection/%s/stats", slug))
-	if err != nil {
-		o.logger.Error(err)
-		return OpenSeaCollectionStat{}, nil
+// GetCollectionStatsForSlug returns the stats for a collection, cached for
+// the OpenSeaTTL
+func (o *OpenSeaClient) GetCollectionStatsForSlug(ctx context.Context, slug string) (OpenSeaCollectionStat, error) {
+	if o.v2 {
+		detail, err := o.collectionDetail(ctx, slug)
+		return detail.Stats, err
 	}
-	q := u.Query()
-	u.RawQuery = q.Encode()
 
-	// Fetch stats
-	req, err := http.NewRequest("GET", u.String(), nil)
-	req.Header.Set("X-API-KEY", o.apiKey)
+	v, err := o.cache.Get(ctx, "stats:"+slug, func(ctx context.Context) (interface{}, error) {
+		return o.fetchCollectionStats(ctx, slug)
+	})
 	if err != nil {
-		o.logger.Error(err)
-		return OpenSeaCollectionStat{}, nil
+		return OpenSeaCollectionStat{}, err
 	}
 
-	resp, err := o.httpClient.Do(req)
-	if resp.StatusCode == http.StatusNotFound {
-		return OpenSeaCollectionStat{}, NewOpenSeaNotFoundError()
-	}
-
-	if err != nil {
-		o.logger.Error(err)
-		return OpenSeaCollectionStat{}, nil
-	}
-	defer resp.Body.Close()
+	return v.(OpenSeaCollectionStat), nil
+}
 
+func (o *OpenSeaClient) fetchCollectionStats(ctx context.Context, slug string) (OpenSeaCollectionStat, error) {
 	var stat OpenSeaCollectionStatResp
-	err = json.NewDecoder(resp.Body).Decode(&stat)
-	if err != nil {
-		o.logger.Error(err)
-		return OpenSeaCollectionStat{}, nil
+	err := o.get(ctx, fmt.Sprintf("%s/api/v1/collection/%s/stats", o.baseURL, url.PathEscape(slug)), &stat)
+	if errors.Is(err, apierror.ErrNotFound) {
+		return OpenSeaCollectionStat{}, NewOpenSeaNotFoundError()
 	}
 
-	return stat.Stats, nil
+	return stat.Stats, err
 }
 
 // GetAssetsForAddressV2 returns the assets for an address
-func (o *OpenSeaClient) GetAssetsForAddressV2(address string, offset int) ([]OpenSeaAssetV2, error) {
+func (o *OpenSeaClient) GetAssetsForAddressV2(ctx context.Context, address string, offset int) ([]OpenSeaAssetV2, error) {
 	var assets = []OpenSeaAssetV2{}
-	u, err := url.Parse(fmt.Sprintf("https://api.opensea.io/api/v1/assets?&offset=%d&limit=50", offset))
+	u, err := url.Parse(fmt.Sprintf("%s/api/v1/assets?&offset=%d&limit=%d", o.baseURL, offset, DEFAULT_LIMIT))
 	if err != nil {
-		o.logger.Error(err)
-		return assets, nil
+		return assets, err
 	}
 	q := u.Query()
 	q.Set("owner", address)
 	u.RawQuery = q.Encode()
 
 	// Fetch assets
-	req, err := http.NewRequest("GET", u.String(), nil)
-	req.Header.Set("X-API-KEY", o.apiKey)
-	if err != nil {
-		o.logger.Error(err)
-		return assets, nil
-	}
-	resp, err := o.httpClient.Do(req)
-	if err != nil {
-		o.logger.Error(err)
-		return assets, nil
-	}
-	defer resp.Body.Close()
-
 	var openSeaGetAssetsResp OpenSeaGetAssetsRespV2
-	err = json.NewDecoder(resp.Body).Decode(&openSeaGetAssetsResp)
+	err = o.get(ctx, u.String(), &openSeaGetAssetsResp)
 	if err != nil {
-		o.logger.Error(err)
-		return assets, nil
+		return assets, err
 	}
 
 	// Filter out assets with hidden collections
@@ -359,18 +457,33 @@ func (o *OpenSeaClient) GetAssetsForAddressV2(address string, offset int) ([]Ope
 	return openSeaGetAssetsResp.Assets, nil
 }
 
-func (o *OpenSeaClient) GetAllCollectionsForAddress(address string) ([]OpenSeaCollectionCollection, error) {
+// GetAllCollectionsForAddress pages through the collections for an address.
+// It fails rather than return part of them.
+func (o *OpenSeaClient) GetAllCollectionsForAddress(ctx context.Context, address string) ([]OpenSeaCollectionCollection, error) {
+	if o.v2 {
+		owned, err := o.ownedCollections(ctx, o.chain, address)
+		if err != nil {
+			return []OpenSeaCollectionCollection{}, err
+		}
+
+		collections := make([]OpenSeaCollectionCollection, 0, len(owned))
+		for _, c := range owned {
+			collections = append(collections, c.collectionCollection(o.chain))
+		}
+		return collections, nil
+	}
+
 	var allCollections []OpenSeaCollectionCollection
 	offset := 0
 	for {
-		collections, err := o.GetCollectionsForAddress(address, offset)
+		collections, err := o.GetCollectionsForAddress(ctx, address, offset)
 		if err != nil {
 			return []OpenSeaCollectionCollection{}, err
 		}
-		if len(collections) == 0 {
+		allCollections = append(allCollections, collections...)
+		if len(collections) < DEFAULT_LIMIT {
 			break
 		}
-		allCollections = append(allCollections, collections...)
 		offset += DEFAULT_LIMIT
 	}
 
@@ -378,21 +491,27 @@ func (o *OpenSeaClient) GetAllCollectionsForAddress(address string) ([]OpenSeaCo
 	return allCollections, nil
 }
 
-func (o *OpenSeaClient) GetAllCollectionsForAddressV2(address string) ([]OpenSeaCollectionV2, error) {
+// GetAllCollectionsForAddressV2 pages through the visible collections for an
+// address. It fails rather than return part of them.
+func (o *OpenSeaClient) GetAllCollectionsForAddressV2(ctx context.Context, address string) ([]OpenSeaCollectionV2, error) {
+	if o.v2 {
+		return o.GetAllCollectionsForAddressOnChain(ctx, o.chain, address)
+	}
+
 	var (
 		allCollections []OpenSeaCollectionV2
 		offset         = 0
 	)
 
 	for {
-		collections, err := o.GetCollectionsForAddressV2(address, offset)
+		collections, err := o.collectionsPageV2(ctx, address, offset)
 		if err != nil {
-			return allCollections, err
+			return []OpenSeaCollectionV2{}, err
 		}
-		if len(collections) == 0 {
+		allCollections = append(allCollections, visibleCollections(collections)...)
+		if len(collections) < DEFAULT_LIMIT {
 			break
 		}
-		allCollections = append(allCollections, collections...)
 		offset += DEFAULT_LIMIT
 	}
 
@@ -400,76 +519,88 @@ func (o *OpenSeaClient) GetAllCollectionsForAddressV2(address string) ([]OpenSea
 	return allCollections, nil
 }
 
-// GetAllAssetsForAddressV2 returns the assets for an address
-func (o *OpenSeaClient) GetAllAssetsForAddressV2(address string) ([]OpenSeaAssetV2, error) {
+// GetAllAssetsForAddressV2 returns the assets for an address. It fails rather
+// than return part of them.
+func (o *OpenSeaClient) GetAllAssetsForAddressV2(ctx context.Context, address string) ([]OpenSeaAssetV2, error) {
+	if o.v2 {
+		return o.GetAllAssetsForAddressOnChain(ctx, o.chain, address)
+	}
+
 	var (
 		allAssets []OpenSeaAssetV2
 		offset    = 0
 	)
 
 	for {
-		assets, err := o.GetAssetsForAddressV2(address, offset)
+		assets, err := o.GetAssetsForAddressV2(ctx, address, offset)
 		if err != nil {
-			return allAssets, err
-		}
-
-		if len(assets) == 0 {
-			break
+			return []OpenSeaAssetV2{}, err
 		}
 
+		allAssets = append(allAssets, assets...)
 		o.logger.Infow("Found assets from OpenSea", "address", address, "offset", offset, "len", len(allAssets))
 
-		allAssets = append(allAssets, assets...)
+		if len(assets) < DEFAULT_LIMIT {
+			break
+		}
 		offset += DEFAULT_LIMIT
 	}
 
 	return allAssets, nil
 }
 
-// GetCollection returns the collection from OpenSea
-func (o *OpenSeaClient) GetCollection(slug string) (OpenSeaCollectionResp, error) {
-	var collection OpenSeaCollectionResp
-	u, err := url.Parse(fmt.Sprintf("https://api.opensea.io/api/v1/collection/%s", slug))
-	if err != nil {
-		o.logger.Error(err)
-		return collection, nil
+// GetCollection returns the collection from OpenSea, cached for the OpenSeaTTL
+func (o *OpenSeaClient) GetCollection(ctx context.Context, slug string) (OpenSeaCollectionResp, error) {
+	var (
+		collection OpenSeaCollectionResp
+		err        error
+	)
+	if o.v2 {
+		var detail openSeaCollectionDetail
+		detail, err = o.collectionDetail(ctx, slug)
+		collection = detail.collectionResp(o.chain)
+	} else {
+		var v interface{}
+		v, err = o.cache.Get(ctx, "collection:"+slug, func(ctx context.Context) (interface{}, error) {
+			return o.fetchCollection(ctx, slug)
+		})
+		if err == nil {
+			collection = v.(OpenSeaCollectionResp)
+		}
 	}
-	q := u.Query()
-	u.RawQuery = q.Encode()
-
-	// Fetch collection
-	req, err := http.NewRequest("GET", u.String(), nil)
-	req.Header.Set("X-API-KEY", o.apiKey)
-	if err != nil {
-		o.logger.Infof("Error creating request: %s", slug)
-		o.logger.Error(err)
-		return collection, nil
+	if errors.Is(err, apierror.ErrNotFound) {
+		o.logger.Infow("Collection not found", "collection", slug)
 	}
-
-	resp, err := o.httpClient.Do(req)
 	if err != nil {
-		o.logger.Infof("Error doing request: %s", slug)
-		o.logger.Error(err)
-		return collection, nil
+		return OpenSeaCollectionResp{}, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode == http.StatusNotFound {
-		o.logger.Infow("Collection not found", "collection", slug)
+	return collection, nil
+}
+
+func (o *OpenSeaClient) fetchCollection(ctx context.Context, slug string) (OpenSeaCollectionResp, error) {
+	var collection OpenSeaCollectionResp
+	err := o.get(ctx, fmt.Sprintf("%s/api/v1/collection/%s", o.baseURL, url.PathEscape(slug)), &collection)
+	if errors.Is(err, apierror.ErrNotFound) {
 		return collection, NewOpenSeaNotFoundError()
 	}
-	if resp.StatusCode == http.StatusTooManyRequests {
-		log.Println("Too many requests, please try again later")
-		return collection, nil
-	}
 
-	err = json.NewDecoder(resp.Body).Decode(&collection)
+	return collection, err
+}
+
+// GetCollectionContracts returns the addresses of the collection's contracts
+// on the client's chain
+func (o *OpenSeaClient) GetCollectionContracts(ctx context.Context, slug string) ([]string, error) {
+	collection, err := o.GetCollection(ctx, slug)
 	if err != nil {
-		o.logger.Error(err)
-		return collection, nil
+		return nil, err
 	}
 
-	return collection, nil
+	var contracts []string
+	for _, contract := range collection.Collection.PrimaryAssetContracts {
+		contracts = append(contracts, strings.ToLower(contract.ContractAddress))
+	}
+	return contracts, nil
 }
 
 func GetOpenSeaCollectionURL(docID string) string {
@@ -0,0 +1,421 @@
+package opensea
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/mager/keiko/apierror"
+)
+
+// OpenSeaEvent is a sale, transfer, listing or offer on OpenSea
+type OpenSeaEvent struct {
+	EventType string    `json:"eventType"`
+	Timestamp time.Time `json:"timestamp"`
+	Chain     string    `json:"chain"`
+	Contract  string    `json:"contract"`
+	TokenID   string    `json:"tokenId"`
+	Quantity  int       `json:"quantity"`
+	// From and To are the seller and buyer of sales, and the sender and
+	// recipient of transfers
+	From string `json:"from"`
+	To   string `json:"to"`
+	// Price is the total paid in Currency, zero for transfers
+	Price       float64 `json:"price"`
+	Currency    string  `json:"currency"`
+	Transaction string  `json:"transaction"`
+}
+
+// openSeaNFTsResp is the response from v2/chain/{chain}/account/{address}/nfts
+type openSeaNFTsResp struct {
+	NFTs []openSeaNFT `json:"nfts"`
+	Next string       `json:"next"`
+}
+
+type openSeaNFT struct {
+	Identifier string `json:"identifier"`
+	Collection string `json:"collection"`
+	Contract   string `json:"contract"`
+	Name       string `json:"name"`
+	ImageURL   string `json:"image_url"`
+	IsDisabled bool   `json:"is_disabled"`
+}
+
+// openSeaCollectionV2Resp is the response from v2/collections/{slug}
+type openSeaCollectionV2Resp struct {
+	Collection  string  `json:"collection"`
+	Name        string  `json:"name"`
+	ImageURL    string  `json:"image_url"`
+	TotalSupply float64 `json:"total_supply"`
+	Contracts   []struct {
+		Address string `json:"address"`
+		Chain   string `json:"chain"`
+	} `json:"contracts"`
+}
+
+// openSeaStatsV2Resp is the response from v2/collections/{slug}/stats
+type openSeaStatsV2Resp struct {
+	Total struct {
+		Volume           float64 `json:"volume"`
+		Sales            float64 `json:"sales"`
+		NumOwners        int     `json:"num_owners"`
+		MarketCap        float64 `json:"market_cap"`
+		FloorPrice       float64 `json:"floor_price"`
+		FloorPriceSymbol string  `json:"floor_price_symbol"`
+	} `json:"total"`
+	Intervals []struct {
+		Interval     string  `json:"interval"`
+		Volume       float64 `json:"volume"`
+		VolumeChange float64 `json:"volume_change"`
+	} `json:"intervals"`
+}
+
+// openSeaEventsResp is the response from v2/events/collection/{slug}
+type openSeaEventsResp struct {
+	AssetEvents []openSeaEventV2 `json:"asset_events"`
+	Next        string           `json:"next"`
+}
+
+type openSeaEventV2 struct {
+	EventType      string     `json:"event_type"`
+	EventTimestamp int64      `json:"event_timestamp"`
+	Chain          string     `json:"chain"`
+	Quantity       int        `json:"quantity"`
+	Seller         string     `json:"seller"`
+	Buyer          string     `json:"buyer"`
+	FromAddress    string     `json:"from_address"`
+	ToAddress      string     `json:"to_address"`
+	Transaction    string     `json:"transaction"`
+	NFT            openSeaNFT `json:"nft"`
+	Payment        *struct {
+		Quantity string `json:"quantity"`
+		Decimals int    `json:"decimals"`
+		Symbol   string `json:"symbol"`
+	} `json:"payment"`
+}
+
+// openSeaCollectionDetail is a v2 collection along with its stats
+type openSeaCollectionDetail struct {
+	Slug         string
+	Name         string
+	ImageURL     string
+	Contracts    map[string][]string
+	Stats        OpenSeaCollectionStat
+	OneDayChange float64
+	// FloorPriceSymbol is the token Stats.FloorPrice is in
+	FloorPriceSymbol string
+}
+
+// ownedCollection is a collection an address holds NFTs of
+type ownedCollection struct {
+	openSeaCollectionDetail
+	count int
+	// hidden is set when OpenSea disabled every NFT held
+	hidden bool
+}
+
+// GetAllAssetsForAddressOnChain returns the NFTs an address holds on chain,
+// such as "ethereum" or "matic". It fails rather than return part of them.
+func (o *OpenSeaClient) GetAllAssetsForAddressOnChain(ctx context.Context, chain, address string) ([]OpenSeaAssetV2, error) {
+	nfts, err := o.nftsForAccount(ctx, chain, address)
+	if err != nil {
+		return []OpenSeaAssetV2{}, err
+	}
+
+	details := make(map[string]openSeaCollectionDetail)
+	assets := make([]OpenSeaAssetV2, 0, len(nfts))
+	for _, nft := range nfts {
+		detail, ok := details[nft.Collection]
+		if !ok {
+			detail, err = o.heldCollectionDetail(ctx, nft.Collection)
+			if err != nil {
+				return []OpenSeaAssetV2{}, err
+			}
+			details[nft.Collection] = detail
+		}
+
+		assets = append(assets, OpenSeaAssetV2{
+			Name:     nft.Name,
+			TokenID:  nft.Identifier,
+			ImageURL: nft.ImageURL,
+			Collection: OpenSeaAssetV2Collection{
+				Slug:     nft.Collection,
+				Name:     detail.Name,
+				ImageURL: detail.ImageURL,
+				Hidden:   nft.IsDisabled,
+			},
+		})
+	}
+
+	return assets, nil
+}
+
+// GetAllCollectionsForAddressOnChain returns the visible collections an
+// address holds NFTs of on chain
+func (o *OpenSeaClient) GetAllCollectionsForAddressOnChain(ctx context.Context, chain, address string) ([]OpenSeaCollectionV2, error) {
+	owned, err := o.ownedCollections(ctx, chain, address)
+	if err != nil {
+		return []OpenSeaCollectionV2{}, err
+	}
+
+	var collections = []OpenSeaCollectionV2{}
+	for _, c := range owned {
+		if c.hidden {
+			continue
+		}
+		collections = append(collections, OpenSeaCollectionV2{
+			Name:             c.Name,
+			Slug:             c.Slug,
+			ImageURL:         c.ImageURL,
+			OwnedAssetCount:  c.count,
+			FloorPrice:       c.Stats.FloorPrice,
+			FloorPriceSymbol: c.FloorPriceSymbol,
+		})
+	}
+
+	return collections, nil
+}
+
+// GetCollectionEvents returns the events of a collection since after, newest
+// first. eventType is one of OpenSea's event types such as "sale" or
+// "transfer", or empty for all of them. There are no v1 events, so this
+// always uses the v2 API.
+func (o *OpenSeaClient) GetCollectionEvents(ctx context.Context, slug, eventType string, after time.Time) ([]OpenSeaEvent, error) {
+	q := url.Values{}
+	q.Set("limit", fmt.Sprintf("%d", DEFAULT_LIMIT))
+	if eventType != "" {
+		q.Set("event_type", eventType)
+	}
+	if !after.IsZero() {
+		q.Set("after", fmt.Sprintf("%d", after.Unix()))
+	}
+
+	var events []OpenSeaEvent
+	for {
+		var resp openSeaEventsResp
+		u := fmt.Sprintf("%s/api/v2/events/collection/%s?%s", o.baseURL, url.PathEscape(slug), q.Encode())
+		err := o.get(ctx, u, &resp)
+		if errors.Is(err, apierror.ErrNotFound) {
+			return []OpenSeaEvent{}, NewOpenSeaNotFoundError()
+		}
+		if err != nil {
+			return []OpenSeaEvent{}, err
+		}
+
+		for _, e := range resp.AssetEvents {
+			events = append(events, adaptEvent(e))
+		}
+
+		if resp.Next == "" {
+			break
+		}
+		q.Set("next", resp.Next)
+	}
+
+	return events, nil
+}
+
+// nftsForAccount pages through the NFTs an address holds on chain
+func (o *OpenSeaClient) nftsForAccount(ctx context.Context, chain, address string) ([]openSeaNFT, error) {
+	q := url.Values{}
+	q.Set("limit", fmt.Sprintf("%d", DEFAULT_LIMIT))
+
+	var nfts []openSeaNFT
+	for {
+		var resp openSeaNFTsResp
+		u := fmt.Sprintf("%s/api/v2/chain/%s/account/%s/nfts?%s", o.baseURL, url.PathEscape(chain), url.PathEscape(address), q.Encode())
+		if err := o.get(ctx, u, &resp); err != nil {
+			return nil, err
+		}
+
+		nfts = append(nfts, resp.NFTs...)
+		if resp.Next == "" {
+			break
+		}
+		q.Set("next", resp.Next)
+	}
+
+	o.logger.Infow("Found NFTs from OpenSea", "chain", chain, "address", address, "count", len(nfts))
+	return nfts, nil
+}
+
+// ownedCollections groups the NFTs an address holds on chain by collection,
+// in the order OpenSea returned them
+func (o *OpenSeaClient) ownedCollections(ctx context.Context, chain, address string) ([]ownedCollection, error) {
+	nfts, err := o.nftsForAccount(ctx, chain, address)
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		owned []ownedCollection
+		index = make(map[string]int)
+	)
+	for _, nft := range nfts {
+		i, ok := index[nft.Collection]
+		if !ok {
+			i = len(owned)
+			index[nft.Collection] = i
+			owned = append(owned, ownedCollection{hidden: true})
+		}
+		owned[i].count++
+		owned[i].hidden = owned[i].hidden && nft.IsDisabled
+	}
+
+	for slug, i := range index {
+		detail, err := o.heldCollectionDetail(ctx, slug)
+		if err != nil {
+			return nil, err
+		}
+		owned[i].openSeaCollectionDetail = detail
+	}
+
+	return owned, nil
+}
+
+// collectionDetail returns a collection and its stats, cached for the
+// OpenSeaTTL
+func (o *OpenSeaClient) collectionDetail(ctx context.Context, slug string) (openSeaCollectionDetail, error) {
+	v, err := o.cache.Get(ctx, "v2:collection:"+slug, func(ctx context.Context) (interface{}, error) {
+		return o.fetchCollectionDetail(ctx, slug)
+	})
+	if err != nil {
+		return openSeaCollectionDetail{}, err
+	}
+
+	return v.(openSeaCollectionDetail), nil
+}
+
+// heldCollectionDetail is the collectionDetail of a collection an address
+// holds, ones OpenSea no longer knows are returned by slug alone
+func (o *OpenSeaClient) heldCollectionDetail(ctx context.Context, slug string) (openSeaCollectionDetail, error) {
+	detail, err := o.collectionDetail(ctx, slug)
+	if errors.Is(err, apierror.ErrNotFound) {
+		return openSeaCollectionDetail{Slug: slug, Name: slug}, nil
+	}
+	return detail, err
+}
+
+func (o *OpenSeaClient) fetchCollectionDetail(ctx context.Context, slug string) (openSeaCollectionDetail, error) {
+	var (
+		collection openSeaCollectionV2Resp
+		stats      openSeaStatsV2Resp
+	)
+	err := o.get(ctx, fmt.Sprintf("%s/api/v2/collections/%s", o.baseURL, url.PathEscape(slug)), &collection)
+	if err == nil {
+		err = o.get(ctx, fmt.Sprintf("%s/api/v2/collections/%s/stats", o.baseURL, url.PathEscape(slug)), &stats)
+	}
+	if errors.Is(err, apierror.ErrNotFound) {
+		return openSeaCollectionDetail{}, NewOpenSeaNotFoundError()
+	}
+	if err != nil {
+		return openSeaCollectionDetail{}, err
+	}
+
+	detail := openSeaCollectionDetail{
+		Slug:             collection.Collection,
+		Name:             collection.Name,
+		ImageURL:         collection.ImageURL,
+		Contracts:        make(map[string][]string),
+		FloorPriceSymbol: stats.Total.FloorPriceSymbol,
+		Stats: OpenSeaCollectionStat{
+			TotalVolume: stats.Total.Volume,
+			NumOwners:   stats.Total.NumOwners,
+			TotalSupply: collection.TotalSupply,
+			MarketCap:   stats.Total.MarketCap,
+			FloorPrice:  stats.Total.FloorPrice,
+			TotalSales:  stats.Total.Sales,
+		},
+	}
+	for _, c := range collection.Contracts {
+		detail.Contracts[c.Chain] = append(detail.Contracts[c.Chain], c.Address)
+	}
+	for _, interval := range stats.Intervals {
+		switch interval.Interval {
+		case "one_day":
+			detail.Stats.OneDayVolume = interval.Volume
+			detail.OneDayChange = interval.VolumeChange
+		case "seven_day":
+			detail.Stats.SevenDayVolume = interval.Volume
+		case "thirty_day":
+			detail.Stats.ThirtyDayVolume = interval.Volume
+		}
+	}
+
+	return detail, nil
+}
+
+// collectionResp adapts the detail to the v1 collection response, with the
+// contracts on chain
+func (d openSeaCollectionDetail) collectionResp(chain string) OpenSeaCollectionResp {
+	return OpenSeaCollectionResp{
+		Collection: OpenSeaCollection{
+			Name:                  d.Name,
+			Slug:                  d.Slug,
+			ImageURL:              d.ImageURL,
+			Stats:                 d.Stats,
+			PrimaryAssetContracts: d.primaryAssetContracts(chain),
+		},
+	}
+}
+
+func (d openSeaCollectionDetail) primaryAssetContracts(chain string) []OpenSeaPrimaryAssetContracts {
+	var contracts []OpenSeaPrimaryAssetContracts
+	for _, address := range d.Contracts[chain] {
+		contracts = append(contracts, OpenSeaPrimaryAssetContracts{
+			Name:            d.Name,
+			ContractAddress: address,
+		})
+	}
+	return contracts
+}
+
+// collectionCollection adapts the collection to the v1 collections response
+func (c ownedCollection) collectionCollection(chain string) OpenSeaCollectionCollection {
+	return OpenSeaCollectionCollection{
+		Name:                  c.Name,
+		FloorPrice:            c.Stats.FloorPrice,
+		PrimaryAssetContracts: c.primaryAssetContracts(chain),
+		OpenSeaStats: OpenSeaStats{
+			FloorPrice:   c.Stats.FloorPrice,
+			OneDayChange: c.OneDayChange,
+		},
+		ImageURL:        c.ImageURL,
+		Slug:            c.Slug,
+		OwnedAssetCount: c.count,
+	}
+}
+
+func adaptEvent(e openSeaEventV2) OpenSeaEvent {
+	event := OpenSeaEvent{
+		EventType:   e.EventType,
+		Timestamp:   time.Unix(e.EventTimestamp, 0).UTC(),
+		Chain:       e.Chain,
+		Contract:    e.NFT.Contract,
+		TokenID:     e.NFT.Identifier,
+		Quantity:    e.Quantity,
+		From:        e.Seller,
+		To:          e.Buyer,
+		Transaction: e.Transaction,
+	}
+	if event.From == "" {
+		event.From = e.FromAddress
+	}
+	if event.To == "" {
+		event.To = e.ToAddress
+	}
+
+	if e.Payment != nil {
+		event.Currency = strings.ToUpper(e.Payment.Symbol)
+		if quantity, ok := new(big.Float).SetString(e.Payment.Quantity); ok {
+			unit := new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(e.Payment.Decimals)), nil))
+			event.Price, _ = new(big.Float).Quo(quantity, unit).Float64()
+		}
+	}
+
+	return event
+}
@@ -0,0 +1,185 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/ethereum/go-ethereum"
+	"github.com/ethereum/go-ethereum/accounts/abi"
+	"github.com/ethereum/go-ethereum/accounts/abi/bind"
+	"github.com/ethereum/go-ethereum/common"
+	"github.com/mager/keiko/apierror"
+)
+
+const aggregatorABI = `[
+	{"name":"decimals","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"","type":"uint8"}]},
+	{"name":"latestRoundData","type":"function","stateMutability":"view","inputs":[],"outputs":[{"name":"roundId","type":"uint80"},{"name":"answer","type":"int256"},{"name":"startedAt","type":"uint256"},{"name":"updatedAt","type":"uint256"},{"name":"answeredInRound","type":"uint80"}]}
+]`
+
+// ethFeed is the feed every quote starts from, other currencies are
+// converted with their {currency}/USD feed
+const ethFeed = "ETH/USD"
+
+// fxMaxAge is how old a fiat feed can be, they update at least daily
+const fxMaxAge = 25 * time.Hour
+
+// ChainlinkSource quotes ETH from Chainlink aggregators
+type ChainlinkSource struct {
+	caller bind.ContractCaller
+	abi    abi.ABI
+	feeds  map[string]common.Address
+
+	mu       sync.Mutex
+	decimals map[common.Address]uint8
+}
+
+type round struct {
+	RoundId         *big.Int
+	Answer          *big.Int
+	StartedAt       *big.Int
+	UpdatedAt       *big.Int
+	AnsweredInRound *big.Int
+}
+
+// NewChainlinkSource creates a ChainlinkSource that reads the aggregators in
+// feeds, keyed by pair such as "ETH/USD", through caller
+func NewChainlinkSource(caller bind.ContractCaller, feeds map[string]string) (*ChainlinkSource, error) {
+	parsed, err := abi.JSON(strings.NewReader(aggregatorABI))
+	if err != nil {
+		panic(err)
+	}
+
+	s := &ChainlinkSource{
+		caller:   caller,
+		abi:      parsed,
+		feeds:    make(map[string]common.Address, len(feeds)),
+		decimals: make(map[common.Address]uint8),
+	}
+	for pair, address := range feeds {
+		if !common.IsHexAddress(address) {
+			return nil, fmt.Errorf("bad address for %s: %q", pair, address)
+		}
+		s.feeds[strings.ToUpper(pair)] = common.HexToAddress(address)
+	}
+	if _, ok := s.feeds[ethFeed]; !ok {
+		return nil, fmt.Errorf("missing %s feed", ethFeed)
+	}
+
+	return s, nil
+}
+
+func (s *ChainlinkSource) Name() string {
+	return "chainlink"
+}
+
+// ETHPrice returns the ETH/USD answer, divided by the {currency}/USD answer
+// for other currencies. The quote is as old as the ETH/USD answer.
+func (s *ChainlinkSource) ETHPrice(ctx context.Context, currency string) (Quote, error) {
+	currency = strings.ToUpper(currency)
+
+	fxFeed, ok := s.feeds[currency+"/USD"]
+	if currency != "USD" && !ok {
+		return Quote{}, ErrUnsupportedCurrency
+	}
+
+	rate, updated, err := s.latest(ctx, s.feeds[ethFeed])
+	if err != nil {
+		return Quote{}, fmt.Errorf("%s: %w", ethFeed, err)
+	}
+
+	if currency != "USD" {
+		fx, fxUpdated, err := s.latest(ctx, fxFeed)
+		if err != nil {
+			return Quote{}, fmt.Errorf("%s/USD: %w", currency, err)
+		}
+		if time.Since(fxUpdated) > fxMaxAge {
+			return Quote{}, fmt.Errorf("%s/USD: stale, updated %s", currency, fxUpdated)
+		}
+		rate /= fx
+	}
+
+	return Quote{
+		Currency:  currency,
+		Rate:      rate,
+		Timestamp: updated,
+		Source:    s.Name(),
+	}, nil
+}
+
+// latest returns the answer of the latest complete round of the aggregator
+func (s *ChainlinkSource) latest(ctx context.Context, feed common.Address) (float64, time.Time, error) {
+	decimals, err := s.feedDecimals(ctx, feed)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	var r round
+	if err := s.call(ctx, feed, "latestRoundData", &r); err != nil {
+		return 0, time.Time{}, err
+	}
+
+	if r.UpdatedAt.Sign() == 0 {
+		return 0, time.Time{}, errors.New("round not complete")
+	}
+	if r.AnsweredInRound.Cmp(r.RoundId) < 0 {
+		return 0, time.Time{}, errors.New("answer carried over from an earlier round")
+	}
+	if r.Answer.Sign() <= 0 {
+		return 0, time.Time{}, fmt.Errorf("bad answer %s", r.Answer)
+	}
+
+	answer, _ := new(big.Float).Quo(
+		new(big.Float).SetInt(r.Answer),
+		new(big.Float).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil)),
+	).Float64()
+
+	return answer, time.Unix(r.UpdatedAt.Int64(), 0), nil
+}
+
+// feedDecimals returns the decimals of the aggregator's answers, which never
+// change
+func (s *ChainlinkSource) feedDecimals(ctx context.Context, feed common.Address) (uint8, error) {
+	s.mu.Lock()
+	decimals, ok := s.decimals[feed]
+	s.mu.Unlock()
+	if ok {
+		return decimals, nil
+	}
+
+	if err := s.call(ctx, feed, "decimals", &decimals); err != nil {
+		return 0, err
+	}
+
+	s.mu.Lock()
+	s.decimals[feed] = decimals
+	s.mu.Unlock()
+
+	return decimals, nil
+}
+
+func (s *ChainlinkSource) call(ctx context.Context, feed common.Address, method string, out interface{}) error {
+	data, err := s.abi.Pack(method)
+	if err != nil {
+		return err
+	}
+
+	res, err := s.caller.CallContract(ctx, ethereum.CallMsg{To: &feed, Data: data}, nil)
+	if err != nil {
+		return apierror.Unreachable("infura", err)
+	}
+	if len(res) == 0 {
+		return apierror.Upstream("chainlink", apierror.CodeBadResponse, "no aggregator", fmt.Errorf("no aggregator at %s", feed.Hex()))
+	}
+
+	err = s.abi.UnpackIntoInterface(out, method, res)
+	if err != nil {
+		return apierror.Decode("chainlink", err)
+	}
+
+	return nil
+}
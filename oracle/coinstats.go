@@ -0,0 +1,36 @@
+package oracle
+
+import (
+	"context"
+
+	"github.com/mager/keiko/coinstats"
+)
+
+// CoinstatsSource quotes ETH from the Coinstats API, which supports any
+// currency
+type CoinstatsSource struct {
+	cs coinstats.CoinstatsClient
+}
+
+// NewCoinstatsSource creates a CoinstatsSource
+func NewCoinstatsSource(cs coinstats.CoinstatsClient) *CoinstatsSource {
+	return &CoinstatsSource{cs: cs}
+}
+
+func (s *CoinstatsSource) Name() string {
+	return "coinstats"
+}
+
+func (s *CoinstatsSource) ETHPrice(ctx context.Context, currency string) (Quote, error) {
+	price, err := s.cs.GetETHPriceIn(currency)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Quote{
+		Currency:  price.Currency,
+		Rate:      price.Rate,
+		Timestamp: price.Timestamp,
+		Source:    s.Name(),
+	}, nil
+}
@@ -0,0 +1,221 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/cache"
+	"github.com/mager/keiko/coinstats"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/infura"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrNoPrice is returned when no source has an acceptable quote
+	ErrNoPrice = apierror.New(apierror.CodeUpstreamUnavailable, "no ETH price")
+	// ErrUnsupportedCurrency is returned by sources that cannot quote a currency
+	ErrUnsupportedCurrency = errors.New("unsupported_currency")
+)
+
+const (
+	// defaultMaxAge is the max age of quotes from sources without a PriceMaxAge
+	defaultMaxAge = time.Hour
+	// quoteTimeout bounds how long all the sources have to quote, the
+	// quote is shared by every waiting request so it is not tied to one
+	quoteTimeout = 10 * time.Second
+)
+
+// Quote is the price of one ETH in a fiat currency
+type Quote struct {
+	Currency string
+	Rate     float64
+	// Timestamp is when the source last updated the rate
+	Timestamp time.Time
+	Source    string
+}
+
+// Age is how long ago the rate was updated
+func (q Quote) Age() time.Duration {
+	return time.Since(q.Timestamp)
+}
+
+// PriceSource quotes the price of ETH
+type PriceSource interface {
+	Name() string
+	ETHPrice(ctx context.Context, currency string) (Quote, error)
+}
+
+// Oracle quotes the price of ETH from the first of its sources with a fresh
+// quote that is in band with the last accepted one
+type Oracle struct {
+	sources      []PriceSource
+	maxAge       map[string]time.Duration
+	maxDeviation float64
+	cache        *cache.Group
+	logger       *zap.SugaredLogger
+
+	mu   sync.Mutex
+	last map[string]Quote
+}
+
+// ProvideOracle provides an Oracle over the PriceSources in order
+func ProvideOracle(
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	c *cache.Cache,
+	cs coinstats.CoinstatsClient,
+	infuraClient *infura.InfuraClient,
+) *Oracle {
+	var sources []PriceSource
+	for _, name := range cfg.PriceSources {
+		switch name {
+		case "coinstats":
+			sources = append(sources, NewCoinstatsSource(cs))
+		case "chainlink":
+			chainlink, err := NewChainlinkSource(infuraClient.Client, cfg.ChainlinkFeeds)
+			if err != nil {
+				logger.Fatalw("Invalid Chainlink feeds", "error", err)
+			}
+			sources = append(sources, chainlink)
+		default:
+			logger.Fatalw("Unknown price source", "source", name)
+		}
+	}
+
+	o := NewOracle(sources, cfg.PriceMaxAge, cfg.PriceMaxDeviation, logger)
+	o.cache = c.Group("oracle", cache.Policy{
+		TTL:      cfg.ETHPriceTTL,
+		StaleTTL: cfg.CacheStaleTTL,
+	})
+
+	return o
+}
+
+var Options = ProvideOracle
+
+// NewOracle creates an uncached Oracle. Quotes older than the max age of
+// their source, or further than maxDeviation from the last accepted quote,
+// are rejected.
+func NewOracle(sources []PriceSource, maxAge map[string]time.Duration, maxDeviation float64, logger *zap.SugaredLogger) *Oracle {
+	return &Oracle{
+		sources:      sources,
+		maxAge:       maxAge,
+		maxDeviation: maxDeviation,
+		logger:       logger,
+		last:         make(map[string]Quote),
+	}
+}
+
+// ETHPrice returns the price of ETH in currency. Accepted quotes are cached,
+// and served while every source is failing for as long as they are fresh.
+func (o *Oracle) ETHPrice(ctx context.Context, currency string) (Quote, error) {
+	currency = strings.ToUpper(currency)
+
+	v, err := o.cache.Get(ctx, currency, func(ctx context.Context) (interface{}, error) {
+		ctx, cancel := context.WithTimeout(ctx, quoteTimeout)
+		defer cancel()
+
+		return o.quote(ctx, currency)
+	})
+	if err != nil {
+		return Quote{}, err
+	}
+
+	quote := v.(Quote)
+	if !o.fresh(quote) {
+		return Quote{}, fmt.Errorf("%w: %s quote from %s is %s old", ErrNoPrice, currency, quote.Source, quote.Age().Round(time.Second))
+	}
+
+	return quote, nil
+}
+
+// quote asks each source in order. The first fresh quote in band with the
+// last accepted one wins. When the fresh quotes are all out of band, the first
+// one that another source agrees with wins, since the market moved.
+func (o *Oracle) quote(ctx context.Context, currency string) (Quote, error) {
+	ref, hasRef := o.reference(currency)
+
+	var (
+		outOfBand []Quote
+		errs      []string
+	)
+	for _, source := range o.sources {
+		quote, err := source.ETHPrice(ctx, currency)
+		if errors.Is(err, ErrUnsupportedCurrency) {
+			continue
+		}
+		if err == nil && quote.Rate <= 0 {
+			err = fmt.Errorf("bad rate %v", quote.Rate)
+		}
+		if err == nil && !o.fresh(quote) {
+			err = fmt.Errorf("stale, updated %s ago", quote.Age().Round(time.Second))
+		}
+		if err != nil {
+			o.logger.Warnw("Rejected ETH price", "source", source.Name(), "currency", currency, "error", err)
+			errs = append(errs, fmt.Sprintf("%s: %v", source.Name(), err))
+			continue
+		}
+
+		if !hasRef || o.inBand(quote.Rate, ref.Rate) {
+			o.accept(quote)
+			return quote, nil
+		}
+
+		// Accept a move once a second source confirms it
+		for _, other := range outOfBand {
+			if o.inBand(quote.Rate, other.Rate) {
+				o.logger.Infow("ETH price moved out of band", "currency", currency, "from", ref.Rate, "to", other.Rate)
+				o.accept(other)
+				return other, nil
+			}
+		}
+
+		o.logger.Warnw("Rejected ETH price", "source", source.Name(), "currency", currency, "rate", quote.Rate, "last", ref.Rate)
+		errs = append(errs, fmt.Sprintf("%s: %v out of band", source.Name(), quote.Rate))
+		outOfBand = append(outOfBand, quote)
+	}
+
+	if len(errs) == 0 {
+		return Quote{}, fmt.Errorf("%w: no source quotes %s", ErrNoPrice, currency)
+	}
+
+	return Quote{}, fmt.Errorf("%w: %s", ErrNoPrice, strings.Join(errs, "; "))
+}
+
+// reference returns the last accepted quote for currency while it is fresh
+func (o *Oracle) reference(currency string) (Quote, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	quote, ok := o.last[currency]
+	if !ok || !o.fresh(quote) {
+		return Quote{}, false
+	}
+	return quote, true
+}
+
+func (o *Oracle) accept(quote Quote) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	o.last[quote.Currency] = quote
+}
+
+func (o *Oracle) fresh(quote Quote) bool {
+	maxAge, ok := o.maxAge[quote.Source]
+	if !ok {
+		maxAge = defaultMaxAge
+	}
+	return quote.Age() <= maxAge
+}
+
+func (o *Oracle) inBand(rate, ref float64) bool {
+	return math.Abs(rate/ref-1) <= o.maxDeviation
+}
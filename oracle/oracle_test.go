@@ -0,0 +1,160 @@
+package oracle
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// fakeSource quotes a fixed rate updated age ago, or fails with err
+type fakeSource struct {
+	name string
+	rate float64
+	age  time.Duration
+	err  error
+}
+
+func (s fakeSource) Name() string {
+	return s.name
+}
+
+func (s fakeSource) ETHPrice(ctx context.Context, currency string) (Quote, error) {
+	if s.err != nil {
+		return Quote{}, s.err
+	}
+	return Quote{Currency: currency, Rate: s.rate, Timestamp: time.Now().Add(-s.age), Source: s.name}, nil
+}
+
+func TestQuoteFallback(t *testing.T) {
+	var (
+		down = errors.New("down")
+		a    = func(rate float64) fakeSource { return fakeSource{name: "a", rate: rate} }
+		b    = func(rate float64) fakeSource { return fakeSource{name: "b", rate: rate} }
+		c    = func(rate float64) fakeSource { return fakeSource{name: "c", rate: rate} }
+	)
+
+	tests := []struct {
+		name    string
+		sources []PriceSource
+		// last is the rate of the last accepted quote, if any
+		last       float64
+		wantSource string
+		wantRate   float64
+		wantErr    bool
+	}{
+		{
+			name:       "first source",
+			sources:    []PriceSource{a(2000), b(2100)},
+			wantSource: "a",
+			wantRate:   2000,
+		},
+		{
+			name:       "failing source",
+			sources:    []PriceSource{fakeSource{name: "a", err: down}, b(2100)},
+			wantSource: "b",
+			wantRate:   2100,
+		},
+		{
+			name:       "unsupported currency",
+			sources:    []PriceSource{fakeSource{name: "a", err: ErrUnsupportedCurrency}, b(2100)},
+			wantSource: "b",
+			wantRate:   2100,
+		},
+		{
+			name:       "stale quote",
+			sources:    []PriceSource{fakeSource{name: "a", rate: 2000, age: 2 * time.Hour}, b(2100)},
+			wantSource: "b",
+			wantRate:   2100,
+		},
+		{
+			name:       "bad rate",
+			sources:    []PriceSource{a(0), b(2100)},
+			wantSource: "b",
+			wantRate:   2100,
+		},
+		{
+			name:       "out of band quote",
+			sources:    []PriceSource{a(1000), b(2050)},
+			last:       2000,
+			wantSource: "b",
+			wantRate:   2050,
+		},
+		{
+			name:       "move confirmed by a second source",
+			sources:    []PriceSource{a(1000), b(1010)},
+			last:       2000,
+			wantSource: "a",
+			wantRate:   1000,
+		},
+		{
+			name:       "move confirmed by a later source",
+			sources:    []PriceSource{a(1000), b(3000), c(1010)},
+			last:       2000,
+			wantSource: "a",
+			wantRate:   1000,
+		},
+		{
+			name:    "unconfirmed move",
+			sources: []PriceSource{a(1000), b(3000)},
+			last:    2000,
+			wantErr: true,
+		},
+		{
+			name:    "every source failing",
+			sources: []PriceSource{fakeSource{name: "a", err: down}, fakeSource{name: "b", rate: 2000, age: 2 * time.Hour}},
+			wantErr: true,
+		},
+		{
+			name:    "no source for the currency",
+			sources: []PriceSource{fakeSource{name: "a", err: ErrUnsupportedCurrency}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := NewOracle(tt.sources, nil, 0.1, zap.NewNop().Sugar())
+			if tt.last > 0 {
+				o.accept(Quote{Currency: "USD", Rate: tt.last, Timestamp: time.Now(), Source: "a"})
+			}
+
+			got, err := o.quote(context.Background(), "USD")
+			if tt.wantErr {
+				if !errors.Is(err, ErrNoPrice) {
+					t.Fatalf("quote() = %+v, %v, want ErrNoPrice", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Source != tt.wantSource || got.Rate != tt.wantRate {
+				t.Fatalf("quote() = %v from %s, want %v from %s", got.Rate, got.Source, tt.wantRate, tt.wantSource)
+			}
+
+			// The quote becomes the reference for the next one
+			if ref, ok := o.reference("USD"); !ok || ref.Rate != tt.wantRate {
+				t.Fatalf("reference = %+v, want the accepted quote", ref)
+			}
+		})
+	}
+}
+
+func TestQuoteSourceMaxAge(t *testing.T) {
+	sources := []PriceSource{
+		fakeSource{name: "a", rate: 2000, age: 10 * time.Minute},
+		fakeSource{name: "b", rate: 2100, age: 10 * time.Minute},
+	}
+	o := NewOracle(sources, map[string]time.Duration{"a": 5 * time.Minute}, 0.1, zap.NewNop().Sugar())
+
+	got, err := o.quote(context.Background(), "USD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Source != "b" {
+		t.Fatalf("quote() from %s, want b since a has a max age of 5m", got.Source)
+	}
+}
@@ -0,0 +1,229 @@
+package portfolio
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/oracle"
+	"github.com/mager/keiko/utils"
+	sweeperdb "github.com/mager/sweeper/database"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidRange = errors.New("invalid_range")
+
+// Ranges maps each supported history range to its length, zero means all time
+var Ranges = map[string]time.Duration{
+	"7d":  7 * 24 * time.Hour,
+	"30d": 30 * 24 * time.Hour,
+	"90d": 90 * 24 * time.Hour,
+	"1y":  365 * 24 * time.Hour,
+	"all": 0,
+}
+
+// dailyAfter is the range length after which history keeps one snapshot a day
+const dailyAfter = 7 * 24 * time.Hour
+
+// Service snapshots the value of users' wallets and serves their history
+type Service struct {
+	cfg    config.Config
+	db     *database.DatabaseClient
+	prices *oracle.Oracle
+	logger *zap.SugaredLogger
+}
+
+// ProvidePortfolio provides a portfolio Service that snapshots every user
+// whose wallet was refreshed, or whose last snapshot is older than
+// PortfolioSnapshotMaxAge, on the PortfolioCheckInterval
+func ProvidePortfolio(
+	lc fx.Lifecycle,
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	db *database.DatabaseClient,
+	prices *oracle.Oracle,
+) *Service {
+	s := NewService(cfg, db, prices, logger)
+
+	ticker := time.NewTicker(cfg.PortfolioCheckInterval)
+	done := make(chan struct{})
+
+	lc.Append(
+		fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					for {
+						select {
+						case <-ticker.C:
+							if err := s.RecordAll(context.Background()); err != nil {
+								logger.Errorw("Failed to record portfolios", "error", err)
+							}
+						case <-done:
+							return
+						}
+					}
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				ticker.Stop()
+				close(done)
+				return nil
+			},
+		},
+	)
+
+	return s
+}
+
+var Options = ProvidePortfolio
+
+// NewService creates a portfolio Service, it does not record on its own
+func NewService(cfg config.Config, db *database.DatabaseClient, prices *oracle.Oracle, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		cfg:    cfg,
+		db:     db,
+		prices: prices,
+		logger: logger,
+	}
+}
+
+// Snapshot values wallet at the given ETH prices, keyed by currency code
+func Snapshot(wallet sweeperdb.Wallet, ethPrices map[string]float64) database.PortfolioSnapshot {
+	ethPriceUSD := ethPrices["USD"]
+	snapshot := database.PortfolioSnapshot{
+		Timestamp:     time.Now(),
+		ETHPriceUSD:   ethPriceUSD,
+		ETHPrices:     ethPrices,
+		WalletUpdated: wallet.UpdatedAt,
+		Collections:   []database.PortfolioCollection{},
+	}
+
+	var totalETH float64
+	for _, c := range wallet.Collections {
+		var value float64
+		for _, nft := range c.NFTs {
+			value += nft.Floor
+		}
+		value = math.Round(value*100) / 100
+
+		snapshot.Collections = append(snapshot.Collections, database.PortfolioCollection{
+			Slug:     c.Slug,
+			ValueETH: value,
+			NumOwned: len(c.NFTs),
+		})
+		totalETH += value
+	}
+
+	snapshot.TotalETH = math.Round(totalETH*1000) / 1000
+	snapshot.TotalUSD = utils.AdaptTotalUSD(snapshot.TotalETH, ethPriceUSD)
+
+	return snapshot
+}
+
+// RecordAll snapshots every user that is due
+func (s *Service) RecordAll(ctx context.Context) error {
+	records, err := s.db.Users.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	ethPrices := s.ethPrices()
+	if len(ethPrices) == 0 {
+		return errors.New("no ETH price")
+	}
+
+	var recorded int
+	for _, record := range records {
+		ok, err := s.RecordIfDue(ctx, record.Address, record.User, ethPrices)
+		if err != nil {
+			s.logger.Warnw("Failed to record portfolio", "address", record.Address, "error", err)
+			continue
+		}
+		if ok {
+			recorded++
+		}
+	}
+
+	s.logger.Infow("Recorded portfolios", "users", len(records), "recorded", recorded)
+
+	return nil
+}
+
+// RecordIfDue snapshots the user's wallet when it was refreshed since the
+// last snapshot, or when that snapshot is older than PortfolioSnapshotMaxAge.
+// Users whose wallet was never synced are skipped.
+func (s *Service) RecordIfDue(ctx context.Context, address string, user database.User, ethPrices map[string]float64) (bool, error) {
+	if user.Wallet.UpdatedAt.IsZero() {
+		return false, nil
+	}
+
+	return s.db.Portfolios.AddIfDue(ctx, address, Snapshot(user.Wallet, ethPrices), func(latest *database.PortfolioSnapshot) bool {
+		return latest == nil ||
+			user.Wallet.UpdatedAt.After(latest.WalletUpdated) ||
+			time.Since(latest.Timestamp) >= s.cfg.PortfolioSnapshotMaxAge
+	})
+}
+
+// ethPrices returns the ETH price in each configured currency that has one
+func (s *Service) ethPrices() map[string]float64 {
+	prices := make(map[string]float64, len(s.cfg.Currencies))
+	for _, currency := range s.cfg.Currencies {
+		quote, err := s.prices.ETHPrice(context.Background(), currency)
+		if err != nil {
+			s.logger.Warnw("Failed to fetch ETH price", "currency", currency, "error", err)
+			continue
+		}
+		prices[quote.Currency] = quote.Rate
+	}
+	return prices
+}
+
+// History returns the snapshots of address over rng, oldest first. Ranges
+// longer than a week keep the last snapshot of each day.
+func (s *Service) History(ctx context.Context, address, rng string) ([]database.PortfolioSnapshot, error) {
+	length, ok := Ranges[rng]
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRange, rng)
+	}
+
+	var (
+		now  = time.Now()
+		from time.Time
+	)
+	if length > 0 {
+		from = now.Add(-length)
+	}
+
+	snapshots, err := s.db.Portfolios.Range(ctx, address, from, now)
+	if err != nil {
+		return nil, err
+	}
+
+	if length == 0 || length > dailyAfter {
+		snapshots = lastPerDay(snapshots)
+	}
+
+	return snapshots, nil
+}
+
+// lastPerDay keeps the last of the snapshots taken each UTC day
+func lastPerDay(snapshots []database.PortfolioSnapshot) []database.PortfolioSnapshot {
+	daily := []database.PortfolioSnapshot{}
+
+	for _, snapshot := range snapshots {
+		day := snapshot.Timestamp.UTC().Truncate(24 * time.Hour)
+		if n := len(daily); n > 0 && daily[n-1].Timestamp.UTC().Truncate(24*time.Hour).Equal(day) {
+			daily[n-1] = snapshot
+			continue
+		}
+		daily = append(daily, snapshot)
+	}
+
+	return daily
+}
@@ -1,16 +1,22 @@
 package router
 
 import (
-	"fmt"
-	"log"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"io/ioutil"
 	"net/http"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ethereum/go-ethereum/common"
-	"github.com/ethereum/go-ethereum/common/hexutil"
-	"github.com/ethereum/go-ethereum/crypto"
 	"github.com/gorilla/mux"
-	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/apikey"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/siwe"
 	"github.com/mager/keiko/utils"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
@@ -19,39 +25,84 @@ import (
 // ProvideRouter provides a gorilla mux router
 func ProvideRouter(
 	lc fx.Lifecycle,
+	cfg config.Config,
 	logger *zap.SugaredLogger,
-	dbClient *database.DatabaseClient,
+	registry *apikey.Registry,
+	siweService *siwe.Service,
+	verifier *auth.Verifier,
 ) *mux.Router {
 	var router = mux.NewRouter()
 
+	// Unmatched requests skip the middleware, so they get their own request ID
+	router.NotFoundHandler = requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.HTTPError(w, r, "Route not found", http.StatusNotFound)
+	}))
+	router.MethodNotAllowedHandler = requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apierror.HTTPError(w, r, "Method not allowed", http.StatusMethodNotAllowed)
+	}))
+
 	router.Use(
+		requestIDMiddleware,
 		jsonMiddleware,
-		verifySignatureMiddleware,
+		authMiddleware(cfg, logger, registry),
+		sessionMiddleware(logger, siweService),
+		verifySignatureMiddleware(cfg, logger, verifier, siweService),
 		lowercaseAddressMiddleware,
 	)
 
 	return router
 }
 
-func authMiddleware(dbClient *database.DatabaseClient) func(http.Handler) http.Handler {
+// authMiddleware checks the admin key and application API key required by
+// the route policy. API keys are only enforced on the routes listed in the
+// APIKeyRoutes config, or everywhere when it contains "*".
+func authMiddleware(
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	registry *apikey.Registry,
+) func(http.Handler) http.Handler {
+	requireAll := utils.Contains(cfg.APIKeyRoutes, "*")
+
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				policy       = auth.RoutePolicy(r)
+				currentRoute = mux.CurrentRoute(r).GetName()
+			)
+
+			if policy.Admin {
+				adminKey := r.Header.Get("X-ADMIN-KEY")
+				if cfg.AdminKey == "" || subtle.ConstantTimeCompare([]byte(adminKey), []byte(cfg.AdminKey)) != 1 {
+					apierror.HTTPError(w, r, "Invalid admin key", http.StatusUnauthorized)
+					return
+				}
+
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if !policy.APIKey || (!requireAll && !utils.Contains(cfg.APIKeyRoutes, currentRoute)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
 			// Make sure they are sending an API key
 			apiKey := r.Header.Get("X-API-KEY")
 			if apiKey == "" {
-				http.Error(w, "Missing API key", http.StatusUnauthorized)
+				apierror.HTTPError(w, r, "Missing API key", http.StatusUnauthorized)
 				return
 			}
 
-			// Make sure the API key is in the apps map
-			for _, app := range dbClient.Apps {
-				if app.APIKey == apiKey {
-					next.ServeHTTP(w, r)
-					return
-				}
+			// Make sure the API key belongs to an application
+			appID, ok := registry.Lookup(apiKey)
+			if !ok {
+				apierror.HTTPError(w, r, "Invalid API key", http.StatusUnauthorized)
+				return
 			}
 
-			http.Error(w, "Invalid API key", http.StatusUnauthorized)
+			logger.Debugw("Authenticated application", "app", appID, "route", currentRoute)
+
+			next.ServeHTTP(w, r)
 		})
 	}
 }
@@ -67,6 +118,16 @@ func lowercaseAddressMiddleware(next http.Handler) http.Handler {
 	})
 }
 
+// requestIDMiddleware tags every request with an ID that is returned in the
+// X-Request-ID header and in error responses
+func requestIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := apierror.NewRequestID(r)
+		w.Header().Set(apierror.RequestIDHeader, id)
+		next.ServeHTTP(w, r.WithContext(apierror.WithRequestID(r.Context(), id)))
+	})
+}
+
 // jsonMiddleware makes sure that every response is JSON
 func jsonMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -75,74 +136,211 @@ func jsonMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func verifySignatureMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var (
-			sig              = r.Header.Get("X-Signature")
-			address          = r.Header.Get("X-Address")
-			msg              = r.Header.Get("X-Message")
-			currentRoute     = mux.CurrentRoute(r).GetName()
-			restrictedRoutes = []string{"followCollection", "unfollowCollection"}
-		)
-
-		if utils.Contains(restrictedRoutes, currentRoute) {
+// sessionMiddleware trusts the address bound to a Sign-In with Ethereum
+// session when the request carries an Authorization: Bearer token
+func sessionMiddleware(logger *zap.SugaredLogger, siweService *siwe.Service) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			authz := r.Header.Get("Authorization")
+			if !strings.HasPrefix(authz, "Bearer ") {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			session, err := siweService.Session(r.Context(), strings.TrimPrefix(authz, "Bearer "))
+			if err == siwe.ErrInvalidSession {
+				apierror.HTTPError(w, r, "Invalid or expired session", http.StatusUnauthorized)
+				return
+			}
+			if err != nil {
+				logger.Errorw("Failed to load session", "error", err)
+				apierror.HTTPError(w, r, "Failed to load session", http.StatusInternalServerError)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(auth.WithSigner(r.Context(), session.Address)))
+		})
+	}
+}
+
+// legacySignatureRoutes are the only routes that accept a legacy personal_sign
+// message, the ones that took it before EIP-712 actions
+var legacySignatureRoutes = []string{"followCollection", "unfollowCollection"}
+
+// maxSignedBodyBytes bounds the request bodies hashed for EIP-712 actions,
+// avatar uploads included
+const maxSignedBodyBytes = 16 << 20
+
+// verifySignatureMiddleware makes sure signed routes are called by a
+// verified signer, and that the signer owns the {address} being changed when
+// the route policy asks for it. Callers either have a session, sign the
+// EIP-712 Action (X-Signature, X-Address, X-Expiry and X-Nonce), or use a
+// legacy personal_sign message (X-Signature, X-Address and X-Message). The
+// action covers the hash of the request body, and its nonce is used up once
+// verified.
+func verifySignatureMiddleware(
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	verifier *auth.Verifier,
+	siweService *siwe.Service,
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var (
+				sig          = r.Header.Get("X-Signature")
+				address      = r.Header.Get("X-Address")
+				expiry       = r.Header.Get("X-Expiry")
+				nonce        = r.Header.Get("X-Nonce")
+				msg          = r.Header.Get("X-Message")
+				policy       = auth.RoutePolicy(r)
+				currentRoute = mux.CurrentRoute(r).GetName()
+			)
+
+			if policy.Signer == auth.NoSigner {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			// A session already proved who the caller is
+			if signer, ok := auth.Signer(r.Context()); ok {
+				serveOwner(w, r, next, policy, signer)
+				return
+			}
+
 			if sig == "" {
-				http.Error(w, "Missing X-Signature header", http.StatusBadRequest)
+				apierror.HTTPError(w, r, "Missing X-Signature header", http.StatusBadRequest)
 				return
 			}
 
 			if address == "" {
-				http.Error(w, "Missing X-Address header", http.StatusBadRequest)
+				apierror.HTTPError(w, r, "Missing X-Address header", http.StatusBadRequest)
 				return
 			}
 
-			if msg == "" {
-				http.Error(w, "Missing X-Message header", http.StatusBadRequest)
+			var err error
+			switch {
+			case expiry != "":
+				target := address
+				if policy.TargetVar != "" {
+					target = mux.Vars(r)[policy.TargetVar]
+				}
+				if nonce == "" {
+					apierror.HTTPError(w, r, "Missing X-Nonce header", http.StatusBadRequest)
+					return
+				}
+
+				var body []byte
+				body, err = readBody(w, r)
+				if err != nil {
+					apierror.HTTPError(w, r, "Request body too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+
+				var hash []byte
+				hash, err = actionHash(cfg, policy.Action, target, address, expiry, nonce, auth.BodyHash(body))
+				if err != nil {
+					apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+					return
+				}
+				err = verifier.VerifyHash(r.Context(), address, sig, hash)
+			case msg != "" && cfg.LegacySignatures && utils.Contains(legacySignatureRoutes, currentRoute):
+				err = verifier.Verify(r.Context(), address, sig, []byte(msg))
+			case msg != "":
+				apierror.HTTPError(w, r, "Sign the EIP-712 action with an X-Expiry header instead of X-Message", http.StatusBadRequest)
+				return
+			default:
+				apierror.HTTPError(w, r, "Missing X-Expiry header", http.StatusBadRequest)
 				return
 			}
 
-			if !verifySig(address, sig, []byte(msg)) {
-				log.Println("Signature verification failed")
-				w.WriteHeader(http.StatusUnauthorized)
+			switch {
+			case errors.Is(err, auth.ErrMalformedSignature):
+				apierror.HTTPError(w, r, err.Error(), http.StatusBadRequest)
+				return
+			case errors.Is(err, auth.ErrInvalidSignature):
+				logger.Infow("Signature verification failed", "address", address, "route", currentRoute, "error", err)
+				apierror.HTTPError(w, r, "Invalid signature", http.StatusUnauthorized)
+				return
+			case err != nil:
+				logger.Errorw("Failed to verify signature", "address", address, "error", err)
+				apierror.HTTPError(w, r, "Failed to verify signature", http.StatusBadGateway)
 				return
 			}
-		}
 
-		next.ServeHTTP(w, r)
-	})
+			// Only burn the nonce once the signature checks out
+			if expiry != "" {
+				err := siweService.ConsumeNonce(r.Context(), nonce)
+				if err == siwe.ErrInvalidNonce {
+					apierror.HTTPError(w, r, "Invalid or used nonce", http.StatusUnauthorized)
+					return
+				}
+				if err != nil {
+					logger.Errorw("Failed to consume nonce", "error", err)
+					apierror.HTTPError(w, r, "Failed to consume nonce", http.StatusInternalServerError)
+					return
+				}
+			}
+
+			serveOwner(w, r, next, policy, address)
+		})
+	}
 }
 
-func verifySig(from, sigHex string, msg []byte) bool {
-	fromAddr := common.HexToAddress(from)
+// serveOwner hands the request to next on behalf of signer, as long as the
+// signer owns the resource the route policy protects
+func serveOwner(w http.ResponseWriter, r *http.Request, next http.Handler, policy auth.Policy, signer string) {
+	signer = strings.ToLower(signer)
+
+	if policy.Signer == auth.PathAddressSigner {
+		pathAddress := mux.Vars(r)["address"]
+		if !common.IsHexAddress(pathAddress) {
+			apierror.HTTPError(w, r, "you must include a valid ETH address in the request", http.StatusBadRequest)
+			return
+		}
 
-	sig := hexutil.MustDecode(sigHex)
-	// https://github.com/ethereum/go-ethereum/blob/55599ee95d4151a2502465e0afc7c47bd1acba77/internal/ethapi/api.go#L442
-	if sig[64] != 27 && sig[64] != 28 {
-		return false
+		if !strings.EqualFold(pathAddress, signer) {
+			apierror.HTTPError(w, r, "Signer does not own this address", http.StatusForbidden)
+			return
+		}
 	}
-	sig[64] -= 27
 
-	pubKey, err := crypto.SigToPub(signHash(msg), sig)
+	next.ServeHTTP(w, r.WithContext(auth.WithSigner(r.Context(), signer)))
+}
+
+// readBody reads the request body and puts it back for the handler
+func readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxSignedBodyBytes))
 	if err != nil {
-		return false
+		return nil, err
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, nil
+}
+
+// actionHash rebuilds the EIP-712 digest the caller should have signed
+func actionHash(cfg config.Config, action, target, address, expiry, nonce string, bodyHash common.Hash) ([]byte, error) {
+	if !common.IsHexAddress(address) {
+		return nil, errors.New("X-Address is not a valid address")
 	}
 
-	recoveredAddr := crypto.PubkeyToAddress(*pubKey)
+	ts, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return nil, errors.New("X-Expiry must be a unix timestamp")
+	}
 
-	return fromAddr == recoveredAddr
-}
+	expiresAt := time.Unix(ts, 0)
+	if err := auth.CheckExpiry(expiresAt, cfg.ActionSignatureMaxAge); err != nil {
+		return nil, err
+	}
 
-// https://github.com/ethereum/go-ethereum/blob/55599ee95d4151a2502465e0afc7c47bd1acba77/internal/ethapi/api.go#L404
-// signHash is a helper function that calculates a hash for the given message that can be
-// safely used to calculate a signature from.
-//
-// The hash is calculated as
-//   keccak256("\x19Ethereum Signed Message:\n"${message length}${message}).
-//
-// This gives context to the signed message and prevents signing of transactions.
-func signHash(data []byte) []byte {
-	msg := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(data), data)
-	return crypto.Keccak256([]byte(msg))
+	return auth.ActionHash(auth.Action{
+		Action:   action,
+		Target:   target,
+		Signer:   address,
+		Expiry:   expiresAt,
+		Nonce:    nonce,
+		BodyHash: bodyHash,
+	}, cfg.EIP712ChainID)
 }
 
 var Options = ProvideRouter
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ethereum/go-ethereum/accounts/abi/bind/backends"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/core"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/gorilla/mux"
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/siwe"
+	"go.uber.org/zap"
+)
+
+// signedRouter serves a signed update_user route that echoes the body it
+// was handed
+func signedRouter(t *testing.T) (*mux.Router, *siwe.Service) {
+	t.Helper()
+
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{}, 8000000)
+	t.Cleanup(func() { sim.Close() })
+
+	var (
+		cfg = config.Config{
+			EIP712ChainID:         1,
+			ActionSignatureMaxAge: 10 * time.Minute,
+			NonceTTL:              10 * time.Minute,
+		}
+		logger      = zap.NewNop().Sugar()
+		db          = database.NewMemoryDatabase(database.MemorySeed{})
+		verifier    = auth.NewVerifier(sim, time.Minute, logger)
+		siweService = siwe.ProvideSIWE(cfg, logger, db, verifier)
+		router      = mux.NewRouter()
+	)
+	router.Handle("/user/{address}", auth.Protect(auth.PolicyOwner(auth.ActionUpdateUser), func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Write(body)
+	})).Methods("POST").Name("updateUser")
+	router.Use(verifySignatureMiddleware(cfg, logger, verifier, siweService))
+
+	return router, siweService
+}
+
+func TestVerifySignature(t *testing.T) {
+	key, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var (
+		signer = strings.ToLower(crypto.PubkeyToAddress(key.PublicKey).Hex())
+		path   = "/user/" + signer
+		signed = `{"bio":"gm"}`
+	)
+
+	// sign returns the headers of an update_user action signed over body
+	sign := func(t *testing.T, siweService *siwe.Service, body string) http.Header {
+		t.Helper()
+
+		nonce, _, err := siweService.NewNonce(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		expiry := time.Now().Add(time.Minute)
+		hash, err := auth.ActionHash(auth.Action{
+			Action:   auth.ActionUpdateUser,
+			Target:   signer,
+			Signer:   signer,
+			Expiry:   expiry,
+			Nonce:    nonce,
+			BodyHash: auth.BodyHash([]byte(body)),
+		}, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig, err := crypto.Sign(hash, key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sig[64] += 27
+
+		return http.Header{
+			"X-Address":   {signer},
+			"X-Expiry":    {strconv.FormatInt(expiry.Unix(), 10)},
+			"X-Nonce":     {nonce},
+			"X-Signature": {hexutil.Encode(sig)},
+		}
+	}
+
+	send := func(router *mux.Router, header http.Header, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(body))
+		req.Header = header.Clone()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		router, siweService := signedRouter(t)
+
+		w := send(router, sign(t, siweService, signed), signed)
+		if w.Code != http.StatusOK || w.Body.String() != signed {
+			t.Fatalf("status = %d with body %q, want 200 with the signed body", w.Code, w.Body)
+		}
+	})
+
+	t.Run("replayed", func(t *testing.T) {
+		router, siweService := signedRouter(t)
+
+		header := sign(t, siweService, signed)
+		if w := send(router, header, signed); w.Code != http.StatusOK {
+			t.Fatalf("first request: status = %d, want 200", w.Code)
+		}
+		if w := send(router, header, signed); w.Code != http.StatusUnauthorized {
+			t.Fatalf("replay: status = %d, want 401", w.Code)
+		}
+	})
+
+	t.Run("body swapped", func(t *testing.T) {
+		router, siweService := signedRouter(t)
+
+		header := sign(t, siweService, signed)
+		if w := send(router, header, `{"bio":"rekt"}`); w.Code != http.StatusUnauthorized {
+			t.Fatalf("status = %d, want 401", w.Code)
+		}
+		// The nonce is only used up by a valid signature
+		if w := send(router, header, signed); w.Code != http.StatusOK {
+			t.Fatalf("status = %d with the signed body, want 200", w.Code)
+		}
+	})
+
+	t.Run("without a nonce", func(t *testing.T) {
+		router, siweService := signedRouter(t)
+
+		header := sign(t, siweService, signed)
+		header.Del("X-Nonce")
+		if w := send(router, header, signed); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", w.Code)
+		}
+	})
+}
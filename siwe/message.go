@@ -0,0 +1,199 @@
+package siwe
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ethereum/go-ethereum/common"
+)
+
+const headerSuffix = " wants you to sign in with your Ethereum account:"
+
+var ErrInvalidMessage = errors.New("invalid_message")
+
+// Message is a parsed EIP-4361 Sign-In with Ethereum message
+// https://eips.ethereum.org/EIPS/eip-4361
+type Message struct {
+	Domain         string
+	Address        string
+	Statement      string
+	URI            string
+	Version        string
+	ChainID        int
+	Nonce          string
+	IssuedAt       time.Time
+	ExpirationTime time.Time
+	NotBefore      time.Time
+	RequestID      string
+	Resources      []string
+}
+
+// ParseMessage parses the plain text message presented to the wallet
+func ParseMessage(raw string) (Message, error) {
+	var (
+		m     Message
+		lines = strings.Split(strings.ReplaceAll(raw, "\r\n", "\n"), "\n")
+		i     = 0
+	)
+
+	invalid := func(format string, args ...interface{}) (Message, error) {
+		return Message{}, fmt.Errorf("%w: %s", ErrInvalidMessage, fmt.Sprintf(format, args...))
+	}
+
+	if len(lines) < 2 || !strings.HasSuffix(lines[0], headerSuffix) {
+		return invalid("missing header")
+	}
+	m.Domain = strings.TrimSuffix(lines[0], headerSuffix)
+	// The scheme is optional and not part of the domain
+	if idx := strings.Index(m.Domain, "://"); idx >= 0 {
+		m.Domain = m.Domain[idx+3:]
+	}
+
+	m.Address = lines[1]
+	if !common.IsHexAddress(m.Address) {
+		return invalid("bad address %q", m.Address)
+	}
+	i = 2
+
+	// The statement is optional and surrounded by blank lines
+	for i < len(lines) && lines[i] == "" {
+		i++
+	}
+	if i < len(lines) && !strings.HasPrefix(lines[i], "URI: ") {
+		m.Statement = lines[i]
+		i++
+		for i < len(lines) && lines[i] == "" {
+			i++
+		}
+	}
+
+	for ; i < len(lines); i++ {
+		line := lines[i]
+		if line == "" {
+			continue
+		}
+
+		if line == "Resources:" {
+			for i+1 < len(lines) && strings.HasPrefix(lines[i+1], "- ") {
+				i++
+				m.Resources = append(m.Resources, strings.TrimPrefix(lines[i], "- "))
+			}
+			continue
+		}
+
+		idx := strings.Index(line, ": ")
+		if idx < 0 {
+			return invalid("bad line %q", line)
+		}
+		key, value := line[:idx], line[idx+2:]
+
+		var err error
+		switch key {
+		case "URI":
+			m.URI = value
+		case "Version":
+			m.Version = value
+		case "Chain ID":
+			m.ChainID, err = strconv.Atoi(value)
+		case "Nonce":
+			m.Nonce = value
+		case "Issued At":
+			m.IssuedAt, err = time.Parse(time.RFC3339, value)
+		case "Expiration Time":
+			m.ExpirationTime, err = time.Parse(time.RFC3339, value)
+		case "Not Before":
+			m.NotBefore, err = time.Parse(time.RFC3339, value)
+		case "Request ID":
+			m.RequestID = value
+		default:
+			return invalid("unknown field %q", key)
+		}
+		if err != nil {
+			return invalid("bad %s %q", key, value)
+		}
+	}
+
+	switch {
+	case m.URI == "":
+		return invalid("missing URI")
+	case m.Version != "1":
+		return invalid("unsupported version %q", m.Version)
+	case m.ChainID == 0:
+		return invalid("missing chain ID")
+	case len(m.Nonce) < 8:
+		return invalid("nonce too short")
+	case m.IssuedAt.IsZero():
+		return invalid("missing issued at")
+	}
+
+	return m, nil
+}
+
+// ValidateOptions are the server-side expectations for a message
+type ValidateOptions struct {
+	Domains  []string
+	ChainIDs []int
+	Now      time.Time
+	// MaxAge bounds how long ago the message could have been issued
+	MaxAge time.Duration
+	// Skew is the allowed clock difference with the client
+	Skew time.Duration
+}
+
+// Validate checks the message against the expected domain, chain and time window
+func (m Message) Validate(opts ValidateOptions) error {
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s", ErrInvalidMessage, fmt.Sprintf(format, args...))
+	}
+
+	if !containsFold(opts.Domains, m.Domain) {
+		return invalid("unexpected domain %q", m.Domain)
+	}
+
+	u, err := url.Parse(m.URI)
+	if err != nil || !strings.EqualFold(u.Host, m.Domain) {
+		return invalid("URI %q does not match domain", m.URI)
+	}
+
+	if !containsInt(opts.ChainIDs, m.ChainID) {
+		return invalid("unsupported chain ID %d", m.ChainID)
+	}
+
+	now := opts.Now
+	if m.IssuedAt.After(now.Add(opts.Skew)) {
+		return invalid("issued in the future")
+	}
+	if opts.MaxAge > 0 && now.Sub(m.IssuedAt) > opts.MaxAge+opts.Skew {
+		return invalid("issued too long ago")
+	}
+	if !m.ExpirationTime.IsZero() && now.After(m.ExpirationTime.Add(opts.Skew)) {
+		return invalid("expired")
+	}
+	if !m.NotBefore.IsZero() && now.Add(opts.Skew).Before(m.NotBefore) {
+		return invalid("not yet valid")
+	}
+
+	return nil
+}
+
+func containsFold(s []string, str string) bool {
+	for _, v := range s {
+		if strings.EqualFold(v, str) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsInt(s []int, n int) bool {
+	for _, v := range s {
+		if v == n {
+			return true
+		}
+	}
+	return false
+}
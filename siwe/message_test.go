@@ -0,0 +1,189 @@
+package siwe
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testAddress = "0x064dca21b1377d1655AC3CA3e95282D9494B5611"
+
+// testMessage joins lines into a message for floor.report
+func testMessage(lines ...string) string {
+	return strings.Join(append([]string{
+		"floor.report wants you to sign in with your Ethereum account:",
+		testAddress,
+	}, lines...), "\n")
+}
+
+var fields = []string{
+	"URI: https://floor.report/login",
+	"Version: 1",
+	"Chain ID: 1",
+	"Nonce: 0123456789abcdef",
+	"Issued At: 2022-08-01T12:00:00Z",
+}
+
+func TestParseMessage(t *testing.T) {
+	issuedAt := time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		raw     string
+		want    Message
+		wantErr bool
+	}{
+		{
+			name: "without a statement",
+			raw:  testMessage(append([]string{""}, fields...)...),
+			want: Message{Domain: "floor.report", Address: testAddress, URI: "https://floor.report/login", Version: "1", ChainID: 1, Nonce: "0123456789abcdef", IssuedAt: issuedAt},
+		},
+		{
+			name: "with a statement, optional fields and resources",
+			raw: testMessage(append(append([]string{"", "Sign in to floor.report", ""}, fields...),
+				"Expiration Time: 2022-08-01T13:00:00Z",
+				"Not Before: 2022-08-01T11:00:00Z",
+				"Request ID: 42",
+				"Resources:",
+				"- https://floor.report/a",
+				"- https://floor.report/b",
+			)...),
+			want: Message{
+				Domain:         "floor.report",
+				Address:        testAddress,
+				Statement:      "Sign in to floor.report",
+				URI:            "https://floor.report/login",
+				Version:        "1",
+				ChainID:        1,
+				Nonce:          "0123456789abcdef",
+				IssuedAt:       issuedAt,
+				ExpirationTime: issuedAt.Add(time.Hour),
+				NotBefore:      issuedAt.Add(-time.Hour),
+				RequestID:      "42",
+				Resources:      []string{"https://floor.report/a", "https://floor.report/b"},
+			},
+		},
+		{
+			name: "with a scheme and CRLF line endings",
+			raw:  strings.ReplaceAll("https://"+testMessage(append([]string{""}, fields...)...), "\n", "\r\n"),
+			want: Message{Domain: "floor.report", Address: testAddress, URI: "https://floor.report/login", Version: "1", ChainID: 1, Nonce: "0123456789abcdef", IssuedAt: issuedAt},
+		},
+		{
+			name:    "missing header",
+			raw:     strings.Join(append([]string{testAddress, ""}, fields...), "\n"),
+			wantErr: true,
+		},
+		{
+			name:    "bad address",
+			raw:     strings.Replace(testMessage(append([]string{""}, fields...)...), testAddress, "0x1234", 1),
+			wantErr: true,
+		},
+		{
+			name:    "unknown field",
+			raw:     testMessage(append(append([]string{""}, fields...), "Color: blue")...),
+			wantErr: true,
+		},
+		{
+			name:    "bad chain ID",
+			raw:     testMessage("", fields[0], fields[1], "Chain ID: one", fields[3], fields[4]),
+			wantErr: true,
+		},
+		{
+			name:    "bad issued at",
+			raw:     testMessage("", fields[0], fields[1], fields[2], fields[3], "Issued At: yesterday"),
+			wantErr: true,
+		},
+		{
+			name:    "missing URI",
+			raw:     testMessage("", fields[1], fields[2], fields[3], fields[4]),
+			wantErr: true,
+		},
+		{
+			name:    "unsupported version",
+			raw:     testMessage("", fields[0], "Version: 2", fields[2], fields[3], fields[4]),
+			wantErr: true,
+		},
+		{
+			name:    "short nonce",
+			raw:     testMessage("", fields[0], fields[1], fields[2], "Nonce: abc", fields[4]),
+			wantErr: true,
+		},
+		{
+			name:    "missing issued at",
+			raw:     testMessage("", fields[0], fields[1], fields[2], fields[3]),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseMessage(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMessage) {
+					t.Fatalf("ParseMessage() = %+v, %v, want ErrInvalidMessage", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Domain != tt.want.Domain || got.Address != tt.want.Address || got.Statement != tt.want.Statement ||
+				got.URI != tt.want.URI || got.Version != tt.want.Version || got.ChainID != tt.want.ChainID ||
+				got.Nonce != tt.want.Nonce || !got.IssuedAt.Equal(tt.want.IssuedAt) ||
+				!got.ExpirationTime.Equal(tt.want.ExpirationTime) || !got.NotBefore.Equal(tt.want.NotBefore) ||
+				got.RequestID != tt.want.RequestID || strings.Join(got.Resources, " ") != strings.Join(tt.want.Resources, " ") {
+				t.Fatalf("ParseMessage() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	var (
+		now  = time.Date(2022, 8, 1, 12, 0, 0, 0, time.UTC)
+		opts = ValidateOptions{
+			Domains:  []string{"floor.report"},
+			ChainIDs: []int{1, 137},
+			Now:      now,
+			MaxAge:   10 * time.Minute,
+			Skew:     time.Minute,
+		}
+		valid = Message{Domain: "floor.report", URI: "https://floor.report/login", ChainID: 1, IssuedAt: now.Add(-5 * time.Minute)}
+	)
+
+	tests := []struct {
+		name    string
+		change  func(m *Message)
+		wantErr bool
+	}{
+		{"valid", func(m *Message) {}, false},
+		{"domain in another case", func(m *Message) { m.Domain = "Floor.Report" }, false},
+		{"other chain", func(m *Message) { m.ChainID = 137 }, false},
+		{"unexpected domain", func(m *Message) { m.Domain = "evil.com"; m.URI = "https://evil.com" }, true},
+		{"URI on another host", func(m *Message) { m.URI = "https://evil.com/login" }, true},
+		{"unsupported chain", func(m *Message) { m.ChainID = 5 }, true},
+		{"issued within the skew", func(m *Message) { m.IssuedAt = now.Add(30 * time.Second) }, false},
+		{"issued in the future", func(m *Message) { m.IssuedAt = now.Add(2 * time.Minute) }, true},
+		{"issued too long ago", func(m *Message) { m.IssuedAt = now.Add(-12 * time.Minute) }, true},
+		{"expired", func(m *Message) { m.ExpirationTime = now.Add(-2 * time.Minute) }, true},
+		{"expired within the skew", func(m *Message) { m.ExpirationTime = now.Add(-30 * time.Second) }, false},
+		{"not yet valid", func(m *Message) { m.NotBefore = now.Add(2 * time.Minute) }, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := valid
+			tt.change(&m)
+
+			err := m.Validate(opts)
+			if tt.wantErr && !errors.Is(err, ErrInvalidMessage) {
+				t.Fatalf("Validate() = %v, want ErrInvalidMessage", err)
+			}
+			if !tt.wantErr && err != nil {
+				t.Fatalf("Validate() = %v, want nil", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,168 @@
+package siwe
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/mager/keiko/auth"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"go.uber.org/zap"
+)
+
+// clockSkew is how far the client clock is allowed to drift from ours
+const clockSkew = time.Minute
+
+var (
+	ErrInvalidNonce   = errors.New("invalid_nonce")
+	ErrInvalidSession = errors.New("invalid_session")
+)
+
+// Service issues nonces and turns signed EIP-4361 messages into sessions
+type Service struct {
+	cfg      config.Config
+	logger   *zap.SugaredLogger
+	db       *database.DatabaseClient
+	verifier *auth.Verifier
+}
+
+// ProvideSIWE provides a Sign-In with Ethereum service
+func ProvideSIWE(
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	db *database.DatabaseClient,
+	verifier *auth.Verifier,
+) *Service {
+	return &Service{
+		cfg:      cfg,
+		logger:   logger,
+		db:       db,
+		verifier: verifier,
+	}
+}
+
+var Options = ProvideSIWE
+
+// NewNonce issues a single-use nonce for a sign-in message
+func (s *Service) NewNonce(ctx context.Context) (string, time.Time, error) {
+	nonce, err := randomHex(16)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	expires := time.Now().Add(s.cfg.NonceTTL)
+	if err := s.db.Nonces.Create(ctx, nonce, expires); err != nil {
+		return "", time.Time{}, err
+	}
+
+	return nonce, expires, nil
+}
+
+// ConsumeNonce uses up nonce, it returns ErrInvalidNonce when the nonce was
+// never issued, was already used or expired
+func (s *Service) ConsumeNonce(ctx context.Context, nonce string) error {
+	expires, err := s.db.Nonces.Consume(ctx, nonce)
+	if err == database.ErrNotFound || (err == nil && time.Now().After(expires)) {
+		return ErrInvalidNonce
+	}
+	return err
+}
+
+// SignIn verifies a signed message and starts a session for its address.
+// It returns the session token, which is only ever stored hashed.
+func (s *Service) SignIn(ctx context.Context, raw, signature string) (string, database.Session, error) {
+	var (
+		session database.Session
+		now     = time.Now()
+	)
+
+	msg, err := ParseMessage(raw)
+	if err != nil {
+		return "", session, err
+	}
+
+	err = msg.Validate(ValidateOptions{
+		Domains:  s.cfg.SIWEDomains,
+		ChainIDs: s.cfg.SIWEChainIDs,
+		Now:      now,
+		MaxAge:   s.cfg.NonceTTL,
+		Skew:     clockSkew,
+	})
+	if err != nil {
+		return "", session, err
+	}
+
+	if err := s.verifier.Verify(ctx, msg.Address, signature, []byte(raw)); err != nil {
+		return "", session, err
+	}
+
+	// Only burn the nonce once the signature checks out
+	if err := s.ConsumeNonce(ctx, msg.Nonce); err != nil {
+		return "", session, err
+	}
+
+	token, err := randomHex(32)
+	if err != nil {
+		return "", session, err
+	}
+
+	session = database.Session{
+		Address: strings.ToLower(msg.Address),
+		ChainID: msg.ChainID,
+		Domain:  msg.Domain,
+		Created: now,
+		Expires: now.Add(s.cfg.SessionTTL),
+	}
+	if !msg.ExpirationTime.IsZero() && msg.ExpirationTime.Before(session.Expires) {
+		session.Expires = msg.ExpirationTime
+	}
+
+	if err := s.db.Sessions.Create(ctx, hashToken(token), session); err != nil {
+		return "", session, err
+	}
+
+	s.logger.Infow("Signed in", "address", session.Address, "expires", session.Expires)
+
+	return token, session, nil
+}
+
+// Session returns the live session for token
+func (s *Service) Session(ctx context.Context, token string) (database.Session, error) {
+	session, err := s.db.Sessions.Get(ctx, hashToken(token))
+	if err == database.ErrNotFound {
+		return session, ErrInvalidSession
+	}
+	if err != nil {
+		return session, err
+	}
+
+	if time.Now().After(session.Expires) {
+		s.SignOut(ctx, token)
+		return session, ErrInvalidSession
+	}
+
+	return session, nil
+}
+
+// SignOut ends the session for token
+func (s *Service) SignOut(ctx context.Context, token string) error {
+	return s.db.Sessions.Delete(ctx, hashToken(token))
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func randomHex(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
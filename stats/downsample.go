@@ -0,0 +1,55 @@
+package stats
+
+import (
+	"time"
+
+	"github.com/mager/keiko/database"
+)
+
+// Point is one bucket of a collection's time series
+type Point struct {
+	// Timestamp is the start of the bucket
+	Timestamp time.Time `json:"timestamp"`
+	// Floor is the last floor in the bucket, Low and High its extremes
+	Floor float64 `json:"floor"`
+	Low   float64 `json:"low"`
+	High  float64 `json:"high"`
+	// Volume and Owners are the last values in the bucket
+	Volume float64 `json:"volume"`
+	Owners int     `json:"owners"`
+}
+
+// Downsample buckets snapshots, which must be oldest first, into fixed
+// intervals. Empty buckets are left out.
+func Downsample(snapshots []database.CollectionStat, interval time.Duration) []Point {
+	points := []Point{}
+
+	for _, snapshot := range snapshots {
+		start := snapshot.Timestamp.Truncate(interval).UTC()
+
+		if n := len(points); n > 0 && points[n-1].Timestamp.Equal(start) {
+			p := &points[n-1]
+			p.Floor = snapshot.Floor
+			p.Volume = snapshot.Volume
+			p.Owners = snapshot.Owners
+			if snapshot.Floor < p.Low {
+				p.Low = snapshot.Floor
+			}
+			if snapshot.Floor > p.High {
+				p.High = snapshot.Floor
+			}
+			continue
+		}
+
+		points = append(points, Point{
+			Timestamp: start,
+			Floor:     snapshot.Floor,
+			Low:       snapshot.Floor,
+			High:      snapshot.Floor,
+			Volume:    snapshot.Volume,
+			Owners:    snapshot.Owners,
+		})
+	}
+
+	return points
+}
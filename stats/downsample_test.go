@@ -0,0 +1,78 @@
+package stats
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/mager/keiko/database"
+)
+
+func TestDownsample(t *testing.T) {
+	var (
+		day  = time.Date(2022, 8, 1, 0, 0, 0, 0, time.UTC)
+		snap = func(offset time.Duration, floor, volume float64, owners int) database.CollectionStat {
+			return database.CollectionStat{Timestamp: day.Add(offset), Floor: floor, Volume: volume, Owners: owners}
+		}
+	)
+
+	tests := []struct {
+		name      string
+		snapshots []database.CollectionStat
+		interval  time.Duration
+		want      []Point
+	}{
+		{
+			name:     "no snapshots",
+			interval: time.Hour,
+			want:     []Point{},
+		},
+		{
+			name: "one bucket keeps the last values and the extremes",
+			snapshots: []database.CollectionStat{
+				snap(5*time.Minute, 10, 100, 50),
+				snap(20*time.Minute, 8, 110, 51),
+				snap(40*time.Minute, 12, 120, 52),
+				snap(55*time.Minute, 11, 130, 53),
+			},
+			interval: time.Hour,
+			want: []Point{
+				{Timestamp: day, Floor: 11, Low: 8, High: 12, Volume: 130, Owners: 53},
+			},
+		},
+		{
+			name: "empty buckets are left out",
+			snapshots: []database.CollectionStat{
+				snap(10*time.Minute, 10, 100, 50),
+				snap(3*time.Hour+10*time.Minute, 9, 200, 60),
+				snap(3*time.Hour+50*time.Minute, 9.5, 210, 61),
+			},
+			interval: time.Hour,
+			want: []Point{
+				{Timestamp: day, Floor: 10, Low: 10, High: 10, Volume: 100, Owners: 50},
+				{Timestamp: day.Add(3 * time.Hour), Floor: 9.5, Low: 9, High: 9.5, Volume: 210, Owners: 61},
+			},
+		},
+		{
+			name: "daily buckets in UTC",
+			snapshots: []database.CollectionStat{
+				{Timestamp: day.Add(23 * time.Hour).In(time.FixedZone("EST", -5*3600)), Floor: 7, Volume: 1, Owners: 1},
+				snap(25*time.Hour, 6, 2, 2),
+			},
+			interval: 24 * time.Hour,
+			want: []Point{
+				{Timestamp: day, Floor: 7, Low: 7, High: 7, Volume: 1, Owners: 1},
+				{Timestamp: day.Add(24 * time.Hour), Floor: 6, Low: 6, High: 6, Volume: 2, Owners: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Downsample(tt.snapshots, tt.interval)
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("Downsample() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,269 @@
+package stats
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// minInterval is the finest bucket a client can ask for
+const minInterval = 5 * time.Minute
+
+var (
+	ErrInvalidRange    = errors.New("invalid_range")
+	ErrInvalidInterval = errors.New("invalid_interval")
+)
+
+// intervalSteps are the intervals used when widening buckets, so bucket
+// boundaries stay on round times
+var intervalSteps = []time.Duration{
+	15 * time.Minute,
+	30 * time.Minute,
+	time.Hour,
+	2 * time.Hour,
+	4 * time.Hour,
+	6 * time.Hour,
+	12 * time.Hour,
+	24 * time.Hour,
+	7 * 24 * time.Hour,
+	30 * 24 * time.Hour,
+}
+
+// Ranges maps each supported range to its length and default bucket
+// interval, a zero length means all time
+var Ranges = map[string]struct {
+	Length   time.Duration
+	Interval time.Duration
+}{
+	"1d":  {24 * time.Hour, time.Hour},
+	"7d":  {7 * 24 * time.Hour, 4 * time.Hour},
+	"30d": {30 * 24 * time.Hour, 24 * time.Hour},
+	"all": {0, 24 * time.Hour},
+}
+
+// Service records collection stat snapshots and serves them as downsampled
+// time series
+type Service struct {
+	cfg    config.Config
+	db     *database.DatabaseClient
+	logger *zap.SugaredLogger
+
+	mu sync.Mutex
+	// latest is the timestamp of the last snapshot of each collection
+	latest map[string]time.Time
+}
+
+// ProvideStats provides a stats Service that snapshots every collection on
+// the StatsSnapshotInterval
+func ProvideStats(
+	lc fx.Lifecycle,
+	cfg config.Config,
+	logger *zap.SugaredLogger,
+	db *database.DatabaseClient,
+) *Service {
+	s := NewService(cfg, db, logger)
+
+	ticker := time.NewTicker(cfg.StatsSnapshotInterval)
+	done := make(chan struct{})
+
+	lc.Append(
+		fx.Hook{
+			OnStart: func(context.Context) error {
+				go func() {
+					for {
+						if err := s.RecordAll(context.Background()); err != nil {
+							logger.Errorw("Failed to record collection stats", "error", err)
+						}
+
+						select {
+						case <-ticker.C:
+						case <-done:
+							return
+						}
+					}
+				}()
+				return nil
+			},
+			OnStop: func(context.Context) error {
+				ticker.Stop()
+				close(done)
+				return nil
+			},
+		},
+	)
+
+	return s
+}
+
+var Options = ProvideStats
+
+// NewService creates a stats Service, it does not record on its own
+func NewService(cfg config.Config, db *database.DatabaseClient, logger *zap.SugaredLogger) *Service {
+	return &Service{
+		cfg:    cfg,
+		db:     db,
+		logger: logger,
+		latest: make(map[string]time.Time),
+	}
+}
+
+// RecordAll snapshots every collection that was updated since its last
+// snapshot
+func (s *Service) RecordAll(ctx context.Context) error {
+	collections, err := s.db.Collections.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	var recorded int
+	for _, c := range collections {
+		if c.Slug == "" || c.Updated.IsZero() {
+			continue
+		}
+
+		latest, err := s.latestSnapshot(ctx, c.Slug)
+		if err != nil {
+			s.logger.Warnw("Failed to read latest stat", "slug", c.Slug, "error", err)
+			continue
+		}
+		if !c.Updated.After(latest) {
+			continue
+		}
+
+		err = s.db.Stats.Add(ctx, c.Slug, database.CollectionStat{
+			Floor:     c.Floor,
+			Volume:    c.OneDayVolume,
+			Owners:    c.NumOwners,
+			Timestamp: c.Updated,
+		})
+		if err != nil {
+			s.logger.Warnw("Failed to record stat", "slug", c.Slug, "error", err)
+			continue
+		}
+
+		s.mu.Lock()
+		s.latest[c.Slug] = c.Updated
+		s.mu.Unlock()
+		recorded++
+	}
+
+	s.logger.Infow("Recorded collection stats", "collections", len(collections), "recorded", recorded)
+
+	return nil
+}
+
+// latestSnapshot returns when the collection was last snapshotted, reading
+// it from the database the first time
+func (s *Service) latestSnapshot(ctx context.Context, slug string) (time.Time, error) {
+	s.mu.Lock()
+	latest, ok := s.latest[slug]
+	s.mu.Unlock()
+	if ok {
+		return latest, nil
+	}
+
+	stat, err := s.db.Stats.Latest(ctx, slug)
+	if err == database.ErrNotFound {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	s.mu.Lock()
+	s.latest[slug] = stat.Timestamp
+	s.mu.Unlock()
+
+	return stat.Timestamp, nil
+}
+
+// Series returns the stats of a collection over rng, bucketed by interval.
+// An empty interval uses the range default, and the interval is widened when
+// it would return more than StatsMaxPoints points.
+func (s *Service) Series(ctx context.Context, slug, rng, interval string) ([]Point, time.Duration, error) {
+	r, ok := Ranges[rng]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: %q", ErrInvalidRange, rng)
+	}
+
+	step := r.Interval
+	if interval != "" {
+		var err error
+		step, err = ParseInterval(interval)
+		if err != nil {
+			return nil, 0, err
+		}
+	}
+
+	var (
+		now  = time.Now()
+		from time.Time
+	)
+	if r.Length > 0 {
+		from = now.Add(-r.Length)
+	}
+
+	snapshots, err := s.db.Stats.Range(ctx, slug, from, now)
+	if err != nil {
+		return nil, 0, err
+	}
+	if len(snapshots) == 0 {
+		return []Point{}, step, nil
+	}
+	if from.IsZero() {
+		from = snapshots[0].Timestamp
+	}
+
+	step = widen(step, now.Sub(from), s.cfg.StatsMaxPoints)
+
+	return Downsample(snapshots, step), step, nil
+}
+
+// ParseInterval parses a bucket interval such as 15m, 4h or 1d
+func ParseInterval(s string) (time.Duration, error) {
+	var (
+		d   time.Duration
+		err error
+	)
+
+	if strings.HasSuffix(s, "d") {
+		var days int
+		days, err = strconv.Atoi(strings.TrimSuffix(s, "d"))
+		d = time.Duration(days) * 24 * time.Hour
+	} else {
+		d, err = time.ParseDuration(s)
+	}
+
+	if err != nil || d < minInterval {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidInterval, s)
+	}
+	return d, nil
+}
+
+// widen grows interval to the next step of intervalSteps until span fits
+// in maxPoints buckets
+func widen(interval, span time.Duration, maxPoints int) time.Duration {
+	if maxPoints <= 0 {
+		return interval
+	}
+
+	for _, step := range intervalSteps {
+		if span/interval < time.Duration(maxPoints) {
+			break
+		}
+		if step > interval {
+			interval = step
+		}
+	}
+
+	return interval
+}
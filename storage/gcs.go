@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"io"
+
+	gcs "cloud.google.com/go/storage"
+)
+
+// GCSStore keeps blobs in a Google Cloud Storage bucket
+type GCSStore struct {
+	bucket *gcs.BucketHandle
+}
+
+// NewGCSStore creates a GCSStore for bucket using the default credentials
+func NewGCSStore(ctx context.Context, bucket string) (*GCSStore, error) {
+	client, err := gcs.NewClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &GCSStore{bucket: client.Bucket(bucket)}, nil
+}
+
+func (s *GCSStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	w := s.bucket.Object(key).NewWriter(ctx)
+	w.ContentType = contentType
+	w.CacheControl = "public, max-age=31536000, immutable"
+
+	if _, err := w.Write(data); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
+
+func (s *GCSStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	r, err := s.bucket.Object(key).NewReader(ctx)
+	if err == gcs.ErrObjectNotExist {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	defer r.Close()
+
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, r.Attrs.ContentType, nil
+}
+
+func (s *GCSStore) Delete(ctx context.Context, key string) error {
+	err := s.bucket.Object(key).Delete(ctx)
+	if err == gcs.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
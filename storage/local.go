@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// contentTypeSuffix is appended to a blob's path to remember its content type
+const contentTypeSuffix = ".content-type"
+
+// LocalStore keeps blobs on the local filesystem, for development
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates a LocalStore rooted at dir
+func NewLocalStore(dir string) *LocalStore {
+	return &LocalStore{dir: dir}
+}
+
+func (s *LocalStore) path(key string) (string, error) {
+	p := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", errors.New("invalid blob key")
+	}
+	return p, nil
+}
+
+func (s *LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+	if err := os.WriteFile(p+contentTypeSuffix, []byte(contentType), 0644); err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0644)
+}
+
+func (s *LocalStore) Get(ctx context.Context, key string) ([]byte, string, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := os.ReadFile(p)
+	if os.IsNotExist(err) {
+		return nil, "", ErrNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+
+	contentType, err := os.ReadFile(p + contentTypeSuffix)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return data, string(contentType), nil
+}
+
+func (s *LocalStore) Delete(ctx context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	os.Remove(p + contentTypeSuffix)
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
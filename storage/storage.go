@@ -0,0 +1,42 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/mager/keiko/config"
+	"go.uber.org/zap"
+)
+
+// ErrNotFound is returned when a blob does not exist
+var ErrNotFound = errors.New("blob_not_found")
+
+// BlobStore stores opaque blobs such as avatar images
+type BlobStore interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Get returns the blob along with its content type
+	Get(ctx context.Context, key string) ([]byte, string, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// ProvideBlobStore provides the blob store selected by the BlobBackend config
+func ProvideBlobStore(cfg config.Config, logger *zap.SugaredLogger) BlobStore {
+	switch cfg.BlobBackend {
+	case "local":
+		logger.Infow("Using local blob store", "dir", cfg.BlobLocalDir)
+		return NewLocalStore(cfg.BlobLocalDir)
+	case "gcs":
+		store, err := NewGCSStore(context.TODO(), cfg.BlobBucket)
+		if err != nil {
+			log.Fatalf("Failed to create GCS client: %v", err)
+		}
+		return store
+	default:
+		log.Fatalf("Unknown blob backend: %s", cfg.BlobBackend)
+	}
+
+	return nil
+}
+
+var Options = ProvideBlobStore
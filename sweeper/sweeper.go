@@ -9,6 +9,9 @@ import (
 	"strings"
 	"time"
 
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/cassette"
+	"github.com/mager/keiko/config"
 	"github.com/mager/sweeper/database"
 	"go.uber.org/zap"
 )
@@ -20,20 +23,22 @@ type SweeperClient struct {
 }
 
 // ProvideSweeper provides an HTTP client
-func ProvideSweeper(logger *zap.SugaredLogger) SweeperClient {
-	tr := &http.Transport{
+func ProvideSweeper(cfg config.Config, logger *zap.SugaredLogger) SweeperClient {
+	tr, err := cassette.Transport(cfg, "sweeper", &http.Transport{
 		MaxIdleConns:       10,
 		IdleConnTimeout:    30 * time.Second,
 		DisableCompression: true,
+	})
+	if err != nil {
+		logger.Fatalw("Failed to set up the sweeper transport", "error", err)
 	}
 
 	return SweeperClient{
 		httpClient: &http.Client{
 			Transport: tr,
 		},
-		logger: logger,
-		// basePath: "http://localhost:8080",
-		basePath: "https://sweeper.floor.report",
+		logger:   logger,
+		basePath: strings.TrimSuffix(cfg.SweeperBaseURL, "/"),
 	}
 }
 
@@ -43,153 +48,78 @@ type UpdateResp struct {
 	Success bool `json:"success"`
 }
 
-// AddCollection adds a collection to the database
-func (s *SweeperClient) AddCollection(slug string) bool {
-	u, err := url.Parse(fmt.Sprintf("%s/update", s.basePath))
-	if err != nil {
-		s.logger.Error(err)
-		return false
-	}
-	q := u.Query()
-	u.RawQuery = q.Encode()
-
-	var jsonStr = []byte(fmt.Sprintf("{\"slug\": \"%s\"}", slug))
-	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonStr))
+// post sends body as JSON to path on sweeper
+func (s *SweeperClient) post(path string, body interface{}) error {
+	u, err := url.Parse(fmt.Sprintf("%s%s", s.basePath, path))
 	if err != nil {
-		s.logger.Error(err)
-		return false
-	}
-
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		s.logger.Error(err)
-		return false
-	}
-	defer resp.Body.Close()
-
-	var updateResp UpdateResp
-	err = json.NewDecoder(resp.Body).Decode(&updateResp)
-	if err != nil {
-
-		s.logger.Error(err)
-		return false
+		return err
 	}
 
-	time.Sleep(time.Millisecond * 250)
-
-	return true
-}
-
-// AddCollections adds multiple collection to the database
-func (s *SweeperClient) AddCollections(slugs []string) bool {
-	u, err := url.Parse(fmt.Sprintf("%s/update/collections", s.basePath))
+	jsonBody, err := json.Marshal(body)
 	if err != nil {
-		s.logger.Error(err)
-		return false
+		return err
 	}
-	q := u.Query()
-	u.RawQuery = q.Encode()
 
-	var stringSlugs = strings.Join(slugs, "\", \"")
-	var jsonStr = []byte(fmt.Sprintf("{\"slugs\": [\"%s\"]}", stringSlugs))
-	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonStr))
+	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonBody))
 	if err != nil {
-		s.logger.Error(err)
-		return false
+		return err
 	}
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		s.logger.Error(err)
-		return false
+		return apierror.Unreachable("sweeper", err)
 	}
 	defer resp.Body.Close()
 
-	var updateResp UpdateResp
-	err = json.NewDecoder(resp.Body).Decode(&updateResp)
-	if err != nil {
-		s.logger.Error(err)
-		return false
-	}
-
-	time.Sleep(time.Millisecond * 250)
-
-	return true
-}
-
-// UpdateUser adds a user to the database
-func (s *SweeperClient) UpdateUser(address string) bool {
-	u, err := url.Parse(fmt.Sprintf("%s/update/user", s.basePath))
-	if err != nil {
-		s.logger.Error(err)
-		return false
-	}
-	q := u.Query()
-	u.RawQuery = q.Encode()
-
-	var jsonStr = []byte(fmt.Sprintf("{\"address\": \"%s\"}", address))
-	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonStr))
-	if err != nil {
+	if err := apierror.FromResponse("sweeper", resp); err != nil {
 		s.logger.Error(err)
-		return false
+		return err
 	}
 
-	resp, err := s.httpClient.Do(req)
-	if err != nil {
-		s.logger.Error(err)
-		return false
-	}
-	defer resp.Body.Close()
-
 	var updateResp UpdateResp
 	err = json.NewDecoder(resp.Body).Decode(&updateResp)
 	if err != nil {
-
 		s.logger.Error(err)
-		return false
+		return apierror.Decode("sweeper", err)
 	}
 
-	return true
+	return nil
 }
 
-// UpdateUserSettings updates user settings
-func (s *SweeperClient) UpdateUserSettings(address string, settings database.UserSettings) bool {
-	u, err := url.Parse(fmt.Sprintf("%s/update/user/settings", s.basePath))
+// AddCollection adds a collection to the database
+func (s *SweeperClient) AddCollection(slug string) error {
+	err := s.post("/update", map[string]string{"slug": slug})
 	if err != nil {
-		s.logger.Error(err)
-		return false
+		return err
 	}
-	q := u.Query()
-	u.RawQuery = q.Encode()
 
-	// Decode settings into a JSON string
-	settingsJSON, err := json.Marshal(settings)
-	if err != nil {
-		s.logger.Error(err)
-		return false
-	}
+	time.Sleep(time.Millisecond * 250)
 
-	var jsonStr = []byte(fmt.Sprintf("{\"address\": \"%s\", \"settings\": %s}", address, settingsJSON))
-	req, err := http.NewRequest("POST", u.String(), bytes.NewBuffer(jsonStr))
-	if err != nil {
-		s.logger.Error(err)
-		return false
-	}
+	return nil
+}
 
-	resp, err := s.httpClient.Do(req)
+// AddCollections adds multiple collection to the database
+func (s *SweeperClient) AddCollections(slugs []string) error {
+	err := s.post("/update/collections", map[string][]string{"slugs": slugs})
 	if err != nil {
-		s.logger.Error(err)
-		return false
+		return err
 	}
-	defer resp.Body.Close()
 
-	var updateResp UpdateResp
-	err = json.NewDecoder(resp.Body).Decode(&updateResp)
-	if err != nil {
+	time.Sleep(time.Millisecond * 250)
 
-		s.logger.Error(err)
-		return false
-	}
+	return nil
+}
 
-	return true
+// UpdateUser adds a user to the database
+func (s *SweeperClient) UpdateUser(address string) error {
+	return s.post("/update/user", map[string]string{"address": address})
+}
+
+// UpdateUserSettings updates user settings
+func (s *SweeperClient) UpdateUserSettings(address string, settings database.UserSettings) error {
+	return s.post("/update/user/settings", map[string]interface{}{
+		"address":  address,
+		"settings": settings,
+	})
 }
@@ -0,0 +1,296 @@
+package transfers
+
+import (
+	"context"
+	"errors"
+	"math/big"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mager/keiko/database"
+)
+
+// burnAddresses own the tokens that were burned
+var burnAddresses = map[string]bool{
+	"0x0000000000000000000000000000000000000000": true,
+	"0x000000000000000000000000000000000000dead": true,
+}
+
+// Token is a holding of a token, ERC-1155 tokens can have several owners
+// holding different quantities
+type Token struct {
+	Contract string
+	TokenID  string
+	Standard string
+	Owner    string
+	Quantity *big.Int
+	// Acquired is when the owner last received the token
+	Acquired time.Time
+}
+
+// Holder is an address and how much of the tokens it holds
+type Holder struct {
+	Address string
+	// Tokens is how many different tokens it holds, Quantity how many in all
+	Tokens   int
+	Quantity *big.Int
+	// Share is the fraction of the supply held
+	Share float64
+}
+
+// Distribution describes how the tokens of a collection are spread over
+// holders
+type Distribution struct {
+	// Tokens is how many different tokens are held, Supply how many in all
+	Tokens        int
+	Supply        *big.Int
+	UniqueHolders int
+	// TopHolders hold the largest quantity, most first
+	TopHolders []Holder
+	// Top10Share is the fraction of the supply held by the top 10 holders
+	Top10Share float64
+	// SingleTokenHolders hold a quantity of exactly one
+	SingleTokenHolders int
+}
+
+// Tokens returns the current holdings of every token of contracts that was
+// not burned, by contract in order and then by token ID. They are the
+// holdings as of each contract's last sync. A contract not synced within the
+// sync interval is synced again in the background. It returns ErrSyncing
+// while a contract was never synced, and the error of its last sync when that
+// failed.
+func (s *Service) Tokens(ctx context.Context, contracts []string) ([]Token, error) {
+	var (
+		tokens  []Token
+		syncing bool
+	)
+	for _, contract := range contracts {
+		held, err := s.current(strings.ToLower(contract))
+		if errors.Is(err, ErrSyncing) {
+			syncing = true
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, held...)
+	}
+	if syncing {
+		return nil, ErrSyncing
+	}
+
+	return tokens, nil
+}
+
+// current returns the holdings of contract as of its last sync, and starts a
+// sync when the last one started longer than the sync interval ago
+func (s *Service) current(contract string) ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h, ok := s.holdings[contract]
+	if !ok {
+		h = &holdings{}
+		s.holdings[contract] = h
+	}
+	if !h.running && time.Since(h.attempted) >= s.syncInterval {
+		h.running = true
+		h.attempted = time.Now()
+		go s.refresh(contract)
+	}
+
+	switch {
+	case !h.synced.IsZero():
+		return h.tokens, nil
+	case h.err != nil && !h.running:
+		return nil, h.err
+	default:
+		return nil, ErrSyncing
+	}
+}
+
+// refresh syncs contract and computes its holdings from its transfers
+func (s *Service) refresh(contract string) {
+	tokens, err := s.syncHoldings(s.ctx, contract)
+	if err != nil {
+		s.logger.Warnw("Failed to refresh holdings", "contract", contract, "error", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := s.holdings[contract]
+	h.running = false
+	h.err = err
+	if err == nil {
+		h.tokens = tokens
+		h.synced = time.Now()
+	}
+}
+
+func (s *Service) syncHoldings(ctx context.Context, contract string) ([]Token, error) {
+	if err := s.Sync(ctx, contract); err != nil {
+		return nil, err
+	}
+
+	transfers, err := s.db.Transfers.List(ctx, contract)
+	if err != nil {
+		return nil, err
+	}
+	return CurrentOwners(contract, transfers), nil
+}
+
+// balance is what an owner holds of a token
+type balance struct {
+	quantity *big.Int
+	acquired time.Time
+}
+
+// CurrentOwners replays the transfers of contract to the balance of each
+// owner of each token. Every transfer moves its quantity from the sender to
+// the recipient, which also covers each token of an ERC-1155 batch. Burned
+// quantities are left out.
+func CurrentOwners(contract string, transfers []database.Transfer) []Token {
+	sorted := make([]database.Transfer, len(transfers))
+	copy(sorted, transfers)
+	database.SortTransfers(sorted)
+
+	var (
+		balances  = make(map[string]map[string]*balance)
+		standards = make(map[string]string)
+	)
+	for _, transfer := range sorted {
+		quantity, ok := transfer.Quantity()
+		if !ok {
+			continue
+		}
+
+		owners, ok := balances[transfer.TokenID]
+		if !ok {
+			owners = make(map[string]*balance)
+			balances[transfer.TokenID] = owners
+		}
+		standards[transfer.TokenID] = transfer.TokenStandard()
+
+		// Mints come from the zero address, which is not tracked
+		if !burnAddresses[transfer.From] {
+			from := holding(owners, transfer.From)
+			from.quantity.Sub(from.quantity, quantity)
+		}
+		if !burnAddresses[transfer.To] {
+			to := holding(owners, transfer.To)
+			to.quantity.Add(to.quantity, quantity)
+			to.acquired = transfer.Timestamp
+		}
+	}
+
+	var tokens []Token
+	for tokenID, owners := range balances {
+		for owner, b := range owners {
+			// A negative balance means part of the history is missing
+			if b.quantity.Sign() <= 0 {
+				continue
+			}
+			tokens = append(tokens, Token{
+				Contract: contract,
+				TokenID:  tokenID,
+				Standard: standards[tokenID],
+				Owner:    owner,
+				Quantity: b.quantity,
+				Acquired: b.acquired,
+			})
+		}
+	}
+	sort.Slice(tokens, func(i, j int) bool {
+		if tokens[i].TokenID != tokens[j].TokenID {
+			return lessTokenID(tokens[i].TokenID, tokens[j].TokenID)
+		}
+		return tokens[i].Owner < tokens[j].Owner
+	})
+
+	return tokens
+}
+
+func holding(owners map[string]*balance, owner string) *balance {
+	b, ok := owners[owner]
+	if !ok {
+		b = &balance{quantity: new(big.Int)}
+		owners[owner] = b
+	}
+	return b
+}
+
+// HolderDistribution returns the distribution of tokens with the top holders
+// holding the largest quantity
+func HolderDistribution(tokens []Token, top int) Distribution {
+	var (
+		supply   = new(big.Int)
+		held     = make(map[string]bool)
+		holdings = make(map[string]*Holder)
+	)
+	for _, token := range tokens {
+		supply.Add(supply, token.Quantity)
+		held[token.Contract+"/"+token.TokenID] = true
+
+		holder, ok := holdings[token.Owner]
+		if !ok {
+			holder = &Holder{Address: token.Owner, Quantity: new(big.Int)}
+			holdings[token.Owner] = holder
+		}
+		holder.Tokens++
+		holder.Quantity.Add(holder.Quantity, token.Quantity)
+	}
+
+	holders := make([]Holder, 0, len(holdings))
+	for _, holder := range holdings {
+		holder.Share = share(holder.Quantity, supply)
+		holders = append(holders, *holder)
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		if c := holders[i].Quantity.Cmp(holders[j].Quantity); c != 0 {
+			return c > 0
+		}
+		return holders[i].Address < holders[j].Address
+	})
+
+	d := Distribution{
+		Tokens:        len(held),
+		Supply:        supply,
+		UniqueHolders: len(holders),
+	}
+	one := big.NewInt(1)
+	for i, holder := range holders {
+		if i < 10 {
+			d.Top10Share += holder.Share
+		}
+		if holder.Quantity.Cmp(one) == 0 {
+			d.SingleTokenHolders++
+		}
+	}
+	if top > len(holders) {
+		top = len(holders)
+	}
+	d.TopHolders = holders[:top]
+
+	return d
+}
+
+// share returns quantity as a fraction of supply
+func share(quantity, supply *big.Int) float64 {
+	if supply.Sign() == 0 {
+		return 0
+	}
+	f, _ := new(big.Float).Quo(new(big.Float).SetInt(quantity), new(big.Float).SetInt(supply)).Float64()
+	return f
+}
+
+// lessTokenID orders token IDs numerically, they can be larger than an int64
+func lessTokenID(a, b string) bool {
+	x, okA := new(big.Int).SetString(a, 10)
+	y, okB := new(big.Int).SetString(b, 10)
+	if !okA || !okB {
+		return a < b
+	}
+	return x.Cmp(y) < 0
+}
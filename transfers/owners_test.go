@@ -0,0 +1,227 @@
+package transfers
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/mager/keiko/database"
+)
+
+const (
+	zero = "0x0000000000000000000000000000000000000000"
+	dead = "0x000000000000000000000000000000000000dead"
+)
+
+// transfer moves quantity of token from one owner to another in block, a
+// quantity of 0 is an ERC-721 transfer
+func transfer(block int64, token, from, to string, quantity int64) database.Transfer {
+	t := database.Transfer{
+		Hash:        fmt.Sprintf("0x%x", block),
+		BlockNumber: block,
+		From:        from,
+		To:          to,
+		TokenID:     token,
+		Timestamp:   time.Unix(block, 0),
+		Standard:    database.StandardERC721,
+	}
+	if quantity > 0 {
+		t.Standard = database.StandardERC1155
+		t.Value = fmt.Sprint(quantity)
+	}
+	return t
+}
+
+// formatTokens formats tokens as "token owner quantity acquired"
+func formatTokens(tokens []Token) []string {
+	out := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		out = append(out, fmt.Sprintf("%s %s %s %d", token.TokenID, token.Owner, token.Quantity, token.Acquired.Unix()))
+	}
+	return out
+}
+
+func TestCurrentOwners(t *testing.T) {
+	tests := []struct {
+		name      string
+		transfers []database.Transfer
+		want      []string
+	}{
+		{
+			name: "erc721 resale",
+			transfers: []database.Transfer{
+				transfer(1, "1", zero, "0xa", 0),
+				transfer(2, "1", "0xa", "0xb", 0),
+			},
+			want: []string{"1 0xb 1 2"},
+		},
+		{
+			name: "replayed in block order",
+			transfers: []database.Transfer{
+				transfer(3, "1", "0xb", "0xc", 0),
+				transfer(1, "1", zero, "0xa", 0),
+				transfer(2, "1", "0xa", "0xb", 0),
+			},
+			want: []string{"1 0xc 1 3"},
+		},
+		{
+			name: "burned",
+			transfers: []database.Transfer{
+				transfer(1, "1", zero, "0xa", 0),
+				transfer(1, "2", zero, "0xa", 0),
+				transfer(2, "1", "0xa", zero, 0),
+				transfer(3, "2", "0xa", dead, 0),
+			},
+		},
+		{
+			name: "erc1155 split between owners",
+			transfers: []database.Transfer{
+				transfer(1, "7", zero, "0xa", 10),
+				transfer(2, "7", "0xa", "0xb", 3),
+				transfer(3, "7", "0xa", dead, 2),
+			},
+			want: []string{"7 0xa 5 1", "7 0xb 3 2"},
+		},
+		{
+			name: "sent away entirely",
+			transfers: []database.Transfer{
+				transfer(1, "7", zero, "0xa", 2),
+				transfer(2, "7", "0xa", "0xb", 2),
+			},
+			want: []string{"7 0xb 2 2"},
+		},
+		{
+			name: "missing history",
+			transfers: []database.Transfer{
+				transfer(2, "1", "0xa", "0xb", 0),
+			},
+			want: []string{"1 0xb 1 2"},
+		},
+		{
+			name: "numeric token order",
+			transfers: []database.Transfer{
+				transfer(1, "10", zero, "0xa", 0),
+				transfer(1, "9", zero, "0xa", 0),
+				transfer(1, "115792089237316195423570985008687907853269984665640564039457584007913129639935", zero, "0xa", 0),
+			},
+			want: []string{
+				"9 0xa 1 1",
+				"10 0xa 1 1",
+				"115792089237316195423570985008687907853269984665640564039457584007913129639935 0xa 1 1",
+			},
+		},
+		{
+			name: "unparsable value",
+			transfers: []database.Transfer{
+				transfer(1, "1", zero, "0xa", 0),
+				{BlockNumber: 2, TokenID: "1", From: "0xa", To: "0xb", Standard: database.StandardERC1155, Value: "lots"},
+			},
+			want: []string{"1 0xa 1 1"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := formatTokens(CurrentOwners("0xc0", tt.transfers))
+			if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+				t.Fatalf("CurrentOwners() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHolderDistribution(t *testing.T) {
+	token := func(id, owner string, quantity int64) Token {
+		return Token{Contract: "0xc0", TokenID: id, Owner: owner, Quantity: big.NewInt(quantity)}
+	}
+
+	tests := []struct {
+		name   string
+		tokens []Token
+		top    int
+		want   Distribution
+		// wantTop are the addresses of the top holders
+		wantTop []string
+	}{
+		{
+			name: "empty",
+			top:  10,
+			want: Distribution{Supply: big.NewInt(0)},
+		},
+		{
+			name: "erc721",
+			tokens: []Token{
+				token("1", "0xa", 1),
+				token("2", "0xa", 1),
+				token("3", "0xb", 1),
+				token("4", "0xc", 1),
+			},
+			top:     10,
+			want:    Distribution{Tokens: 4, Supply: big.NewInt(4), UniqueHolders: 3, Top10Share: 1, SingleTokenHolders: 2},
+			wantTop: []string{"0xa", "0xb", "0xc"},
+		},
+		{
+			name: "erc1155 limited to the top holder",
+			tokens: []Token{
+				token("7", "0xa", 5),
+				token("7", "0xb", 3),
+				token("8", "0xb", 3),
+				token("8", "0xc", 1),
+			},
+			top:     1,
+			want:    Distribution{Tokens: 2, Supply: big.NewInt(12), UniqueHolders: 3, Top10Share: 1, SingleTokenHolders: 1},
+			wantTop: []string{"0xb"},
+		},
+		{
+			name:    "more than 10 holders",
+			tokens:  manyHolders(12),
+			top:     2,
+			want:    Distribution{Tokens: 12, Supply: big.NewInt(12), UniqueHolders: 12, Top10Share: 10.0 / 12, SingleTokenHolders: 12},
+			wantTop: []string{"0x00", "0x01"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HolderDistribution(tt.tokens, tt.top)
+
+			if got.Tokens != tt.want.Tokens || got.Supply.Cmp(tt.want.Supply) != 0 || got.UniqueHolders != tt.want.UniqueHolders ||
+				math.Abs(got.Top10Share-tt.want.Top10Share) > 1e-9 || got.SingleTokenHolders != tt.want.SingleTokenHolders {
+				t.Fatalf("HolderDistribution() = %+v, want %+v", got, tt.want)
+			}
+
+			var top []string
+			for _, holder := range got.TopHolders {
+				top = append(top, holder.Address)
+			}
+			if fmt.Sprint(top) != fmt.Sprint(tt.wantTop) {
+				t.Fatalf("top holders = %v, want %v", top, tt.wantTop)
+			}
+		})
+	}
+}
+
+// manyHolders returns n tokens each held by a different owner
+func manyHolders(n int) []Token {
+	tokens := make([]Token, 0, n)
+	for i := 0; i < n; i++ {
+		tokens = append(tokens, Token{Contract: "0xc0", TokenID: fmt.Sprint(i), Owner: fmt.Sprintf("0x%02d", i), Quantity: big.NewInt(1)})
+	}
+	return tokens
+}
+
+func TestHolderShares(t *testing.T) {
+	d := HolderDistribution([]Token{
+		{Contract: "0xc0", TokenID: "1", Owner: "0xa", Quantity: big.NewInt(3)},
+		{Contract: "0xc0", TokenID: "1", Owner: "0xb", Quantity: big.NewInt(1)},
+	}, 10)
+
+	want := map[string]float64{"0xa": 0.75, "0xb": 0.25}
+	for _, holder := range d.TopHolders {
+		if holder.Share != want[holder.Address] {
+			t.Errorf("%s has a share of %v, want %v", holder.Address, holder.Share, want[holder.Address])
+		}
+	}
+}
@@ -0,0 +1,266 @@
+package transfers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mager/keiko/apierror"
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/etherscan"
+	"github.com/mager/keiko/indexer"
+	"go.uber.org/fx"
+	"go.uber.org/zap"
+)
+
+// Transfer sources
+const (
+	SourceEtherscan = "etherscan"
+	SourceLogs      = "logs"
+)
+
+// ErrSyncing is returned while the transfers of a contract are synced for
+// the first time
+var ErrSyncing = errors.New("transfers are syncing")
+
+// Service syncs the ERC-721 and ERC-1155 transfers of contracts into the
+// database from Etherscan or the chain's logs, fetching only what is new
+// since the last sync. Syncs run in the background, and the holdings of each
+// contract are computed once per sync.
+type Service struct {
+	db           *database.DatabaseClient
+	etherscan    *etherscan.EtherscanClient
+	indexer      *indexer.Indexer
+	logger       *zap.SugaredLogger
+	source       string
+	syncInterval time.Duration
+
+	// ctx is canceled by Stop to end the background syncs
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu sync.Mutex
+	// syncing holds a lock per contract so a contract is synced once at a
+	// time, holdings are the holdings of each contract as of its last sync
+	syncing  map[string]*sync.Mutex
+	holdings map[string]*holdings
+}
+
+// holdings are the holdings of a contract as of its last sync
+type holdings struct {
+	tokens []Token
+	// synced is when the last successful sync ended, attempted when the
+	// last one started and err what it failed with
+	synced    time.Time
+	attempted time.Time
+	err       error
+	running   bool
+}
+
+// ProvideTransfers provides a transfers Service reading from the
+// TransferSource
+func ProvideTransfers(
+	lc fx.Lifecycle,
+	cfg config.Config,
+	db *database.DatabaseClient,
+	etherscanClient *etherscan.EtherscanClient,
+	idx *indexer.Indexer,
+	logger *zap.SugaredLogger,
+) *Service {
+	switch cfg.TransferSource {
+	case SourceEtherscan, SourceLogs:
+	default:
+		logger.Fatalw("Unknown transfer source", "source", cfg.TransferSource)
+	}
+
+	s := NewService(db, etherscanClient, idx, cfg.TransferSource, cfg.TransferSyncInterval, logger)
+
+	lc.Append(
+		fx.Hook{
+			OnStop: func(context.Context) error {
+				s.Stop()
+				return nil
+			},
+		},
+	)
+
+	return s
+}
+
+var Options = ProvideTransfers
+
+// NewService creates a transfers Service that syncs a contract from source
+// at most once per syncInterval
+func NewService(
+	db *database.DatabaseClient,
+	etherscanClient *etherscan.EtherscanClient,
+	idx *indexer.Indexer,
+	source string,
+	syncInterval time.Duration,
+	logger *zap.SugaredLogger,
+) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	return &Service{
+		db:           db,
+		etherscan:    etherscanClient,
+		indexer:      idx,
+		logger:       logger,
+		source:       source,
+		syncInterval: syncInterval,
+		ctx:          ctx,
+		cancel:       cancel,
+		syncing:      make(map[string]*sync.Mutex),
+		holdings:     make(map[string]*holdings),
+	}
+}
+
+// Stop cancels the background syncs
+func (s *Service) Stop() {
+	s.cancel()
+}
+
+// standards are the token standards synced, with the Etherscan action that
+// lists their transfers. A contract usually has transfers of only one.
+var standards = []struct {
+	standard string
+	action   string
+}{
+	{database.StandardERC721, etherscan.ActionERC721},
+	{database.StandardERC1155, etherscan.ActionERC1155},
+}
+
+// Sync stores the transfers of contract since the last sync. From
+// Etherscan, each token standard is fetched from its synced block. The synced
+// block itself is fetched again since it may have had more transfers after
+// the last sync. Progress is saved after each batch, so an interrupted sync
+// picks up where it stopped.
+func (s *Service) Sync(ctx context.Context, contract string) error {
+	contract = strings.ToLower(contract)
+
+	lock := s.lock(contract)
+	lock.Lock()
+	defer lock.Unlock()
+
+	if s.source == SourceLogs {
+		if err := s.indexer.Sync(ctx, contract); err != nil {
+			return err
+		}
+	} else {
+		for _, standard := range standards {
+			if err := s.syncStandard(ctx, contract, standard.standard, standard.action); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) syncStandard(ctx context.Context, contract, standard, action string) error {
+	start, err := s.db.Transfers.SyncedBlock(ctx, contract, standard)
+	if err != nil && !errors.Is(err, database.ErrNotFound) {
+		return err
+	}
+
+	var (
+		count int
+		order blockOrder
+	)
+	err = s.etherscan.WalkNFTTransactionsForContract(ctx, contract, action, start, func(txs []etherscan.EtherscanTrx) error {
+		transfers, synced, err := adaptTransfers(standard, txs, &order)
+		if err != nil {
+			return err
+		}
+		count += len(transfers)
+
+		return s.db.Transfers.Add(ctx, contract, standard, transfers, synced)
+	})
+	if err != nil {
+		s.logger.Warnw("Failed to sync transfers", "contract", contract, "standard", standard, "from", start, "synced", count, "error", err)
+		return err
+	}
+
+	s.logger.Infow("Synced transfers", "contract", contract, "standard", standard, "from", start, "count", count)
+	return nil
+}
+
+func (s *Service) lock(contract string) *sync.Mutex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	lock, ok := s.syncing[contract]
+	if !ok {
+		lock = &sync.Mutex{}
+		s.syncing[contract] = lock
+	}
+	return lock
+}
+
+// blockOrder numbers transfers within their block in the order Etherscan
+// lists them, which is their log order. It carries over between batches, as
+// the pages of a busy block come in several.
+type blockOrder struct {
+	block int64
+	next  int
+}
+
+func (o *blockOrder) index(block int64) int {
+	if block != o.block {
+		o.block, o.next = block, 0
+	}
+	o.next++
+	return o.next - 1
+}
+
+// adaptTransfers converts a batch of Etherscan transfers of standard, along
+// with the last block in it
+func adaptTransfers(standard string, txs []etherscan.EtherscanTrx, order *blockOrder) ([]database.Transfer, int64, error) {
+	var (
+		transfers = make([]database.Transfer, 0, len(txs))
+		last      int64
+	)
+	for _, tx := range txs {
+		block, err := tx.Block()
+		if err != nil {
+			return nil, 0, err
+		}
+		ts, err := strconv.ParseInt(tx.Timestamp, 10, 64)
+		if err != nil {
+			return nil, 0, apierror.Decode("etherscan", err)
+		}
+		txIndex, _ := strconv.Atoi(tx.TransactionIndex)
+
+		var value string
+		if standard == database.StandardERC1155 {
+			if _, ok := new(big.Int).SetString(tx.TokenValue, 10); !ok {
+				return nil, 0, apierror.Decode("etherscan", fmt.Errorf("token value %q", tx.TokenValue))
+			}
+			value = tx.TokenValue
+		}
+
+		transfers = append(transfers, database.Transfer{
+			Hash:             tx.Hash,
+			BlockNumber:      block,
+			TransactionIndex: txIndex,
+			LogIndex:         order.index(block),
+			From:             strings.ToLower(tx.From),
+			To:               strings.ToLower(tx.To),
+			TokenID:          tx.TokenID,
+			Timestamp:        time.Unix(ts, 0).UTC(),
+			Standard:         standard,
+			Value:            value,
+		})
+		if block > last {
+			last = block
+		}
+	}
+
+	return transfers, last, nil
+}
@@ -0,0 +1,110 @@
+package transfers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/mager/keiko/config"
+	"github.com/mager/keiko/database"
+	"github.com/mager/keiko/etherscan"
+	"go.uber.org/zap"
+)
+
+func TestAdaptTransfersNumbersTransfersInBlock(t *testing.T) {
+	tx := func(block, hash, from, to string) etherscan.EtherscanTrx {
+		return etherscan.EtherscanTrx{BlockNumber: block, Hash: hash, From: from, To: to, TokenID: "1", Timestamp: "1660000000"}
+	}
+
+	var (
+		order = blockOrder{}
+		// The same token goes back and forth in one transaction, and a busy
+		// block is split over two batches
+		batches = [][]etherscan.EtherscanTrx{
+			{tx("100", "0xa", "0x1", "0x2"), tx("100", "0xa", "0x2", "0x1")},
+			{tx("100", "0xa", "0x1", "0x2"), tx("101", "0xb", "0x2", "0x3")},
+		}
+		want = []int{0, 1, 2, 0}
+		got  []database.Transfer
+	)
+	for _, batch := range batches {
+		transfers, _, err := adaptTransfers(database.StandardERC721, batch, &order)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, transfers...)
+	}
+
+	ids := make(map[string]bool)
+	for i, transfer := range got {
+		if transfer.LogIndex != want[i] {
+			t.Errorf("transfer %d has LogIndex %d, want %d", i, transfer.LogIndex, want[i])
+		}
+		if ids[transfer.ID()] {
+			t.Errorf("transfer %d has the ID %s of an earlier one", i, transfer.ID())
+		}
+		ids[transfer.ID()] = true
+	}
+}
+
+func TestTokensSyncsInBackground(t *testing.T) {
+	var (
+		calls   int32
+		release = make(chan struct{})
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-release
+		}
+		if r.URL.Query().Get("action") != etherscan.ActionERC721 {
+			w.Write([]byte(`{"status":"0","message":"No transactions found","result":[]}`))
+			return
+		}
+		w.Write([]byte(`{"status":"1","message":"OK","result":[{"blockNumber":"100","hash":"0xa","from":"0x0000000000000000000000000000000000000000","to":"0x1","tokenID":"7","timeStamp":"1660000000"}]}`))
+	}))
+	defer srv.Close()
+
+	var (
+		logger = zap.NewNop().Sugar()
+		client = etherscan.ProvideEtherscan(config.Config{EtherscanBaseURL: srv.URL}, logger)
+		db     = database.NewMemoryDatabase(database.MemorySeed{})
+		s      = NewService(db, client, nil, SourceEtherscan, time.Hour, logger)
+		ctx    = context.Background()
+	)
+	defer s.Stop()
+
+	if _, err := s.Tokens(ctx, []string{"0xABC"}); !errors.Is(err, ErrSyncing) {
+		t.Fatalf("Tokens() = %v before the first sync, want ErrSyncing", err)
+	}
+	close(release)
+
+	var (
+		tokens []Token
+		err    error
+	)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if tokens, err = s.Tokens(ctx, []string{"0xABC"}); !errors.Is(err, ErrSyncing) {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].TokenID != "7" || tokens[0].Owner != "0x1" {
+		t.Fatalf("Tokens() = %+v, want token 7 held by 0x1", tokens)
+	}
+
+	// Within the sync interval the holdings are served without a sync
+	synced := atomic.LoadInt32(&calls)
+	if _, err := s.Tokens(ctx, []string{"0xabc"}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if got := atomic.LoadInt32(&calls); got != synced {
+		t.Fatalf("Etherscan called %d times after the sync, want %d", got, synced)
+	}
+}
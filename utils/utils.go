@@ -1,6 +1,10 @@
 package utils
 
-import "math"
+import (
+	"math"
+	"net/url"
+	"strings"
+)
 
 // roundFloat rounds a float to the nearest n integer
 func RoundFloat(f float64, n int) float64 {
@@ -19,9 +23,29 @@ func Remove(slice []string, s string) []string {
 }
 
 func AdaptTotalUSD(totalETH float64, ethPriceUSD float64) float64 {
-	v := totalETH * ethPriceUSD
+	return AdaptTotalFiat(totalETH, ethPriceUSD, "USD")
+}
+
+// zeroDecimalCurrencies have no minor unit
+var zeroDecimalCurrencies = map[string]bool{
+	"JPY": true,
+	"KRW": true,
+	"VND": true,
+}
+
+// AdaptTotalFiat converts totalETH at rate and rounds to the currency's minor unit
+func AdaptTotalFiat(totalETH float64, rate float64, currency string) float64 {
+	v := totalETH * rate
+	if zeroDecimalCurrencies[strings.ToUpper(currency)] {
+		return math.Round(v)
+	}
+
 	// Round to 2 decimal places
-	v = math.Round(v*100) / 100
+	return math.Round(v*100) / 100
+}
 
-	return v
+// IsHTTPURL reports whether s is an absolute http(s) URL
+func IsHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "https" || u.Scheme == "http") && u.Host != ""
 }